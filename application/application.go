@@ -2,21 +2,35 @@ package application
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/carbocation/interpose"
 	_ "github.com/go-sql-driver/mysql"
 	gorilla_mux "github.com/gorilla/mux"
-	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
 	"github.com/spf13/viper"
 
 	"github.com/punocracy/punocracy/handlers"
+	"github.com/punocracy/punocracy/libevent"
+	"github.com/punocracy/punocracy/liblockout"
+	"github.com/punocracy/punocracy/libmail"
+	"github.com/punocracy/punocracy/liboidc"
+	"github.com/punocracy/punocracy/libpassword"
+	"github.com/punocracy/punocracy/libratelimit"
+	"github.com/punocracy/punocracy/libreputation"
+	"github.com/punocracy/punocracy/libsession"
+	"github.com/punocracy/punocracy/libsse"
+	"github.com/punocracy/punocracy/libwebhook"
 	"github.com/punocracy/punocracy/middlewares"
+	"github.com/punocracy/punocracy/models"
 )
 
 // New is the constructor for Application struct.
@@ -50,32 +64,402 @@ func New(config *viper.Viper) (*Application, error) {
 
 	mongodb := client.Database("punocracy")
 
-	cookieStoreSecret := config.Get("cookie_secret").(string)
+	err = models.EnsurePhraseIndexes(models.NewPhraseConnection(mongodb))
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.EnsureFavoriteIndexes(models.NewFavoritesConnection(mongodb))
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := sessionSecrets(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Email tokens are signed with the current session secret unless they have their own
+	if config.GetString("token_secret") == "" {
+		config.Set("token_secret", secrets[0])
+	}
+
+	rateLimits := make(map[string]libratelimit.Limit)
+	for _, name := range []string{"submit", "signup", "login", "rating", "email", "comment"} {
+		limit, err := libratelimit.ParseLimit(config.GetString("ratelimit_" + name))
+		if err != nil {
+			return nil, err
+		}
+		rateLimits[name] = limit
+	}
+
+	mailer, err := libmail.New(
+		config.GetString("mailer"),
+		config.GetString("smtp_addr"),
+		config.GetString("smtp_username"),
+		config.GetString("smtp_password"),
+		config.GetString("mail_from"),
+		config.GetString("mail_file"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, mailerDisabled := mailer.(*libmail.DisabledMailer)
+	if mailerDisabled {
+		logrus.Warnln("mailer is not set, account and notification emails won't be sent.")
+	}
+
+	passwordPolicy := &libpassword.Policy{MinLength: config.GetInt("password_min_length")}
+	if breachedFile := config.GetString("password_breached_file"); breachedFile != "" {
+		passwordPolicy.Breached, err = libpassword.LoadBreached(breachedFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	passwordHasher := &libpassword.Hasher{
+		Algorithm:    config.GetString("password_hash"),
+		BcryptCost:   config.GetInt("password_bcrypt_cost"),
+		ArgonTime:    uint32(config.GetInt("password_argon2_time")),
+		ArgonMemory:  uint32(config.GetInt("password_argon2_memory")),
+		ArgonThreads: uint8(config.GetInt("password_argon2_threads")),
+	}
+	err = passwordHasher.Validate()
+	if err != nil {
+		return nil, err
+	}
 
 	app := &Application{}
 	app.config = config
 	app.dsn = dsn
 	app.db = db
 	app.mongodb = mongodb
-	app.sessionStore = sessions.NewCookieStore([]byte(cookieStoreSecret))
+	app.sessionStore = libsession.NewStore(
+		models.NewSession(db),
+		sessionUserID,
+		int(config.GetDuration("session_max_age").Seconds()),
+		secrets...,
+	)
+	// LoadUser loads the user for every request, so only their ID is kept in the session
+	app.sessionStore.Transient = []string{"user"}
+	app.rateLimitBackend = libratelimit.NewMemoryBackend()
+	app.rateLimits = rateLimits
+	app.mailer = mailer
+	app.oidcClients = oidcClients(config)
+	app.passwordPolicy = passwordPolicy
+	app.passwordHasher = passwordHasher
+	app.reputationPolicy = &libreputation.Policy{
+		AcceptedPoints: config.GetInt("reputation_accepted_points"),
+		RejectedPoints: config.GetInt("reputation_rejected_points"),
+		PointsPerStar:  config.GetInt("reputation_points_per_star"),
+		Thresholds: map[libreputation.Capability]int{
+			libreputation.SkipQueue:         config.GetInt("reputation_skip_queue_threshold"),
+			libreputation.CuratorNomination: config.GetInt("reputation_curator_nomination_threshold"),
+		},
+	}
+	app.leaderboards = models.NewLeaderboardCache(db, mongodb, config.GetInt("leaderboard_size"))
+
+	punOfTheDayLocation, err := time.LoadLocation(config.GetString("pun_of_the_day_timezone"))
+	if err != nil {
+		return nil, err
+	}
+	app.punOfTheDay = models.NewPunOfTheDayScheduler(mongodb, punOfTheDayLocation)
+	app.webhookSender = libwebhook.NewSender(libwebhook.Policy{
+		MaxAttempts: config.GetInt("webhook_max_attempts"),
+		BaseDelay:   config.GetDuration("webhook_backoff"),
+		MaxDelay:    config.GetDuration("webhook_max_backoff"),
+	}, config.GetDuration("webhook_timeout"))
+	app.loginGuard = liblockout.NewGuard(
+		liblockout.Policy{
+			BackoffAfter:    config.GetInt("login_backoff_after"),
+			BaseDelay:       config.GetDuration("login_backoff_delay"),
+			LockoutAfter:    config.GetInt("login_lockout_after"),
+			LockoutDuration: config.GetDuration("login_lockout_duration"),
+		},
+		liblockout.Policy{
+			BackoffAfter:    config.GetInt("login_ip_backoff_after"),
+			BaseDelay:       config.GetDuration("login_backoff_delay"),
+			LockoutAfter:    config.GetInt("login_ip_lockout_after"),
+			LockoutDuration: config.GetDuration("login_lockout_duration"),
+		},
+	)
+
+	app.live = libsse.NewBroker(
+		config.GetInt("live_buffer_size"),
+		config.GetDuration("live_heartbeat"),
+		config.GetDuration("live_retry"),
+		config.GetInt("live_max_streams"),
+	)
+
+	app.events = libevent.NewBus()
+	app.subscribe()
+
+	go app.deleteExpiredSessions(time.Hour)
+	go app.refreshLeaderboards(config.GetDuration("leaderboard_refresh_interval"))
+	go app.choosePunsOfTheDay(config.GetDuration("pun_of_the_day_check_interval"))
+	go app.deliverWebhooks(config.GetDuration("webhook_check_interval"))
+	if !mailerDisabled {
+		go app.sendNotificationDigests(config.GetDuration("notification_digest_interval"))
+	}
 
 	return app, nil
 }
 
+// sessionSecrets returns the secrets session cookies are signed and encrypted with, current one first.
+// session_keys takes a comma separated list so keys can be rotated; cookie_secret is the single key fallback.
+// Without either a random key is generated, which logs everyone out on restart.
+func sessionSecrets(config *viper.Viper) ([]string, error) {
+	secrets := []string{}
+	for _, secret := range strings.Split(config.GetString("session_keys"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	if len(secrets) == 0 && config.GetString("cookie_secret") != "" {
+		secrets = append(secrets, config.GetString("cookie_secret"))
+	}
+
+	if len(secrets) == 0 {
+		logrus.Warnln("session_keys is not set, generating a random key. Sessions will not survive a restart.")
+
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, hex.EncodeToString(key))
+	}
+
+	return secrets, nil
+}
+
+// oidcClients creates a client for every provider named in oidc_providers, a comma separated list.
+// Each provider <name> is configured with oidc_<name>_issuer, oidc_<name>_client_id,
+// oidc_<name>_client_secret and optionally oidc_<name>_scopes.
+func oidcClients(config *viper.Viper) map[string]*liboidc.Client {
+	clients := make(map[string]*liboidc.Client)
+
+	for _, name := range strings.Split(config.GetString("oidc_providers"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "oidc_" + name + "_"
+
+		scopes := strings.Fields(config.GetString(prefix + "scopes"))
+		if len(scopes) == 0 {
+			scopes = []string{"email", "profile"}
+		}
+
+		clients[name] = liboidc.NewClient(
+			config.GetString(prefix+"issuer"),
+			config.GetString(prefix+"client_id"),
+			config.GetString(prefix+"client_secret"),
+			config.GetString("base_url")+"/login/"+name+"/callback",
+			scopes,
+		)
+	}
+
+	return clients
+}
+
+// sessionUserID tells the session store which user a session belongs to.
+func sessionUserID(values map[interface{}]interface{}) int64 {
+	userID, _ := values["userID"].(int64)
+	return userID
+}
+
+// deleteExpiredSessions periodically removes expired sessions from the session backend.
+func (app *Application) deleteExpiredSessions(interval time.Duration) {
+	for range time.Tick(interval) {
+		err := app.sessionStore.Backend.DeleteExpired(time.Now())
+		if err != nil {
+			logrus.Errorln(err)
+		}
+	}
+}
+
+// leaderboardSettle is how long to wait after the leaderboards are invalidated,
+// so a burst of ratings is covered by one refresh.
+const leaderboardSettle = 30 * time.Second
+
+// refreshLeaderboards recomputes the cached leaderboards now, then periodically or soon after they are invalidated.
+func (app *Application) refreshLeaderboards(interval time.Duration) {
+	for {
+		err := app.leaderboards.Refresh()
+		if err != nil {
+			logrus.Errorln(err)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-app.leaderboards.Invalidated():
+			time.Sleep(leaderboardSettle)
+		}
+	}
+}
+
+// choosePunsOfTheDay makes sure every day has a pun of the day soon after it starts,
+// even before anyone visits the home page.
+func (app *Application) choosePunsOfTheDay(interval time.Duration) {
+	for {
+		_, err := app.punOfTheDay.Current()
+		if err != nil && err != models.ErrNoPunOfTheDay {
+			logrus.Errorln(err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// webhookBatchSize is how many due webhook deliveries are sent per check
+const webhookBatchSize = 50
+
+// deliverWebhooks sends the due deliveries from the webhook outbox, then checks again after interval.
+func (app *Application) deliverWebhooks(interval time.Duration) {
+	webhooks := models.NewWebhook(app.db)
+
+	// A claimed delivery whose attempt never finishes is retried once its lease is up
+	lease := 2 * app.webhookSender.Client.Timeout
+
+	for {
+		now := time.Now()
+		deliveries, err := webhooks.DueDeliveries(nil, now, webhookBatchSize)
+		if err != nil {
+			logrus.Errorln(err)
+		}
+
+		failed := err != nil
+		sent := 0
+		for _, delivery := range deliveries {
+			claimed, err := webhooks.ClaimDelivery(nil, delivery, now, lease)
+			if err != nil {
+				logrus.Errorln(err)
+				failed = true
+			}
+			if !claimed {
+				continue
+			}
+			sent++
+
+			attempt := app.webhookSender.Send(libwebhook.Delivery{
+				ID:       delivery.ID,
+				URL:      delivery.URL,
+				Secret:   delivery.Secret,
+				Event:    delivery.Event,
+				Payload:  []byte(delivery.Payload),
+				Attempts: delivery.Attempts,
+			})
+			if attempt.GaveUp {
+				logrus.Warnln("Giving up on webhook delivery", delivery.ID, "to", delivery.URL, attempt.Err)
+			}
+
+			err = webhooks.RecordAttempt(nil, delivery, attempt)
+			if err != nil {
+				logrus.Errorln(err)
+			}
+		}
+
+		// Keep going without waiting while there is a backlog, unless the database is failing
+		// or other instances claimed the whole batch
+		if len(deliveries) < webhookBatchSize || failed || sent == 0 {
+			time.Sleep(interval)
+		}
+	}
+}
+
+// sendNotificationDigests periodically emails users the unread notifications they asked to get by email.
+func (app *Application) sendNotificationDigests(interval time.Duration) {
+	notifications := models.NewNotification(app.db)
+	users := models.NewUser(app.db)
+
+	for range time.Tick(interval) {
+		digests, err := notifications.PendingDigests(nil)
+		if err != nil {
+			logrus.Errorln(err)
+			continue
+		}
+
+		for userID, pending := range digests {
+			user, err := users.GetByID(nil, userID)
+			if err != nil {
+				logrus.Errorln(err)
+				continue
+			}
+
+			body := models.FormatDigest(user.Name(), pending, app.config.GetString("base_url"))
+			err = app.mailer.Send(user.Email, "Your Punocracy notifications", body)
+			if err != nil {
+				logrus.Errorln(err)
+				continue
+			}
+
+			err = notifications.MarkEmailed(nil, pending)
+			if err != nil {
+				logrus.Errorln(err)
+			}
+		}
+	}
+}
+
+// CloseLiveStreams ends the live event streams, which would otherwise keep the server from draining.
+// Call it as soon as shutting down starts.
+func (app *Application) CloseLiveStreams() {
+	app.live.Close()
+}
+
+// Close lets event subscribers finish the events already published. Call it once the server stopped taking requests.
+func (app *Application) Close() {
+	err := app.events.Close(app.config.GetDuration("event_drain_timeout"))
+	if err != nil {
+		logrus.Errorln(err)
+	}
+}
+
 // Application is the application object that runs HTTP server.
 type Application struct {
-	config       *viper.Viper
-	dsn          string
-	db           *sqlx.DB
-	mongodb      *mongo.Database
-	sessionStore sessions.Store
+	config           *viper.Viper
+	dsn              string
+	db               *sqlx.DB
+	mongodb          *mongo.Database
+	sessionStore     *libsession.Store
+	rateLimitBackend libratelimit.Backend
+	rateLimits       map[string]libratelimit.Limit
+	loginGuard       *liblockout.Guard
+	mailer           libmail.Mailer
+	oidcClients      map[string]*liboidc.Client
+	passwordPolicy   *libpassword.Policy
+	passwordHasher   *libpassword.Hasher
+	leaderboards     *models.LeaderboardCache
+	punOfTheDay      *models.PunOfTheDayScheduler
+	webhookSender    *libwebhook.Sender
+	events           *libevent.Bus
+	live             *libsse.Broker
+	reputationPolicy *libreputation.Policy
+	// queueNotified is set while curators know the queue is too long. Only the queue-notifications subscriber uses it.
+	queueNotified bool
 }
 
 func (app *Application) MiddlewareStruct() (*interpose.Middleware, error) {
 	middle := interpose.New()
+	middle.Use(middlewares.SetConfig(app.config))
 	middle.Use(middlewares.SetDB(app.db))
 	middle.Use(middlewares.SetMongo(app.mongodb))
 	middle.Use(middlewares.SetSessionStore(app.sessionStore))
+	middle.Use(middlewares.SetLoginGuard(app.loginGuard))
+	middle.Use(middlewares.SetMailer(app.mailer))
+	middle.Use(middlewares.SetOIDCClients(app.oidcClients))
+	middle.Use(middlewares.SetPasswordPolicy(app.passwordPolicy))
+	middle.Use(middlewares.SetPasswordHasher(app.passwordHasher))
+	middle.Use(middlewares.SetLeaderboards(app.leaderboards))
+	middle.Use(middlewares.SetPunOfTheDay(app.punOfTheDay))
+	middle.Use(middlewares.SetReputationPolicy(app.reputationPolicy))
+	middle.Use(middlewares.SetEvents(app.events))
+	middle.Use(middlewares.SetLive(app.live))
+	middle.Use(middlewares.LoadUser(app.sessionStore))
+	middle.Use(middlewares.RequireTwoFactor("/account/2fa", "/logout", "/api/"))
+	middle.Use(middlewares.CSRF(app.sessionStore, []byte(app.config.GetString("token_secret")), "/api/"))
 	middle.Use(middlewares.Logging())
 
 	middle.UseHandler(app.mux())
@@ -83,6 +467,11 @@ func (app *Application) MiddlewareStruct() (*interpose.Middleware, error) {
 	return middle, nil
 }
 
+// rateLimit wraps a handler with the rate limit configured under ratelimit_<name>.
+func (app *Application) rateLimit(name string, handler http.HandlerFunc) http.Handler {
+	return middlewares.RateLimit(app.rateLimitBackend, name, app.rateLimits[name])(handler)
+}
+
 func (app *Application) mux() *gorilla_mux.Router {
 	MustLogin := middlewares.MustLogin
 
@@ -92,31 +481,126 @@ func (app *Application) mux() *gorilla_mux.Router {
 	// router.NotFoundHandler = http.HandlerFunc(handlers.HandleNotFound)
 
 	router.Handle("/now", http.HandlerFunc(handlers.GetHome)).Methods("GET")
-	router.Handle("/now", http.HandlerFunc(handlers.PostHome)).Methods("POST")
+	router.Handle("/now", app.rateLimit("rating", handlers.PostHome)).Methods("POST")
 
 	router.HandleFunc("/", handlers.HandleRoot).Methods("GET", "POST", "PUT", "DELETE")
 
 	router.HandleFunc("/submit", handlers.GetSubmit).Methods("GET")
-	router.HandleFunc("/submit", handlers.PostSubmit).Methods("POST")
+	router.Handle("/submit", app.rateLimit("submit", handlers.PostSubmit)).Methods("POST")
 
 	router.HandleFunc("/history", handlers.GetHistory).Methods("GET")
-	router.HandleFunc("/history", handlers.PostHistory).Methods("POST")
+	router.Handle("/history", app.rateLimit("rating", handlers.PostHistory)).Methods("POST")
 
 	router.HandleFunc("/words/{letter}", handlers.GetWords).Methods("GET")
 
 	router.HandleFunc("/queuerater", handlers.GetCurator).Methods("GET")
 	router.HandleFunc("/queuerater", handlers.PostCurator).Methods("POST")
 
+	router.HandleFunc("/phrases/{phraseID}", handlers.GetPhrase).Methods("GET")
+	router.HandleFunc("/phrases/{phraseID}/card.png", handlers.GetPhraseCard).Methods("GET")
+	router.Handle("/phrases/{phraseID}/comments", MustLogin(app.rateLimit("comment", handlers.PostComment))).Methods("POST")
+	router.Handle("/phrases/{phraseID}/comments/{commentID}/edit", MustLogin(http.HandlerFunc(handlers.PostEditComment))).Methods("POST")
+	router.Handle("/phrases/{phraseID}/comments/{commentID}/delete", MustLogin(http.HandlerFunc(handlers.PostDeleteComment))).Methods("POST")
+	router.Handle("/phrases/{phraseID}/edit", MustLogin(http.HandlerFunc(handlers.GetEditPhrase))).Methods("GET")
+	router.Handle("/phrases/{phraseID}/edit", MustLogin(http.HandlerFunc(handlers.PostEditPhrase))).Methods("POST")
+	router.Handle("/phrases/{phraseID}/revisions", MustLogin(http.HandlerFunc(handlers.GetPhraseRevisionDiff))).Methods("GET")
+
+	router.Handle("/phrases/{phraseID}/favorite", MustLogin(http.HandlerFunc(handlers.PostFavorite))).Methods("POST")
+	router.Handle("/phrases/{phraseID}/unfavorite", MustLogin(http.HandlerFunc(handlers.PostUnfavorite))).Methods("POST")
+	router.Handle("/phrases/{phraseID}/collect", MustLogin(http.HandlerFunc(handlers.PostCollectPhrase))).Methods("POST")
+
+	router.Handle("/favorites", MustLogin(http.HandlerFunc(handlers.GetFavorites))).Methods("GET")
+	router.Handle("/favorites/export", MustLogin(http.HandlerFunc(handlers.GetFavoritesExport))).Methods("GET")
+	router.Handle("/collections", MustLogin(http.HandlerFunc(handlers.GetCollections))).Methods("GET")
+	router.Handle("/collections", MustLogin(http.HandlerFunc(handlers.PostCollections))).Methods("POST")
+	router.HandleFunc("/collections/{collectionID}", handlers.GetCollection).Methods("GET")
+	router.HandleFunc("/collections/{collectionID}/export", handlers.GetCollectionExport).Methods("GET")
+	router.Handle("/collections/{collectionID}/edit", MustLogin(http.HandlerFunc(handlers.PostEditCollection))).Methods("POST")
+	router.Handle("/collections/{collectionID}/delete", MustLogin(http.HandlerFunc(handlers.PostDeleteCollection))).Methods("POST")
+	router.Handle("/collections/{collectionID}/phrases/{phraseID}/remove", MustLogin(http.HandlerFunc(handlers.PostRemoveFromCollection))).Methods("POST")
+
+	router.HandleFunc("/pun-of-the-day", handlers.GetPunOfTheDayArchive).Methods("GET")
+	router.HandleFunc("/pun-of-the-day/{day}", handlers.GetPunOfTheDay).Methods("GET")
+	router.Handle("/queuerater/pun-of-the-day", MustLogin(http.HandlerFunc(handlers.GetPunOfTheDayCalendar))).Methods("GET")
+	router.Handle("/queuerater/pun-of-the-day", MustLogin(http.HandlerFunc(handlers.PostSchedulePunOfTheDay))).Methods("POST")
+	router.Handle("/queuerater/pun-of-the-day/unschedule", MustLogin(http.HandlerFunc(handlers.PostUnschedulePunOfTheDay))).Methods("POST")
+
+	router.HandleFunc("/feeds/new.{format:atom|rss|json}", handlers.GetNewPhrasesFeed).Methods("GET")
+	router.HandleFunc("/feeds/top.{format:atom|rss|json}", handlers.GetTopPhrasesFeed).Methods("GET")
+	router.HandleFunc("/feeds/users/{username}.{format:atom|rss|json}", handlers.GetUserFeed).Methods("GET")
+	router.HandleFunc("/feeds/words/{word}.{format:atom|rss|json}", handlers.GetWordFeed).Methods("GET")
+
+	router.HandleFunc("/events", handlers.GetLiveEvents).Methods("GET")
+
 	router.HandleFunc("/about", handlers.GetAbout).Methods("GET")
 
+	router.HandleFunc("/leaderboards", handlers.GetLeaderboards).Methods("GET")
+	router.HandleFunc("/api/leaderboards", handlers.GetAPILeaderboards).Methods("GET")
+
+	router.HandleFunc("/u/{username}", handlers.GetProfile).Methods("GET")
+	router.Handle("/u/{username}/follow", MustLogin(http.HandlerFunc(handlers.PostFollow))).Methods("POST")
+	router.Handle("/u/{username}/unfollow", MustLogin(http.HandlerFunc(handlers.PostUnfollow))).Methods("POST")
+	router.Handle("/notifications", MustLogin(http.HandlerFunc(handlers.GetNotifications))).Methods("GET")
+	router.Handle("/notifications/read-all", MustLogin(http.HandlerFunc(handlers.PostReadAllNotifications))).Methods("POST")
+	router.Handle("/notifications/preferences", MustLogin(http.HandlerFunc(handlers.PostNotificationPreferences))).Methods("POST")
+	router.Handle("/notifications/{notificationID:[0-9]+}/read", MustLogin(http.HandlerFunc(handlers.PostReadNotification))).Methods("POST")
+
+	router.Handle("/account/profile", MustLogin(http.HandlerFunc(handlers.PostProfile))).Methods("POST")
+	router.Handle("/account/reputation", MustLogin(http.HandlerFunc(handlers.GetAccountReputation))).Methods("GET")
+	router.HandleFunc("/api/users/{username}", handlers.GetAPIProfile).Methods("GET")
+
+	router.HandleFunc("/api/slash/slack", handlers.PostSlackCommand).Methods("POST")
+	router.HandleFunc("/api/slash/discord", handlers.PostDiscordInteraction).Methods("POST")
+
 	router.HandleFunc("/signup", handlers.GetSignup).Methods("GET")
-	router.HandleFunc("/signup", handlers.PostSignup).Methods("POST")
+	router.Handle("/signup", app.rateLimit("signup", handlers.PostSignup)).Methods("POST")
 
 	router.HandleFunc("/login", handlers.GetLogin).Methods("GET")
-	router.HandleFunc("/login", handlers.PostLogin).Methods("POST")
+	router.Handle("/login", app.rateLimit("login", handlers.PostLogin)).Methods("POST")
+
+	router.HandleFunc("/login/2fa", handlers.GetTwoFactorLogin).Methods("GET")
+	router.Handle("/login/2fa", app.rateLimit("login", handlers.PostTwoFactorLogin)).Methods("POST")
+
+	router.Handle("/login/{provider}", app.rateLimit("login", handlers.GetOIDCLogin)).Methods("GET")
+	router.Handle("/login/{provider}/callback", app.rateLimit("login", handlers.GetOIDCCallback)).Methods("GET")
 
 	router.HandleFunc("/logout", handlers.GetLogout).Methods("GET")
 
+	router.HandleFunc("/password/forgot", handlers.GetForgotPassword).Methods("GET")
+	router.Handle("/password/forgot", app.rateLimit("email", handlers.PostForgotPassword)).Methods("POST")
+	router.HandleFunc("/password/reset", handlers.GetResetPassword).Methods("GET")
+	router.HandleFunc("/password/reset", handlers.PostResetPassword).Methods("POST")
+
+	router.Handle("/account/sessions", MustLogin(http.HandlerFunc(handlers.GetAccountSessions))).Methods("GET")
+	router.Handle("/account/sessions/revoke", MustLogin(http.HandlerFunc(handlers.PostRevokeSession))).Methods("POST")
+	router.Handle("/account/sessions/revoke-all", MustLogin(http.HandlerFunc(handlers.PostRevokeAllSessions))).Methods("POST")
+
+	router.Handle("/account/identities", MustLogin(http.HandlerFunc(handlers.GetAccountIdentities))).Methods("GET")
+	router.Handle("/account/identities/link/{provider}", MustLogin(http.HandlerFunc(handlers.PostLinkIdentity))).Methods("POST")
+	router.Handle("/account/identities/unlink", MustLogin(http.HandlerFunc(handlers.PostUnlinkIdentity))).Methods("POST")
+
+	router.Handle("/account/2fa", MustLogin(http.HandlerFunc(handlers.GetAccountTwoFactor))).Methods("GET")
+	router.Handle("/account/2fa/qr.png", MustLogin(http.HandlerFunc(handlers.GetAccountTwoFactorQR))).Methods("GET")
+	router.Handle("/account/2fa/enable", MustLogin(http.HandlerFunc(handlers.PostEnableTwoFactor))).Methods("POST")
+	router.Handle("/account/2fa/recovery-codes", MustLogin(http.HandlerFunc(handlers.PostRegenerateRecoveryCodes))).Methods("POST")
+	router.Handle("/account/2fa/disable", MustLogin(http.HandlerFunc(handlers.PostDisableTwoFactor))).Methods("POST")
+
+	router.HandleFunc("/verify-email", handlers.GetVerifyEmail).Methods("GET")
+	router.Handle("/verify-email", MustLogin(app.rateLimit("email", handlers.PostResendVerification))).Methods("POST")
+
+	router.Handle("/admin/lockouts", MustLogin(http.HandlerFunc(handlers.GetAdminLockouts))).Methods("GET")
+	router.Handle("/admin/moderation", MustLogin(http.HandlerFunc(handlers.GetAdminModeration))).Methods("GET")
+	router.Handle("/admin/moderation", MustLogin(http.HandlerFunc(handlers.PostAdminModeration))).Methods("POST")
+	router.Handle("/admin/capabilities", MustLogin(http.HandlerFunc(handlers.GetAdminCapabilities))).Methods("GET")
+	router.Handle("/admin/capabilities", MustLogin(http.HandlerFunc(handlers.PostAdminCapabilities))).Methods("POST")
+
+	router.Handle("/admin/webhooks", MustLogin(http.HandlerFunc(handlers.GetAdminWebhooks))).Methods("GET")
+	router.Handle("/admin/webhooks", MustLogin(http.HandlerFunc(handlers.PostAdminWebhooks))).Methods("POST")
+	router.Handle("/admin/webhooks/{webhookID:[0-9]+}", MustLogin(http.HandlerFunc(handlers.GetAdminWebhook))).Methods("GET")
+	router.Handle("/admin/webhooks/{webhookID:[0-9]+}/active", MustLogin(http.HandlerFunc(handlers.PostAdminWebhookActive))).Methods("POST")
+	router.Handle("/admin/webhooks/{webhookID:[0-9]+}/delete", MustLogin(http.HandlerFunc(handlers.PostAdminWebhookDelete))).Methods("POST")
+	router.Handle("/admin/webhooks/{webhookID:[0-9]+}/deliveries/{deliveryID:[0-9]+}/redeliver", MustLogin(http.HandlerFunc(handlers.PostAdminWebhookRedeliver))).Methods("POST")
+
 	router.Handle("/users/{userID:[0-9]+}", MustLogin(http.HandlerFunc(handlers.PostPutDeleteUsersID))).Methods("POST", "PUT", "DELETE")
 
 	// Path of static files must be last!
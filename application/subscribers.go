@@ -0,0 +1,376 @@
+package application
+
+import (
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/punocracy/punocracy/handlers"
+	"github.com/punocracy/punocracy/libevent"
+	"github.com/punocracy/punocracy/models"
+)
+
+// eventQueueSize is how many events each subscriber can fall behind by before events are dropped
+const eventQueueSize = 1000
+
+// subscribe registers the side effects of domain events on the bus
+func (app *Application) subscribe() {
+	app.events.Subscribe("audit", eventQueueSize, auditEvent)
+	// Deliveries are written to the outbox before the publisher moves on, so none are lost to a full queue or shutdown
+	app.events.SubscribeSync("webhooks", app.enqueueWebhook)
+	app.events.Subscribe("reputation", eventQueueSize, app.settleReputation)
+	app.events.Subscribe("search-index", eventQueueSize, app.indexPhrase)
+	app.events.Subscribe("leaderboards", eventQueueSize, app.invalidateLeaderboards)
+	app.events.Subscribe("notifications", eventQueueSize, app.notify)
+	app.events.Subscribe("queue-notifications", eventQueueSize, app.notifyLongQueue)
+	app.events.Subscribe("live", eventQueueSize, app.publishLive)
+}
+
+// auditEvent logs who did what
+func auditEvent(event libevent.Event) {
+	switch e := event.(type) {
+	case models.PhraseSubmitted:
+		logrus.Infoln("Phrase", e.Phrase.PhraseID.Hex(), "submitted by user", e.Phrase.SubmitterUserID)
+	case models.PhraseAccepted:
+		if e.Reviewer.ID == 0 {
+			logrus.Infoln("Phrase", e.Phrase.PhraseID.Hex(), "published without review")
+		} else {
+			logrus.Infoln("Phrase", e.Phrase.PhraseID.Hex(), "accepted by", e.Reviewer.Username)
+		}
+	case models.PhraseRejected:
+		if e.Reviewer.ID == 0 {
+			logrus.Infoln("Phrase", e.Phrase.PhraseID.Hex(), "rejected by the moderator:", e.Phrase.ModerationReason)
+		} else {
+			logrus.Infoln("Phrase", e.Phrase.PhraseID.Hex(), "rejected by", e.Reviewer.Username)
+		}
+	case models.PhraseRated:
+		logrus.Infoln("Phrase", e.Phrase.PhraseID.Hex(), "rated", e.Rating, "by", e.Rater.Username)
+	case models.UserSignedUp:
+		logrus.Infoln("User", e.User.Username, "signed up")
+	case models.UserFollowed:
+		logrus.Infoln("User", e.FollowerID, "followed user", e.FolloweeID)
+	}
+}
+
+// invalidateLeaderboards refreshes the leaderboards early when rankings may have changed
+func (app *Application) invalidateLeaderboards(event libevent.Event) {
+	switch event.(type) {
+	case models.PhraseAccepted, models.PhraseRejected, models.PhraseRated:
+		app.leaderboards.Invalidate()
+	}
+}
+
+// settleReputation awards or deducts reputation from submitters when curators review their phrases
+// and when other users rate them. Phrases published without review and rejected by the moderator earn nothing.
+func (app *Application) settleReputation(event libevent.Event) {
+	switch e := event.(type) {
+	case models.PhraseAccepted:
+		if e.Reviewer.ID != 0 {
+			app.settleReview(e.Phrase, e.PreviousStatus, models.ReputationAccepted, app.reputationPolicy.Accepted(), models.Rejected, models.ReputationRejected)
+		}
+	case models.PhraseRejected:
+		if e.Reviewer.ID != 0 {
+			app.settleReview(e.Phrase, e.PreviousStatus, models.ReputationRejected, app.reputationPolicy.Rejected(), models.Accepted, models.ReputationAccepted)
+		}
+	case models.PhraseRated:
+		// Rating your own phrase earns nothing
+		if e.Phrase.DisplayPublic == models.Accepted && e.Phrase.SubmitterUserID != e.Rater.ID {
+			app.awardReputation(e.Phrase.SubmitterUserID, app.reputationPolicy.Rating(e.PreviousRating, e.Rating), models.ReputationRating, e.Phrase.PhraseID.Hex())
+		}
+	}
+}
+
+// settleReview brings the submitter's reputation for a reviewed phrase in line with its new status:
+// the total for reason becomes points and, if the phrase had been reviewed the other way, whatever was
+// awarded for reversedReason is taken back. Going by the ledger keeps a phrase that is reviewed again
+// from earning or losing points twice.
+func (app *Application) settleReview(phrase models.Phrase, previousStatus models.DisplayValue, reason string, points int, reversedStatus models.DisplayValue, reversedReason string) {
+	reputation := models.NewReputation(app.db)
+	userID := phrase.SubmitterUserID
+	phraseID := phrase.PhraseID.Hex()
+
+	if previousStatus == reversedStatus {
+		reversed, err := reputation.PhrasePoints(nil, userID, reversedReason, phraseID)
+		if err != nil {
+			logrus.Errorln(err)
+			return
+		}
+		app.awardReputation(userID, -reversed, reversedReason, phraseID)
+	}
+
+	awarded, err := reputation.PhrasePoints(nil, userID, reason, phraseID)
+	if err != nil {
+		logrus.Errorln(err)
+		return
+	}
+	app.awardReputation(userID, points-awarded, reason, phraseID)
+}
+
+// awardReputation adds points to a user's reputation and asks administrators to confirm any capability it unlocks
+func (app *Application) awardReputation(userID int64, points int, reason, phraseID string) {
+	if points == 0 {
+		return
+	}
+
+	reputation := models.NewReputation(app.db)
+
+	before, after, err := reputation.Award(nil, userID, points, reason, phraseID)
+	if err != nil {
+		logrus.Errorln(err)
+		return
+	}
+
+	for _, capability := range app.reputationPolicy.Unlocked(before, after) {
+		logrus.Infoln("User", userID, "unlocked", capability)
+
+		err = reputation.Unlock(nil, userID, capability)
+		if err != nil {
+			logrus.Errorln(err)
+		}
+	}
+}
+
+// indexPhrase brings the wordList of newly published phrases up to date, so search finds them
+// by the homophones added while they waited for a curator
+func (app *Application) indexPhrase(event libevent.Event) {
+	e, ok := event.(models.PhraseAccepted)
+	if !ok {
+		return
+	}
+
+	_, err := models.IndexPhrase(e.Phrase, models.NewWord(app.db), models.NewPhraseConnection(app.mongodb))
+	if err != nil {
+		logrus.Errorln(err)
+	}
+}
+
+// publishLive streams rating changes, newly accepted phrases and the queue length to open pages
+func (app *Application) publishLive(event libevent.Event) {
+	switch e := event.(type) {
+	case models.PhraseRated:
+		// The phrase in the event has the ratings from before
+		phrase, err := models.GetPhraseByID(e.Phrase.PhraseID, models.NewPhraseConnection(app.mongodb))
+		if err != nil {
+			logrus.Errorln(err)
+			return
+		}
+		app.live.Publish(handlers.LivePhraseTopic(phrase.PhraseID), handlers.LiveRatingMessage(phrase))
+	case models.PhraseAccepted:
+		author := "[deleted]"
+		if user, err := models.NewUser(app.db).GetByID(nil, e.Phrase.SubmitterUserID); err == nil {
+			author = user.Username
+		}
+		app.live.Publish(handlers.LiveTopicAccepted, handlers.LiveAcceptedMessage(e.Phrase, author))
+		app.publishQueueLength()
+	case models.PhraseSubmitted, models.PhraseRejected:
+		app.publishQueueLength()
+	}
+}
+
+func (app *Application) publishQueueLength() {
+	length, err := models.CountQueue(models.NewPhraseConnection(app.mongodb))
+	if err != nil {
+		logrus.Errorln(err)
+		return
+	}
+
+	app.live.Publish(handlers.LiveTopicQueue, handlers.LiveQueueMessage(length))
+}
+
+// notify tells users about what happened to them
+func (app *Application) notify(event libevent.Event) {
+	notifications := models.NewNotification(app.db)
+
+	var err error
+	switch e := event.(type) {
+	case models.PhraseAccepted:
+		// Phrases that skipped the queue were published in front of their submitter
+		if e.Reviewer.ID != 0 {
+			err = notifications.Notify(nil, e.Phrase.SubmitterUserID, models.NotificationPhraseAccepted,
+				fmt.Sprintf("Your phrase “%v” was accepted.", excerpt(e.Phrase.PhraseText)),
+				"/phrases/"+e.Phrase.PhraseID.Hex())
+		}
+	case models.PhraseRejected:
+		// Submitters see the moderator's rejections when they submit
+		if e.Reviewer.ID != 0 {
+			err = notifications.Notify(nil, e.Phrase.SubmitterUserID, models.NotificationPhraseRejected,
+				fmt.Sprintf("Your phrase “%v” was rejected by a curator.", excerpt(e.Phrase.PhraseText)),
+				"/history")
+		}
+	case models.PhraseRated:
+		if e.Rating == 5 && e.PreviousRating != 5 && e.Rater.ID != e.Phrase.SubmitterUserID {
+			err = notifications.Notify(nil, e.Phrase.SubmitterUserID, models.NotificationFiveStarRating,
+				fmt.Sprintf("%v gave your phrase “%v” 5 stars.", e.Rater.Name(), excerpt(e.Phrase.PhraseText)),
+				"/phrases/"+e.Phrase.PhraseID.Hex())
+		}
+	case models.UserFollowed:
+		var follower *models.UserRow
+		follower, err = models.NewUser(app.db).GetByID(nil, e.FollowerID)
+		// Unfollowing and following again doesn't add another notification while the first is unread
+		if err == nil {
+			err = notifications.NotifyOnce(nil, e.FolloweeID, models.NotificationNewFollower,
+				fmt.Sprintf("%v started following you.", follower.Name()),
+				"/u/"+url.PathEscape(follower.Username))
+		}
+	}
+
+	if err != nil {
+		logrus.Errorln(err)
+	}
+}
+
+// notifyLongQueue tells the curators when the queue gets longer than notification_queue_threshold.
+// They are told again only once the queue got back to the threshold and over it again.
+// The queue can grow by several phrases between two counts, so it remembers having told them rather than
+// waiting for the queue to be exactly one over.
+func (app *Application) notifyLongQueue(event libevent.Event) {
+	switch e := event.(type) {
+	case models.PhraseSubmitted:
+		if e.Phrase.DisplayPublic != models.Unreviewed {
+			return
+		}
+	case models.PhraseAccepted, models.PhraseRejected:
+		// Reviews shorten the queue, which lets the curators be told again next time
+	default:
+		return
+	}
+
+	err := app.checkQueueLength()
+	if err != nil {
+		logrus.Errorln(err)
+	}
+}
+
+// checkQueueLength counts the queue and notifies the curators if it just got over the threshold
+func (app *Application) checkQueueLength() error {
+	threshold := app.config.GetInt64("notification_queue_threshold")
+	if threshold <= 0 {
+		return nil
+	}
+
+	length, err := models.CountQueue(models.NewPhraseConnection(app.mongodb))
+	if err != nil {
+		return err
+	}
+
+	if length <= threshold {
+		app.queueNotified = false
+		return nil
+	}
+	if app.queueNotified {
+		return nil
+	}
+	app.queueNotified = true
+
+	curators, err := models.NewUser(app.db).GetCurators(nil)
+	if err != nil {
+		return err
+	}
+
+	notifications := models.NewNotification(app.db)
+	for _, curator := range curators {
+		err = notifications.Notify(nil, curator.ID, models.NotificationCuratorQueue,
+			fmt.Sprintf("%v phrases are waiting for a curator.", length),
+			"/queuerater")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// excerptLength is how many characters of a phrase notifications quote
+const excerptLength = 80
+
+// excerpt shortens a phrase to quote it in a notification
+func excerpt(text string) string {
+	if utf8.RuneCountInString(text) <= excerptLength {
+		return text
+	}
+
+	return string([]rune(text)[:excerptLength-1]) + "…"
+}
+
+// webhookPhrase is how phrases appear in webhook payloads
+type webhookPhrase struct {
+	ID        string `json:"id"`
+	Text      string `json:"text"`
+	Status    string `json:"status"`
+	Submitter string `json:"submitter"`
+	URL       string `json:"url"`
+}
+
+// webhookUser is how users appear in webhook payloads
+type webhookUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	URL      string `json:"url"`
+}
+
+// webhookRating is the payload of phrase.rated
+type webhookRating struct {
+	Phrase webhookPhrase `json:"phrase"`
+	Rater  string        `json:"rater"`
+	Rating int           `json:"rating"`
+	// PreviousRating is 0 if the rater hadn't rated the phrase before
+	PreviousRating int `json:"previousRating"`
+}
+
+var displayValueNames = map[models.DisplayValue]string{
+	models.Unreviewed: "unreviewed",
+	models.InReview:   "in_review",
+	models.Accepted:   "accepted",
+	models.Rejected:   "rejected",
+}
+
+func (app *Application) newWebhookPhrase(phrase models.Phrase) webhookPhrase {
+	submitter := "[deleted]"
+	if user, err := models.NewUser(app.db).GetByID(nil, phrase.SubmitterUserID); err == nil {
+		submitter = user.Username
+	}
+
+	return webhookPhrase{
+		ID:        phrase.PhraseID.Hex(),
+		Text:      phrase.PhraseText,
+		Status:    displayValueNames[phrase.DisplayPublic],
+		Submitter: submitter,
+		URL:       app.config.GetString("base_url") + "/phrases/" + phrase.PhraseID.Hex(),
+	}
+}
+
+// enqueueWebhook puts the event in the outbox of every webhook subscribed to it
+func (app *Application) enqueueWebhook(event libevent.Event) {
+	var data interface{}
+
+	switch e := event.(type) {
+	case models.PhraseSubmitted:
+		data = app.newWebhookPhrase(e.Phrase)
+	case models.PhraseAccepted:
+		data = app.newWebhookPhrase(e.Phrase)
+	case models.PhraseRejected:
+		data = app.newWebhookPhrase(e.Phrase)
+	case models.PhraseRated:
+		data = webhookRating{
+			Phrase:         app.newWebhookPhrase(e.Phrase),
+			Rater:          e.Rater.Username,
+			Rating:         e.Rating,
+			PreviousRating: e.PreviousRating,
+		}
+	case models.UserSignedUp:
+		data = webhookUser{
+			ID:       e.User.ID,
+			Username: e.User.Username,
+			URL:      app.config.GetString("base_url") + "/u/" + e.User.Username,
+		}
+	default:
+		return
+	}
+
+	err := models.NewWebhook(app.db).Enqueue(nil, event.EventName(), data)
+	if err != nil {
+		logrus.Errorln(err)
+	}
+}
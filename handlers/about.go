@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"html/template"
 	"net/http"
 
 	"github.com/punocracy/punocracy/libhttp"
@@ -34,7 +33,7 @@ func GetAbout(w http.ResponseWriter, r *http.Request) {
 
 	pageData := aboutPageData{CurrentUser: currentUser, IsCurator: isCurator}
 
-	tmpl, err := template.ParseFiles("templates/dashboard-nosearch.html.tmpl", "templates/about.html.tmpl")
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/about.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libmail"
+	"github.com/punocracy/punocracy/libpassword"
+	"github.com/punocracy/punocracy/libsession"
+	"github.com/punocracy/punocracy/libtoken"
+	"github.com/punocracy/punocracy/models"
+)
+
+type accountPageData struct {
+	ErrorMessage string
+	Message      string
+	Token        string
+}
+
+func renderAccount(w http.ResponseWriter, r *http.Request, templateName string, pageData accountPageData) {
+	tmpl, err := parseTemplates(r, "templates/users/users-external.html.tmpl", "templates/users/"+templateName)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// tokenSecret returns the key email tokens are signed with.
+func tokenSecret(config *viper.Viper) []byte {
+	return []byte(config.GetString("token_secret"))
+}
+
+// sendTokenEmail issues a single use token for user and mails them a link containing it.
+func sendTokenEmail(r *http.Request, user *models.UserRow, purpose, path, subject, body string, ttl time.Duration) error {
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+	mailer := r.Context().Value("mailer").(libmail.Mailer)
+
+	token, err := models.NewUserToken(db).Issue(nil, tokenSecret(config), user.ID, purpose, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := config.GetString("base_url") + path + "?token=" + url.QueryEscape(token)
+
+	return mailer.Send(user.Email, subject, fmt.Sprintf(body, user.Username, link))
+}
+
+// sendVerificationEmail mails user a link that confirms their email address.
+func sendVerificationEmail(r *http.Request, user *models.UserRow) error {
+	config := r.Context().Value("config").(*viper.Viper)
+
+	return sendTokenEmail(r, user, models.TokenVerifyEmail, "/verify-email",
+		"Verify your Punocracy email address",
+		"Hi %v,\n\nPlease confirm your email address by visiting:\n\n%v\n\nIf you did not sign up for Punocracy you can ignore this email.\n",
+		config.GetDuration("email_verification_ttl"))
+}
+
+// GetForgotPassword generates the page where users ask for a password reset link
+func GetForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	renderAccount(w, r, "forgot-password.html.tmpl", accountPageData{})
+}
+
+// PostForgotPassword mails a password reset link to the account with the given email.
+// The response is the same whether or not such an account exists, so it cannot be used to probe for accounts.
+func PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	email := r.FormValue("Email")
+
+	user, err := models.NewUser(db).GetByEmail(nil, email)
+	if err == nil && email != "" {
+		err = sendTokenEmail(r, user, models.TokenPasswordReset, "/password/reset",
+			"Reset your Punocracy password",
+			"Hi %v,\n\nSomeone asked to reset your Punocracy password. To choose a new one visit:\n\n%v\n\nIf it wasn't you, you can ignore this email.\n",
+			config.GetDuration("password_reset_ttl"))
+	}
+	if err != nil {
+		logrus.Errorln(err.Error())
+	}
+
+	renderAccount(w, r, "forgot-password.html.tmpl", accountPageData{
+		Message: "If an account with that email exists, we sent it a link to reset the password.",
+	})
+}
+
+// GetResetPassword generates the page where users choose a new password using the token they were mailed
+func GetResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	config := r.Context().Value("config").(*viper.Viper)
+
+	token := r.FormValue("token")
+
+	_, err := libtoken.Verify(tokenSecret(config), models.TokenPasswordReset, token, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAccount(w, r, "reset-password.html.tmpl", accountPageData{ErrorMessage: tokenErrorMessage(err)})
+		return
+	}
+
+	renderAccount(w, r, "reset-password.html.tmpl", accountPageData{Token: token})
+}
+
+// PostResetPassword sets the new password and uses up the token
+func PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	passwordPolicy := r.Context().Value("passwordPolicy").(*libpassword.Policy)
+	passwordHasher := r.Context().Value("passwordHasher").(*libpassword.Hasher)
+
+	token := r.FormValue("token")
+	password := r.FormValue("Password")
+	passwordAgain := r.FormValue("PasswordAgain")
+
+	// Check the passwords before consuming the token so a typo doesn't burn the link
+	if err := passwordPolicy.Check(password); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAccount(w, r, "reset-password.html.tmpl", accountPageData{Token: token, ErrorMessage: "Please choose another password: " + err.Error() + "."})
+		return
+	}
+	if password != passwordAgain {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAccount(w, r, "reset-password.html.tmpl", accountPageData{Token: token, ErrorMessage: "The passwords must match."})
+		return
+	}
+
+	userID, err := models.NewUserToken(db).Consume(nil, tokenSecret(config), models.TokenPasswordReset, token)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAccount(w, r, "reset-password.html.tmpl", accountPageData{ErrorMessage: tokenErrorMessage(err)})
+		return
+	}
+
+	_, err = models.NewUser(db).ResetPassword(nil, userID, password, passwordAgain, passwordPolicy, passwordHasher)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	// Whoever knew the old password shouldn't stay logged in
+	sessionStore := r.Context().Value("sessionStore").(*libsession.Store)
+	err = sessionStore.Backend.DeleteByUser(userID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	renderLogin(w, r, loginPageData{Message: "Your password was changed. You can now log in."})
+}
+
+// GetVerifyEmail confirms the email address of the user the token was issued to
+func GetVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	userID, err := models.NewUserToken(db).Consume(nil, tokenSecret(config), models.TokenVerifyEmail, r.FormValue("token"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAccount(w, r, "verify-email.html.tmpl", accountPageData{ErrorMessage: tokenErrorMessage(err)})
+		return
+	}
+
+	user, err := models.NewUser(db).MarkEmailVerified(nil, userID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	// The user was loaded before they were verified; later requests load them again
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	if currentUser, ok := session.Values["user"].(*models.UserRow); ok && currentUser.ID == user.ID {
+		session.Values["user"] = user
+	}
+
+	renderAccount(w, r, "verify-email.html.tmpl", accountPageData{Message: "Thanks, your email address is verified."})
+}
+
+// PostResendVerification mails the logged in user a new verification link
+func PostResendVerification(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser := session.Values["user"].(*models.UserRow)
+
+	if !currentUser.EmailVerified {
+		err := sendVerificationEmail(r, currentUser)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/submit", http.StatusFound)
+}
+
+func tokenErrorMessage(err error) string {
+	switch err {
+	case libtoken.ErrExpiredToken:
+		return "This link has expired. Please ask for a new one."
+	case libtoken.ErrInvalidToken, models.ErrTokenUsed:
+		return "This link is invalid or was already used."
+	}
+
+	logrus.Errorln(err.Error())
+	return "Something went wrong. Please try again later."
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libtokenize"
+	"github.com/punocracy/punocracy/models"
+)
+
+type moderationPageData struct {
+	CurrentUser     *models.UserRow
+	IsCurator       bool
+	ErrorMessage    string
+	Saved           bool
+	BlockedTerms    string
+	LinkScore       float64
+	FlagThreshold   float64
+	RejectThreshold float64
+}
+
+type lockoutsPageData struct {
+	CurrentUser *models.UserRow
+	IsCurator   bool
+	Lockouts    []models.LoginLockoutRow
+}
+
+// getAdmin returns the current user if they are an administrator.
+// Anyone else is redirected to the home page and nil is returned.
+func getAdmin(w http.ResponseWriter, r *http.Request) *models.UserRow {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+
+	currentUser, _ := getUser(session)
+	if currentUser == nil || currentUser.PermLevel != models.Administrator {
+		http.Redirect(w, r, "/now", http.StatusFound)
+		return nil
+	}
+
+	return currentUser
+}
+
+// GetAdminLockouts lists the most recent login lockouts for administrators
+func GetAdminLockouts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	lockouts, err := models.NewLoginLockout(db).Recent(nil, 100)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := lockoutsPageData{CurrentUser: currentUser, IsCurator: true, Lockouts: lockouts}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/admin/lockouts.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// GetAdminModeration shows the moderation rules so administrators can edit them
+func GetAdminModeration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	rules, err := models.GetModerationRules(models.NewModerationRulesConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := newModerationPageData(currentUser, rules)
+	pageData.Saved = r.URL.Query().Get("saved") != ""
+
+	renderAdminModeration(w, r, pageData)
+}
+
+// PostAdminModeration saves new moderation rules. They apply from the next submission on.
+func PostAdminModeration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	rules := models.DefaultModerationRules()
+	pageData := newModerationPageData(currentUser, rules)
+	pageData.BlockedTerms = r.FormValue("BlockedTerms")
+
+	var err error
+	rules.BlockedTerms, err = parseBlockedTerms(pageData.BlockedTerms)
+	if err == nil {
+		rules.LinkScore, err = strconv.ParseFloat(r.FormValue("LinkScore"), 64)
+	}
+	if err == nil {
+		rules.FlagThreshold, err = strconv.ParseFloat(r.FormValue("FlagThreshold"), 64)
+	}
+	if err == nil {
+		rules.RejectThreshold, err = strconv.ParseFloat(r.FormValue("RejectThreshold"), 64)
+	}
+	if err != nil {
+		pageData.ErrorMessage = err.Error()
+		renderAdminModeration(w, r, pageData)
+		return
+	}
+
+	err = models.SaveModerationRules(rules, *currentUser, models.NewModerationRulesConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	logrus.Infoln("Moderation rules updated by", currentUser.Username)
+
+	http.Redirect(w, r, "/admin/moderation?saved=1", http.StatusFound)
+}
+
+func newModerationPageData(currentUser *models.UserRow, rules models.ModerationRules) moderationPageData {
+	lines := []string{}
+	for _, blocked := range rules.BlockedTerms {
+		lines = append(lines, blocked.Term+" "+strconv.FormatFloat(blocked.Score, 'g', -1, 64))
+	}
+
+	return moderationPageData{
+		CurrentUser:     currentUser,
+		IsCurator:       true,
+		BlockedTerms:    strings.Join(lines, "\n"),
+		LinkScore:       rules.LinkScore,
+		FlagThreshold:   rules.FlagThreshold,
+		RejectThreshold: rules.RejectThreshold,
+	}
+}
+
+// parseBlockedTerms reads one blocked term per line, optionally followed by its score.
+// Terms without a score count 1.
+func parseBlockedTerms(text string) ([]models.BlockedTerm, error) {
+	terms := []models.BlockedTerm{}
+
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("blocked term line %q must be a single word and an optional score", line)
+		}
+
+		blocked := models.BlockedTerm{Term: libtokenize.Normalize(fields[0]), Score: 1}
+		if len(fields) == 2 {
+			score, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("blocked term %q has an invalid score", fields[0])
+			}
+			blocked.Score = score
+		}
+
+		terms = append(terms, blocked)
+	}
+
+	return terms, nil
+}
+
+func renderAdminModeration(w http.ResponseWriter, r *http.Request, pageData moderationPageData) {
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/admin/moderation.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
@@ -3,12 +3,41 @@ package handlers
 
 import (
 	"errors"
+	"html/template"
 	"net/http"
+	"path/filepath"
 	"strconv"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libcsrf"
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libmoderate"
+	"github.com/punocracy/punocracy/models"
 )
 
+// parseTemplates parses template files with the helpers every page can use.
+// csrfField renders the hidden CSRF token input that every form posting back to the site must include.
+// unreadNotifications counts the current user's unread notifications for the badge in the navigation bar.
+func parseTemplates(r *http.Request, filenames ...string) (*template.Template, error) {
+	token, _ := r.Context().Value("csrfToken").(string)
+
+	funcs := template.FuncMap{
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + libcsrf.FieldName + `" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+		"unreadNotifications": func() int {
+			return countUnreadNotifications(r)
+		},
+	}
+
+	return template.New(filepath.Base(filenames[0])).Funcs(funcs).ParseFiles(filenames...)
+}
+
 func getIDFromPath(w http.ResponseWriter, r *http.Request) (int64, error) {
 	idString := mux.Vars(r)["userID"]
 	if idString == "" {
@@ -22,3 +51,44 @@ func getIDFromPath(w http.ResponseWriter, r *http.Request) (int64, error) {
 
 	return id, nil
 }
+
+func getPhraseIDFromPath(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, error) {
+	idString := mux.Vars(r)["phraseID"]
+	if idString == "" {
+		return primitive.NilObjectID, errors.New("phrase id cannot be empty")
+	}
+
+	return primitive.ObjectIDFromHex(idString)
+}
+
+// getModerator builds the moderation pipeline from the rules administrators saved.
+// If they cannot be loaded the default rules are used, so submissions are never left unmoderated.
+func getModerator(r *http.Request) *libmoderate.Pipeline {
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	rules, err := models.GetModerationRules(models.NewModerationRulesConnection(mongdb))
+	if err != nil {
+		logrus.Errorln(err.Error())
+		rules = models.DefaultModerationRules()
+	}
+
+	return rules.Pipeline()
+}
+
+// renderNotFound answers with the 404 page
+func renderNotFound(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/not-found.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusNotFound)
+	tmpl.Execute(w, homePageData{CurrentUser: currentUser, IsCurator: isCurator})
+}
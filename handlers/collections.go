@@ -0,0 +1,596 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/models"
+)
+
+type collectionOption struct {
+	CollectionID string
+	Name         string
+}
+
+type collectionSummary struct {
+	CollectionID string
+	Name         string
+	Public       bool
+	NumPhrases   int
+}
+
+type collectionsPageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	Collections  []collectionSummary
+}
+
+type collectionPageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	// CollectionID is empty on the favorites page
+	CollectionID string
+	Name         string
+	Owner        string
+	Public       bool
+	IsOwner      bool
+	Phrases      []phraseDisplay
+	// Unavailable counts the saved phrases that were since rejected or deleted
+	Unavailable int
+	ExportURL   string
+	ShareURL    string
+}
+
+// exportedPhrase is how a saved phrase appears in JSON exports
+type exportedPhrase struct {
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+	Author string `json:"author"`
+	URL    string `json:"url"`
+}
+
+type exportedCollection struct {
+	Name    string           `json:"name"`
+	Owner   string           `json:"owner"`
+	Public  bool             `json:"public"`
+	Phrases []exportedPhrase `json:"phrases"`
+}
+
+// localRedirectTarget returns next if it is a path on this site, and fallback otherwise
+func localRedirectTarget(next, fallback string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.Contains(next, "\\") {
+		return fallback
+	}
+
+	return next
+}
+
+// getCollectionIDFromPath returns the collection ID in the path
+func getCollectionIDFromPath(r *http.Request) (primitive.ObjectID, error) {
+	return primitive.ObjectIDFromHex(mux.Vars(r)["collectionID"])
+}
+
+// addFavorites marks the listed phrases the current user favorited
+func addFavorites(r *http.Request, currentUser *models.UserRow, phraseList []phraseDisplay) error {
+	if currentUser == nil {
+		return nil
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	favoriteIDs, err := models.GetFavoritePhraseIDs(*currentUser, models.NewFavoritesConnection(mongdb))
+	if err != nil {
+		return err
+	}
+
+	favorites := make(map[string]bool)
+	for _, phraseID := range favoriteIDs {
+		favorites[phraseID.Hex()] = true
+	}
+
+	for i := range phraseList {
+		phraseList[i].IsFavorite = favorites[phraseList[i].PhraseID]
+	}
+
+	return nil
+}
+
+// collectionOptions returns the current user's collections for the "Add to collection" menus
+func collectionOptions(r *http.Request, currentUser *models.UserRow) ([]collectionOption, error) {
+	options := []collectionOption{}
+	if currentUser == nil {
+		return options, nil
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	collections, err := models.GetPunCollectionsByOwner(*currentUser, models.NewPunCollectionsConnection(mongdb))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, collection := range collections {
+		options = append(options, collectionOption{CollectionID: collection.CollectionID.Hex(), Name: collection.Name})
+	}
+
+	return options, nil
+}
+
+// collectedPhraseDisplays looks up the saved phrases that are still available
+func collectedPhraseDisplays(r *http.Request, phraseIDs []primitive.ObjectID) ([]phraseDisplay, int, error) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phrases, unavailable, err := models.GetCollectedPhrases(phraseIDs, models.NewPhraseConnection(mongdb))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	userTable := models.NewUser(db)
+	phraseList := []phraseDisplay{}
+	for _, phrase := range phrases {
+		author := "[deleted]"
+		if submitter, err := userTable.GetByID(nil, phrase.SubmitterUserID); err == nil {
+			author = submitter.Username
+		}
+		phraseList = append(phraseList, newPhraseDisplay(phrase, author))
+	}
+
+	return phraseList, unavailable, nil
+}
+
+// writeExport sends the phrases as a plain text or JSON download
+func writeExport(w http.ResponseWriter, r *http.Request, export exportedCollection, filename string) {
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		libhttp.WriteJson(w, http.StatusOK, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".txt"))
+	fmt.Fprintf(w, "%v\n\n", export.Name)
+	for _, phrase := range export.Phrases {
+		fmt.Fprintf(w, "%v\n  by %v, %v\n\n", phrase.Text, phrase.Author, phrase.URL)
+	}
+}
+
+func newExportedCollection(r *http.Request, name, owner string, public bool, phraseList []phraseDisplay) exportedCollection {
+	config := r.Context().Value("config").(*viper.Viper)
+
+	export := exportedCollection{Name: name, Owner: owner, Public: public, Phrases: []exportedPhrase{}}
+	for _, phrase := range phraseList {
+		export.Phrases = append(export.Phrases, exportedPhrase{
+			ID:     phrase.PhraseID,
+			Text:   phrase.PhraseText,
+			Author: phrase.Author,
+			URL:    config.GetString("base_url") + "/phrases/" + phrase.PhraseID,
+		})
+	}
+
+	return export
+}
+
+// PostFavorite saves a phrase to the current user's favorites
+func PostFavorite(w http.ResponseWriter, r *http.Request) {
+	changeFavorite(w, r, true)
+}
+
+// PostUnfavorite removes a phrase from the current user's favorites
+func PostUnfavorite(w http.ResponseWriter, r *http.Request) {
+	changeFavorite(w, r, false)
+}
+
+func changeFavorite(w http.ResponseWriter, r *http.Request, favorite bool) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	phraseID, err := getPhraseIDFromPath(w, r)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+	favoritesCollection := models.NewFavoritesConnection(mongdb)
+
+	if favorite {
+		var phrase models.Phrase
+		phrase, err = models.GetPhraseByID(phraseID, models.NewPhraseConnection(mongdb))
+		if err == mongo.ErrNoDocuments {
+			renderNotFound(w, r)
+			return
+		}
+		if err == nil {
+			err = models.AddFavorite(*currentUser, phrase, favoritesCollection)
+		}
+		if err == models.ErrNotCollectable {
+			renderPhrase(w, r, http.StatusForbidden, "Only accepted phrases can be saved.")
+			return
+		}
+	} else {
+		err = models.RemoveFavorite(*currentUser, phraseID, favoritesCollection)
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r.FormValue("next"), "/phrases/"+phraseID.Hex()), http.StatusFound)
+}
+
+// GetFavorites lists the current user's favorite phrases
+func GetFavorites(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phraseIDs, err := models.GetFavoritePhraseIDs(*currentUser, models.NewFavoritesConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	phraseList, unavailable, err := collectedPhraseDisplays(r, phraseIDs)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	for i := range phraseList {
+		phraseList[i].IsFavorite = true
+	}
+
+	pageData := collectionPageData{
+		CurrentUser: currentUser,
+		IsCurator:   isCurator,
+		Name:        "Favorites",
+		Owner:       currentUser.Username,
+		IsOwner:     true,
+		Phrases:     phraseList,
+		Unavailable: unavailable,
+		ExportURL:   "/favorites/export",
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/collection.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// GetFavoritesExport downloads the current user's favorite phrases as text, or as JSON with ?format=json
+func GetFavoritesExport(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phraseIDs, err := models.GetFavoritePhraseIDs(*currentUser, models.NewFavoritesConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	phraseList, _, err := collectedPhraseDisplays(r, phraseIDs)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	writeExport(w, r, newExportedCollection(r, "Favorites", currentUser.Username, false, phraseList), "favorites")
+}
+
+// GetCollections lists the current user's collections
+func GetCollections(w http.ResponseWriter, r *http.Request) {
+	renderCollections(w, r, http.StatusOK, "")
+}
+
+func renderCollections(w http.ResponseWriter, r *http.Request, status int, errorMessage string) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	collections, err := models.GetPunCollectionsByOwner(*currentUser, models.NewPunCollectionsConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := collectionsPageData{CurrentUser: currentUser, IsCurator: isCurator, ErrorMessage: errorMessage, Collections: []collectionSummary{}}
+	for _, collection := range collections {
+		pageData.Collections = append(pageData.Collections, collectionSummary{
+			CollectionID: collection.CollectionID.Hex(),
+			Name:         collection.Name,
+			Public:       collection.Public,
+			NumPhrases:   len(collection.PhraseIDs),
+		})
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/collections.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	tmpl.Execute(w, pageData)
+}
+
+// collectionErrorMessage explains why a collection change was refused, or returns "" for unexpected errors
+func collectionErrorMessage(err error) string {
+	switch err {
+	case models.ErrEmptyCollectionName:
+		return "Your collection needs a name."
+	case models.ErrCollectionNameTooLong:
+		return fmt.Sprintf("Collection names can be at most %v characters.", models.MaxCollectionNameLength)
+	case models.ErrNotCollectable:
+		return "Only accepted phrases can be saved."
+	}
+
+	return ""
+}
+
+// PostCollections creates a collection
+func PostCollections(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	collection, err := models.CreatePunCollection(*currentUser, r.FormValue("name"), r.FormValue("public") == "on", models.NewPunCollectionsConnection(mongdb))
+	if message := collectionErrorMessage(err); message != "" {
+		renderCollections(w, r, http.StatusBadRequest, message)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/collections/"+collection.CollectionID.Hex(), http.StatusFound)
+}
+
+// getVisibleCollection returns the collection in the path if it is public or owned by the current user
+func getVisibleCollection(r *http.Request, currentUser *models.UserRow) (models.PunCollection, error) {
+	collectionID, err := getCollectionIDFromPath(r)
+	if err != nil {
+		return models.PunCollection{}, models.ErrCollectionNotFound
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	collection, err := models.GetPunCollection(collectionID, models.NewPunCollectionsConnection(mongdb))
+	if err != nil {
+		return collection, err
+	}
+
+	if !collection.Public && (currentUser == nil || currentUser.ID != collection.OwnerUserID) {
+		return collection, models.ErrCollectionNotFound
+	}
+
+	return collection, nil
+}
+
+// collectionOwnerName returns the username of the collection's owner
+func collectionOwnerName(r *http.Request, collection models.PunCollection) string {
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	owner, err := models.NewUser(db).GetByID(nil, collection.OwnerUserID)
+	if err != nil {
+		return "[deleted]"
+	}
+
+	return owner.Username
+}
+
+// GetCollection shows a collection. Private collections are only shown to their owner.
+func GetCollection(w http.ResponseWriter, r *http.Request) {
+	renderCollection(w, r, http.StatusOK, "")
+}
+
+func renderCollection(w http.ResponseWriter, r *http.Request, status int, errorMessage string) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	collection, err := getVisibleCollection(r, currentUser)
+	if err == models.ErrCollectionNotFound {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	phraseList, unavailable, err := collectedPhraseDisplays(r, collection.PhraseIDs)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	err = addFavorites(r, currentUser, phraseList)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	config := r.Context().Value("config").(*viper.Viper)
+
+	path := "/collections/" + collection.CollectionID.Hex()
+
+	pageData := collectionPageData{
+		CurrentUser:  currentUser,
+		IsCurator:    isCurator,
+		ErrorMessage: errorMessage,
+		CollectionID: collection.CollectionID.Hex(),
+		Name:         collection.Name,
+		Owner:        collectionOwnerName(r, collection),
+		Public:       collection.Public,
+		IsOwner:      currentUser != nil && currentUser.ID == collection.OwnerUserID,
+		Phrases:      phraseList,
+		Unavailable:  unavailable,
+		ExportURL:    path + "/export",
+		ShareURL:     config.GetString("base_url") + path,
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/collection.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	tmpl.Execute(w, pageData)
+}
+
+// GetCollectionExport downloads a collection as text, or as JSON with ?format=json
+func GetCollectionExport(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	collection, err := getVisibleCollection(r, currentUser)
+	if err == models.ErrCollectionNotFound {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	phraseList, _, err := collectedPhraseDisplays(r, collection.PhraseIDs)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	writeExport(w, r, newExportedCollection(r, collection.Name, collectionOwnerName(r, collection), collection.Public, phraseList), "collection-"+collection.CollectionID.Hex())
+}
+
+// PostEditCollection renames one of the current user's collections and sets whether it is public
+func PostEditCollection(w http.ResponseWriter, r *http.Request) {
+	changeCollection(w, r, func(collectionID primitive.ObjectID, currentUser models.UserRow, collections *mongo.Collection) (string, error) {
+		err := models.UpdatePunCollection(collectionID, currentUser, r.FormValue("name"), r.FormValue("public") == "on", collections)
+		return "/collections/" + collectionID.Hex(), err
+	})
+}
+
+// PostDeleteCollection deletes one of the current user's collections
+func PostDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	changeCollection(w, r, func(collectionID primitive.ObjectID, currentUser models.UserRow, collections *mongo.Collection) (string, error) {
+		return "/collections", models.DeletePunCollection(collectionID, currentUser, collections)
+	})
+}
+
+// PostRemoveFromCollection removes a phrase from one of the current user's collections
+func PostRemoveFromCollection(w http.ResponseWriter, r *http.Request) {
+	changeCollection(w, r, func(collectionID primitive.ObjectID, currentUser models.UserRow, collections *mongo.Collection) (string, error) {
+		phraseID, err := getPhraseIDFromPath(w, r)
+		if err != nil {
+			return "", models.ErrCollectionNotFound
+		}
+
+		return "/collections/" + collectionID.Hex(), models.RemoveFromPunCollection(collectionID, currentUser, phraseID, collections)
+	})
+}
+
+// PostCollectPhrase adds a phrase to the current user's collection chosen in the form
+func PostCollectPhrase(w http.ResponseWriter, r *http.Request) {
+	changeCollection(w, r, func(collectionID primitive.ObjectID, currentUser models.UserRow, collections *mongo.Collection) (string, error) {
+		phraseID, err := getPhraseIDFromPath(w, r)
+		if err != nil {
+			return "", err
+		}
+
+		mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+		phrase, err := models.GetPhraseByID(phraseID, models.NewPhraseConnection(mongdb))
+		if err == mongo.ErrNoDocuments {
+			return "", models.ErrNotCollectable
+		}
+		if err != nil {
+			return "", err
+		}
+
+		err = models.AddToPunCollection(collectionID, currentUser, phrase, collections)
+		return localRedirectTarget(r.FormValue("next"), "/phrases/"+phraseID.Hex()), err
+	})
+}
+
+// changeCollection applies change to the collection named by the collectionID path variable or form value,
+// then redirects to the page change returns.
+func changeCollection(w http.ResponseWriter, r *http.Request, change func(collectionID primitive.ObjectID, currentUser models.UserRow, collections *mongo.Collection) (string, error)) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	idString := mux.Vars(r)["collectionID"]
+	if idString == "" {
+		idString = r.FormValue("collectionID")
+	}
+
+	collectionID, err := primitive.ObjectIDFromHex(idString)
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	next, err := change(collectionID, *currentUser, models.NewPunCollectionsConnection(mongdb))
+	if err == models.ErrCollectionNotFound {
+		renderNotFound(w, r)
+		return
+	}
+	if message := collectionErrorMessage(err); message != "" {
+		// Phrases are added to collections from the phrase listings, everything else from the collection page
+		if mux.Vars(r)["collectionID"] == "" {
+			renderPhrase(w, r, http.StatusBadRequest, message)
+		} else {
+			renderCollection(w, r, http.StatusBadRequest, message)
+		}
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, next, http.StatusFound)
+}
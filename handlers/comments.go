@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/models"
+)
+
+// maxCommentIndent caps how far replies are indented, so deep threads stay readable
+const maxCommentIndent = 5
+
+type commentDisplay struct {
+	CommentID string
+	Author    string
+	Text      string
+	CreatedAt string
+	Edited    bool
+	Deleted   bool
+	// Removed is set when a curator rather than the author deleted the comment
+	Removed   bool
+	Indent    int
+	CanEdit   bool
+	CanDelete bool
+}
+
+func newCommentDisplays(comments []models.Comment, currentUser *models.UserRow, userTable *models.User) []commentDisplay {
+	displays := []commentDisplay{}
+
+	for _, comment := range models.ThreadComments(comments) {
+		author, err := userTable.GetByID(nil, comment.AuthorUserID)
+		authorName := "[deleted]"
+		if err == nil {
+			authorName = author.Username
+		}
+
+		indent := comment.Depth
+		if indent > maxCommentIndent {
+			indent = maxCommentIndent
+		}
+
+		isAuthor := currentUser != nil && currentUser.ID == comment.AuthorUserID
+
+		displays = append(displays, commentDisplay{
+			CommentID: comment.CommentID.Hex(),
+			Author:    authorName,
+			Text:      comment.Text,
+			CreatedAt: comment.CreatedAt.Format("2006-01-02 15:04"),
+			Edited:    !comment.EditedAt.IsZero(),
+			Deleted:   comment.Deleted,
+			Removed:   comment.RemovedBy != 0,
+			Indent:    indent,
+			CanEdit:   isAuthor && !comment.Deleted,
+			CanDelete: !comment.Deleted && (isAuthor || currentUser != nil && currentUser.PermLevel <= models.Curator),
+		})
+	}
+
+	return displays
+}
+
+// getCommentIDFromPath returns the comment ID in the path
+func getCommentIDFromPath(r *http.Request) (primitive.ObjectID, error) {
+	return primitive.ObjectIDFromHex(mux.Vars(r)["commentID"])
+}
+
+// addCommentCounts fills in the number of comments on each listed phrase
+func addCommentCounts(r *http.Request, phraseList []phraseDisplay) error {
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phraseIDs := []primitive.ObjectID{}
+	for _, phrase := range phraseList {
+		phraseID, err := primitive.ObjectIDFromHex(phrase.PhraseID)
+		if err == nil {
+			phraseIDs = append(phraseIDs, phraseID)
+		}
+	}
+
+	counts, err := models.CountComments(phraseIDs, models.NewCommentsConnection(mongdb))
+	if err != nil {
+		return err
+	}
+
+	for i := range phraseList {
+		phraseID, _ := primitive.ObjectIDFromHex(phraseList[i].PhraseID)
+		phraseList[i].CommentCount = counts[phraseID]
+	}
+
+	return nil
+}
+
+// PostComment adds a comment, or a reply if a parent comment is given
+func PostComment(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	phraseID, err := getPhraseIDFromPath(w, r)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phrase, err := models.GetPhraseByID(phraseID, models.NewPhraseConnection(mongdb))
+	if err == mongo.ErrNoDocuments {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	parentID := primitive.NilObjectID
+	if parent := r.FormValue("parentID"); parent != "" {
+		parentID, err = primitive.ObjectIDFromHex(parent)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+	}
+
+	comment, err := models.AddComment(phrase, parentID, *currentUser, r.FormValue("text"), models.NewCommentsConnection(mongdb))
+	if err != nil {
+		renderCommentError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/phrases/"+phraseID.Hex()+"#comment-"+comment.CommentID.Hex(), http.StatusFound)
+}
+
+// PostEditComment replaces the text of one of the current user's comments
+func PostEditComment(w http.ResponseWriter, r *http.Request) {
+	changeComment(w, r, func(phraseID, commentID primitive.ObjectID, currentUser models.UserRow, comments *mongo.Collection) error {
+		return models.EditComment(phraseID, commentID, currentUser, r.FormValue("text"), comments)
+	})
+}
+
+// PostDeleteComment deletes one of the current user's comments, or any comment for curators
+func PostDeleteComment(w http.ResponseWriter, r *http.Request) {
+	changeComment(w, r, func(phraseID, commentID primitive.ObjectID, currentUser models.UserRow, comments *mongo.Collection) error {
+		return models.DeleteComment(phraseID, commentID, currentUser, comments)
+	})
+}
+
+func changeComment(w http.ResponseWriter, r *http.Request, change func(phraseID, commentID primitive.ObjectID, currentUser models.UserRow, comments *mongo.Collection) error) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	phraseID, err := getPhraseIDFromPath(w, r)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	commentID, err := getCommentIDFromPath(r)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	err = change(phraseID, commentID, *currentUser, models.NewCommentsConnection(mongdb))
+	if err != nil {
+		renderCommentError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/phrases/"+phraseID.Hex()+"#comment-"+commentID.Hex(), http.StatusFound)
+}
+
+// renderCommentError shows the phrase page again with a message explaining why the comment was refused
+func renderCommentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case models.ErrEmptyComment:
+		renderPhrase(w, r, http.StatusBadRequest, "Your comment can't be blank.")
+	case models.ErrCommentTooLong:
+		renderPhrase(w, r, http.StatusBadRequest, "Your comment can be at most 1000 characters.")
+	case models.ErrCommentsClosed:
+		renderPhrase(w, r, http.StatusForbidden, "Only accepted phrases can be commented on.")
+	case models.ErrCommentNotAllowed:
+		renderPhrase(w, r, http.StatusForbidden, "You can't change that comment.")
+	case models.ErrCommentNotFound:
+		renderNotFound(w, r)
+	default:
+		libhttp.HandleErrorJson(w, err)
+	}
+}
@@ -1,11 +1,12 @@
 package handlers
 
 import (
-	"html/template"
 	"net/http"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/punocracy/punocracy/libevent"
 	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libmoderate"
 	"github.com/punocracy/punocracy/models"
 	"github.com/go-playground/form"
 	"github.com/gorilla/sessions"
@@ -19,8 +20,21 @@ type curatorPageData struct {
 }
 
 type curatePhrase struct {
-	PhraseID   string
-	PhraseText string
+	PhraseID         string
+	PhraseText       string
+	IsFlagged        bool
+	ModerationReason string
+	Highlighted      []libmoderate.Segment
+}
+
+func newCuratePhrase(phrase models.Phrase) curatePhrase {
+	return curatePhrase{
+		PhraseID:         phrase.PhraseID.Hex(),
+		PhraseText:       phrase.PhraseText,
+		IsFlagged:        len(phrase.FlaggedTerms) > 0,
+		ModerationReason: phrase.ModerationReason,
+		Highlighted:      libmoderate.HighlightTerms(phrase.PhraseText, phrase.FlaggedTerms),
+	}
 }
 
 // TestData I was testing the "github.com/go-playground/form" library. This helped with parsing array/struct/map like input from html forms
@@ -63,12 +77,12 @@ func GetCurator(w http.ResponseWriter, r *http.Request) {
 	pagePhrases := []curatePhrase{}
 
 	for _, v := range phrases {
-		pagePhrases = append(pagePhrases, curatePhrase{v.PhraseID.Hex(), v.PhraseText})
+		pagePhrases = append(pagePhrases, newCuratePhrase(v))
 	}
 
 	data := curatorPageData{CurrentUser: currentUser, IsCurator: isCurator, Phrases: pagePhrases}
 
-	tmpl, err := template.ParseFiles("templates/dashboard-nosearch.html.tmpl", "templates/curator.html.tmpl")
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/curator.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
@@ -109,13 +123,7 @@ func PostCurator(w http.ResponseWriter, r *http.Request) {
 
 	// TODO: Update DB based on the status of each of the reviewed phrases
 	for k, v := range res.Status {
-		if v == "accept" {
-			logrus.Infoln(k, "was", v)
-			models.AcceptPhrase(k, *currentUser, phrasesCollection)
-		} else if v == "reject" {
-			logrus.Infoln(k, "was", v)
-			models.RejectPhrase(k, *currentUser, phrasesCollection)
-		}
+		reviewPhrase(r, k, v, *currentUser, phrasesCollection)
 	}
 
 	// TODO: Load more phrases from DB to put on the view
@@ -124,12 +132,12 @@ func PostCurator(w http.ResponseWriter, r *http.Request) {
 	pagePhrases := []curatePhrase{}
 
 	for _, v := range phrases {
-		pagePhrases = append(pagePhrases, curatePhrase{v.PhraseID.Hex(), v.PhraseText})
+		pagePhrases = append(pagePhrases, newCuratePhrase(v))
 	}
 
 	data := curatorPageData{CurrentUser: currentUser, IsCurator: isCurator, Phrases: pagePhrases}
 
-	tmpl, err := template.ParseFiles("templates/dashboard-nosearch.html.tmpl", "templates/curator.html.tmpl")
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/curator.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
@@ -137,3 +145,19 @@ func PostCurator(w http.ResponseWriter, r *http.Request) {
 
 	tmpl.Execute(w, data)
 }
+
+// reviewPhrase accepts or rejects a phrase.
+// The reputation subscriber awards or deducts reputation from its submitter when the status changes.
+func reviewPhrase(r *http.Request, phraseIDString, status string, currentUser models.UserRow, phrasesCollection *mongo.Collection) {
+	events := r.Context().Value("events").(*libevent.Bus)
+
+	var err error
+	if status == "accept" {
+		_, err = models.AcceptPhrase(phraseIDString, currentUser, events, phrasesCollection)
+	} else if status == "reject" {
+		_, err = models.RejectPhrase(phraseIDString, currentUser, events, phrasesCollection)
+	}
+	if err != nil {
+		logrus.Errorln(err)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libfeed"
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/models"
+)
+
+// syndicationLimit is how many phrases a feed carries
+const syndicationLimit = 50
+
+// tagURI returns a permanent ID for something on this site (RFC 4151), so feed
+// readers don't show items again if base_url changes scheme or path.
+func tagURI(config *viper.Viper, path string) string {
+	host := "localhost"
+	if base, err := url.Parse(config.GetString("base_url")); err == nil && base.Hostname() != "" {
+		host = base.Hostname()
+	}
+
+	return "tag:" + host + ",2019:" + path
+}
+
+// phraseFeedItems turns phrases into feed items
+func phraseFeedItems(r *http.Request, phrases []models.Phrase) []libfeed.Item {
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+	userTable := models.NewUser(db)
+
+	items := []libfeed.Item{}
+	for _, phrase := range phrases {
+		author := "[deleted]"
+		if submitter, err := userTable.GetByID(nil, phrase.SubmitterUserID); err == nil {
+			author = submitter.Username
+		}
+
+		// Phrases become public when they are accepted, which is after they were submitted
+		updated := phrase.ReviewDate
+		if updated.Before(phrase.SubmissionDate) {
+			updated = phrase.SubmissionDate
+		}
+
+		items = append(items, libfeed.Item{
+			ID:        tagURI(config, "phrases/"+phrase.PhraseID.Hex()),
+			Title:     phrase.PhraseText,
+			Link:      config.GetString("base_url") + "/phrases/" + phrase.PhraseID.Hex(),
+			Author:    author,
+			Content:   phrase.PhraseText,
+			Published: phrase.SubmissionDate,
+			Updated:   updated,
+		})
+	}
+
+	return items
+}
+
+// serveFeed sends the feed in the format named by the path
+func serveFeed(w http.ResponseWriter, r *http.Request, feed *libfeed.Feed) {
+	config := r.Context().Value("config").(*viper.Viper)
+
+	format := libfeed.Format(mux.Vars(r)["format"])
+	feed.ID = tagURI(config, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "."+string(format)))
+
+	err := libfeed.Serve(w, r, feed, format, config.GetString("base_url")+r.URL.Path)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+	}
+}
+
+// GetNewPhrasesFeed syndicates the most recently accepted phrases
+func GetNewPhrasesFeed(w http.ResponseWriter, r *http.Request) {
+	config := r.Context().Value("config").(*viper.Viper)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phrases, err := models.GetRecentlyAcceptedPhrases(syndicationLimit, models.NewPhraseConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	serveFeed(w, r, &libfeed.Feed{
+		Title:       "Punocracy: New Puns",
+		Description: "Phrases accepted by our curators, newest first",
+		Link:        config.GetString("base_url") + "/now",
+		Items:       phraseFeedItems(r, phrases),
+	})
+}
+
+// GetTopPhrasesFeed syndicates the best rated phrases
+func GetTopPhrasesFeed(w http.ResponseWriter, r *http.Request) {
+	config := r.Context().Value("config").(*viper.Viper)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phrases, err := models.GetTopPhrases(syndicationLimit, models.NewPhraseConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	serveFeed(w, r, &libfeed.Feed{
+		Title:       "Punocracy: Top Puns",
+		Description: "The best rated phrases",
+		Link:        config.GetString("base_url") + "/now",
+		Items:       phraseFeedItems(r, phrases),
+		Ranked:      true,
+	})
+}
+
+// GetUserFeed syndicates a user's accepted phrases
+func GetUserFeed(w http.ResponseWriter, r *http.Request) {
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	user, err := models.NewUser(db).GetByUsername(nil, mux.Vars(r)["username"])
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	phrases, err := models.GetAcceptedPhrasesByUser(*user, syndicationLimit, models.NewPhraseConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	serveFeed(w, r, &libfeed.Feed{
+		Title:       "Punocracy: Puns by " + user.Name(),
+		Description: "Phrases submitted by " + user.Username,
+		Link:        config.GetString("base_url") + "/u/" + url.PathEscape(user.Username),
+		Items:       phraseFeedItems(r, phrases),
+	})
+}
+
+// GetWordFeed syndicates the phrases that make puns on a word, like the search results for it
+func GetWordFeed(w http.ResponseWriter, r *http.Request) {
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	word := strings.ToLower(mux.Vars(r)["word"])
+
+	phrases := []models.Phrase{}
+
+	// QueryHlistString errors when the word has no homophones, in which case the feed is empty
+	homophones, err := models.NewWord(db).QueryHlistString(nil, word)
+	if err == nil {
+		phrases, err = models.GetPhraseList(homophones, models.NewPhraseConnection(mongdb))
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+	}
+
+	sort.SliceStable(phrases, func(i, j int) bool {
+		return phrases[i].ReviewDate.After(phrases[j].ReviewDate)
+	})
+	if len(phrases) > syndicationLimit {
+		phrases = phrases[:syndicationLimit]
+	}
+
+	serveFeed(w, r, &libfeed.Feed{
+		Title:       "Punocracy: Puns on " + word,
+		Description: "Phrases that make puns on " + word,
+		Link:        config.GetString("base_url") + "/now",
+		Items:       phraseFeedItems(r, phrases),
+	})
+}
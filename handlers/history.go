@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"html/template"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -19,10 +19,14 @@ type historyPageData struct {
 	CurrentUser      *models.UserRow
 	IsCurator        bool
 	RatedPhrases     []ratedPhraseDisplay
-	SubmittedPhrases []string
+	SubmittedPhrases []submittedPhraseDisplay
 }
 
 type submittedPhraseDisplay struct {
+	PhraseID            string
+	PhraseText          string
+	TimeSinceSubmission string
+	CanEdit             bool
 }
 
 type ratedPhraseDisplay struct {
@@ -36,6 +40,33 @@ type ratedPhraseDisplay struct {
 	IsFiveStar          bool
 }
 
+// timeAgo describes how long ago something happened in the largest whole unit, like "3 days ago"
+func timeAgo(elapsed time.Duration) string {
+	day := 24 * time.Hour
+
+	units := []struct {
+		name   string
+		length time.Duration
+	}{
+		{"year", 365 * day},
+		{"month", 30 * day},
+		{"day", day},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		count := int(elapsed / unit.length)
+		if count == 1 {
+			return "1 " + unit.name + " ago"
+		}
+		if count > 1 {
+			return fmt.Sprintf("%v %vs ago", count, unit.name)
+		}
+	}
+
+	return "just now"
+}
+
 // GetHistory generates a page showing the users' history of phrase ratings and phrase submissions
 func GetHistory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
@@ -63,7 +94,7 @@ func GetHistory(w http.ResponseWriter, r *http.Request) {
 		ratedPhrases = append(ratedPhrases, ratedPhraseDisplay{
 			PhraseID:            rating.PhraseID.Hex(),
 			PhraseText:          phrase.PhraseText,
-			TimeSinceSubmission: timeSinceRating.String(),
+			TimeSinceSubmission: timeAgo(timeSinceRating),
 			IsOneStar:           rating.RatingValue == 1,
 			IsTwoStar:           rating.RatingValue == 2,
 			IsThreeStar:         rating.RatingValue == 3,
@@ -77,15 +108,20 @@ func GetHistory(w http.ResponseWriter, r *http.Request) {
 		logrus.Error(err.Error())
 	}
 
-	submittedPhrases := []string{}
+	submittedPhrases := []submittedPhraseDisplay{}
 
 	for _, phrase := range phrases {
-		submittedPhrases = append(submittedPhrases, phrase.PhraseText)
+		submittedPhrases = append(submittedPhrases, submittedPhraseDisplay{
+			PhraseID:            phrase.PhraseID.Hex(),
+			PhraseText:          phrase.PhraseText,
+			TimeSinceSubmission: timeAgo(time.Now().Sub(phrase.SubmissionDate)),
+			CanEdit:             models.CanEditPhrase(*currentUser, phrase),
+		})
 	}
 
 	pageData := historyPageData{CurrentUser: currentUser, IsCurator: isCurator, RatedPhrases: ratedPhrases, SubmittedPhrases: submittedPhrases}
 
-	tmpl, err := template.ParseFiles("templates/dashboard-nosearch.html.tmpl", "templates/history.html.tmpl")
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/history.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
@@ -121,7 +157,10 @@ func PostHistory(w http.ResponseWriter, r *http.Request) {
 		rating, _ := strconv.Atoi(v)
 
 		phr, _ := models.GetPhraseByID(phrID, phrasesCollection)
-		models.AddOrChangeRating(*currentUser, rating, phr, phrasesCollection, ratingsCollection)
+		err := ratePhrase(r, currentUser, rating, phr, phrasesCollection, ratingsCollection)
+		if err != nil {
+			logrus.Errorln(err)
+		}
 	}
 
 	http.Redirect(w, r, "/history", 302)
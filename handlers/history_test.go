@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeAgo(t *testing.T) {
+	day := 24 * time.Hour
+
+	tests := []struct {
+		elapsed  time.Duration
+		expected string
+	}{
+		{-time.Minute, "just now"},
+		{0, "just now"},
+		{59 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{45*time.Minute + 30*time.Second, "45 minutes ago"},
+		{time.Hour, "1 hour ago"},
+		{73*time.Hour + 12*time.Minute + 4500*time.Millisecond, "3 days ago"},
+		{day, "1 day ago"},
+		{29 * day, "29 days ago"},
+		{45 * day, "1 month ago"},
+		{364 * day, "12 months ago"},
+		{365 * day, "1 year ago"},
+		{3 * 365 * day, "3 years ago"},
+	}
+
+	for _, test := range tests {
+		if received := timeAgo(test.elapsed); received != test.expected {
+			t.Errorf("timeAgo(%v) should be %q. Received: %q", test.elapsed, test.expected, received)
+		}
+	}
+}
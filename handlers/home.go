@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"html/template"
 	"math"
 	"net/http"
 	"strconv"
@@ -25,8 +24,16 @@ type homePageData struct {
 	IsCurator   bool
 	Words       []string
 	Phrases     []phraseDisplay
+	// Following is set on the tab with phrases from followed users
+	Following bool
+	// Collections are the current user's collections, offered for saving phrases to
+	Collections []collectionOption
+	PunOfTheDay *punOfTheDayDisplay
 }
 
+// feedLimit is how many phrases the Following tab shows
+const feedLimit = 30
+
 type phraseDisplay struct {
 	PhraseID            string
 	PhraseText          string
@@ -37,6 +44,9 @@ type phraseDisplay struct {
 	IsThreeStar         bool
 	IsFourStar          bool
 	IsFiveStar          bool
+	RatingCount         int
+	CommentCount        int
+	IsFavorite          bool
 }
 
 type resultPageData struct {
@@ -47,6 +57,7 @@ type resultPageData struct {
 	NoWords     bool
 	Puns        []string
 	Phrases     []phraseDisplay
+	Collections []collectionOption
 }
 
 type phraseRatings struct {
@@ -122,7 +133,7 @@ func GetHome(w http.ResponseWriter, r *http.Request) {
 	phraseList = append(phraseList, phraseDisplay{
 		PhraseText:          samplephrase.PhraseText,
 		Author:              sampleUser.Username,
-		TimeSinceSubmission: sampleTime.String(),
+		TimeSinceSubmission: timeAgo(sampleTime),
 		IsOneStar:           avgRating == 1,
 		IsTwoStar:           avgRating == 2,
 		IsThreeStar:         avgRating == 3,
@@ -132,7 +143,36 @@ func GetHome(w http.ResponseWriter, r *http.Request) {
 
 	pageData := homePageData{CurrentUser: currentUser, IsCurator: isCurator, Words: words, Phrases: phraseList}
 
-	tmpl, err := template.ParseFiles("templates/dashboard.html.tmpl", "templates/search.html.tmpl", "templates/home.html.tmpl")
+	if currentUser != nil && r.FormValue("tab") == "following" {
+		feed, err := followingFeed(r, currentUser)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+
+		pageData.Phrases = feed
+		pageData.Following = true
+	}
+
+	err := addFavorites(r, currentUser, pageData.Phrases)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData.Collections, err = collectionOptions(r, currentUser)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData.PunOfTheDay, err = currentPunOfTheDay(r)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard.html.tmpl", "templates/search.html.tmpl", "templates/home.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
@@ -159,7 +199,6 @@ func PostHome(w http.ResponseWriter, r *http.Request) {
 		decoder := form.NewDecoder()
 		var ratings phraseRatings
 		decoder.Decode(&ratings, r.Form)
-		logrus.Infoln(ratings)
 
 		mongdb := r.Context().Value("mongodb").(*mongo.Database)
 		phrasesCollection := models.NewPhraseConnection(mongdb)
@@ -170,7 +209,10 @@ func PostHome(w http.ResponseWriter, r *http.Request) {
 			rating, _ := strconv.Atoi(v)
 
 			phr, _ := models.GetPhraseByID(phrID, phrasesCollection)
-			models.AddOrChangeRating(*currentUser, rating, phr, phrasesCollection, ratingsCollection)
+			err := ratePhrase(r, currentUser, rating, phr, phrasesCollection, ratingsCollection)
+			if err != nil {
+				logrus.Errorln(err)
+			}
 		}
 
 		http.Redirect(w, r, "/now", 302)
@@ -205,25 +247,24 @@ func PostHome(w http.ResponseWriter, r *http.Request) {
 
 		for _, phrase := range phrases {
 			submitter, _ := userTable.GetByID(nil, phrase.SubmitterUserID)
-			now := time.Now()
-			timeSinceSubmission := now.Sub(phrase.SubmissionDate)
-			avgRating := math.Round(models.AverageRating(phrase.PhraseRatings))
-
-			phraseList = append(phraseList, phraseDisplay{
-				PhraseID:            phrase.PhraseID.Hex(),
-				PhraseText:          phrase.PhraseText,
-				Author:              submitter.Username,
-				TimeSinceSubmission: timeSinceSubmission.String(),
-				IsOneStar:           avgRating == 1,
-				IsTwoStar:           avgRating == 2,
-				IsThreeStar:         avgRating == 3,
-				IsFourStar:          avgRating == 4,
-				IsFiveStar:          avgRating == 5,
-			})
+			phraseList = append(phraseList, newPhraseDisplay(phrase, submitter.Username))
 		}
-		pageData := resultPageData{CurrentUser: currentUser, QueryWord: queryWord, IsCurator: isCurator, NoPhrases: noPhrases, NoWords: noWords, Puns: puns, Phrases: phraseList}
+		if err := addCommentCounts(r, phraseList); err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+		if err := addFavorites(r, currentUser, phraseList); err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+		collections, err := collectionOptions(r, currentUser)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+		pageData := resultPageData{CurrentUser: currentUser, QueryWord: queryWord, IsCurator: isCurator, NoPhrases: noPhrases, NoWords: noWords, Puns: puns, Phrases: phraseList, Collections: collections}
 
-		tmpl, err := template.ParseFiles("templates/dashboard.html.tmpl", "templates/search.html.tmpl", "templates/query.html.tmpl")
+		tmpl, err := parseTemplates(r, "templates/dashboard.html.tmpl", "templates/search.html.tmpl", "templates/query.html.tmpl")
 		if err != nil {
 			libhttp.HandleErrorJson(w, err)
 			return
@@ -234,6 +275,55 @@ func PostHome(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// followingFeed returns the recently accepted phrases of the users the current user follows
+func followingFeed(r *http.Request, currentUser *models.UserRow) ([]phraseDisplay, error) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	followeeIDs, err := models.NewFollow(db).FolloweeIDs(nil, currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	phrases, err := models.GetFeedPhrases(followeeIDs, feedLimit, models.NewPhraseConnection(mongdb))
+	if err != nil {
+		return nil, err
+	}
+
+	userTable := models.NewUser(db)
+	phraseList := []phraseDisplay{}
+	for _, phrase := range phrases {
+		submitter, _ := userTable.GetByID(nil, phrase.SubmitterUserID)
+		phraseList = append(phraseList, newPhraseDisplay(phrase, submitter.Username))
+	}
+
+	if err := addCommentCounts(r, phraseList); err != nil {
+		return nil, err
+	}
+
+	return phraseList, nil
+}
+
+// newPhraseDisplay prepares a phrase for the phrase list templates
+func newPhraseDisplay(phrase models.Phrase, author string) phraseDisplay {
+	timeSinceSubmission := time.Now().Sub(phrase.SubmissionDate)
+	avgRating := math.Round(models.AverageRating(phrase.PhraseRatings))
+	r := phrase.PhraseRatings
+
+	return phraseDisplay{
+		PhraseID:            phrase.PhraseID.Hex(),
+		PhraseText:          phrase.PhraseText,
+		Author:              author,
+		TimeSinceSubmission: timeAgo(timeSinceSubmission),
+		IsOneStar:           avgRating == 1,
+		IsTwoStar:           avgRating == 2,
+		IsThreeStar:         avgRating == 3,
+		IsFourStar:          avgRating == 4,
+		IsFiveStar:          avgRating == 5,
+		RatingCount:         r.OneStar + r.TwoStar + r.ThreeStar + r.FourStar + r.FiveStar,
+	}
+}
+
 func getUser(session *sessions.Session) (*models.UserRow, bool) {
 	currentUser, ok := session.Values["user"].(*models.UserRow)
 
@@ -248,3 +338,9 @@ func getUser(session *sessions.Session) (*models.UserRow, bool) {
 
 	return currentUser, isCurator
 }
+
+// setSessionUser logs the user in. Only their ID is saved; LoadUser loads the user for every request.
+func setSessionUser(session *sessions.Session, user *models.UserRow) {
+	session.Values["userID"] = user.ID
+	session.Values["user"] = user
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/models"
+)
+
+type leaderboardsPageData struct {
+	CurrentUser *models.UserRow
+	IsCurator   bool
+	Periods     []models.LeaderboardPeriod
+	Period      models.LeaderboardPeriod
+	// Leaderboard is nil until the first refresh finished
+	Leaderboard *models.Leaderboard
+}
+
+// GetLeaderboards shows the top submitters and curators of the period given in the query string
+func GetLeaderboards(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+	leaderboards := r.Context().Value("leaderboards").(*models.LeaderboardCache)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	period := models.ParseLeaderboardPeriod(r.FormValue("period"))
+
+	pageData := leaderboardsPageData{
+		CurrentUser: currentUser,
+		IsCurator:   isCurator,
+		Periods:     models.LeaderboardPeriods,
+		Period:      period,
+		Leaderboard: leaderboards.Get(period),
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/leaderboards.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// GetAPILeaderboards returns the leaderboard of the period given in the query string as JSON
+func GetAPILeaderboards(w http.ResponseWriter, r *http.Request) {
+	leaderboards := r.Context().Value("leaderboards").(*models.LeaderboardCache)
+
+	leaderboard := leaderboards.Get(models.ParseLeaderboardPeriod(r.FormValue("period")))
+	if leaderboard == nil {
+		w.Header().Set("Retry-After", "60")
+		libhttp.WriteJson(w, http.StatusServiceUnavailable, map[string]string{"Error": "leaderboards are still being computed"})
+		return
+	}
+
+	libhttp.WriteJson(w, http.StatusOK, leaderboard)
+}
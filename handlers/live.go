@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libsse"
+	"github.com/punocracy/punocracy/models"
+)
+
+// Topics of the live event stream. Every phrase also has its own topic, see LivePhraseTopic.
+const (
+	// LiveTopicAccepted gets a message for every newly accepted phrase
+	LiveTopicAccepted = "accepted"
+	// LiveTopicQueue gets the length of the curator queue whenever it may have changed
+	LiveTopicQueue = "queue"
+)
+
+// liveMaxPhrases is how many phrases one stream can follow the ratings of
+const liveMaxPhrases = 100
+
+// LivePhraseTopic is the topic of a phrase's rating changes
+func LivePhraseTopic(phraseID primitive.ObjectID) string {
+	return "phrase:" + phraseID.Hex()
+}
+
+type liveRating struct {
+	ID      string  `json:"id"`
+	Count   int     `json:"count"`
+	Average float64 `json:"average"`
+	// Stars counts the ratings of each number of stars, one star first
+	Stars []int `json:"stars"`
+}
+
+type liveAccepted struct {
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+	Author string `json:"author"`
+	URL    string `json:"url"`
+}
+
+type liveQueue struct {
+	Length int64 `json:"length"`
+}
+
+func newLiveMessage(event string, data interface{}) libsse.Message {
+	encoded, _ := json.Marshal(data)
+	return libsse.Message{Event: event, Data: encoded}
+}
+
+// LiveRatingMessage tells the pages showing a phrase about its current ratings
+func LiveRatingMessage(phrase models.Phrase) libsse.Message {
+	r := phrase.PhraseRatings
+	stars := []int{r.OneStar, r.TwoStar, r.ThreeStar, r.FourStar, r.FiveStar}
+
+	count := 0
+	for _, n := range stars {
+		count += n
+	}
+
+	return newLiveMessage("rating", liveRating{
+		ID:      phrase.PhraseID.Hex(),
+		Count:   count,
+		Average: models.AverageRating(r),
+		Stars:   stars,
+	})
+}
+
+// LiveAcceptedMessage tells /now about a newly accepted phrase
+func LiveAcceptedMessage(phrase models.Phrase, author string) libsse.Message {
+	return newLiveMessage("accepted", liveAccepted{
+		ID:     phrase.PhraseID.Hex(),
+		Text:   phrase.PhraseText,
+		Author: author,
+		URL:    "/phrases/" + phrase.PhraseID.Hex(),
+	})
+}
+
+// LiveQueueMessage tells curators how many phrases are waiting
+func LiveQueueMessage(length int64) libsse.Message {
+	return newLiveMessage("queue", liveQueue{Length: length})
+}
+
+// GetLiveEvents streams live updates as Server-Sent Events.
+// phrases is a comma separated list of phrase IDs to follow the ratings of, accepted=1 asks for newly accepted phrases
+// and queue=1 asks curators for the length of the queue.
+func GetLiveEvents(w http.ResponseWriter, r *http.Request) {
+	live := r.Context().Value("live").(*libsse.Broker)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	_, isCurator := getUser(session)
+
+	topics := []string{}
+	initial := []libsse.Message{}
+
+	if phrases := r.FormValue("phrases"); phrases != "" {
+		ids := strings.Split(phrases, ",")
+		if len(ids) > liveMaxPhrases {
+			ids = ids[:liveMaxPhrases]
+		}
+
+		for _, id := range ids {
+			phraseID, err := primitive.ObjectIDFromHex(id)
+			if err == nil {
+				topics = append(topics, LivePhraseTopic(phraseID))
+			}
+		}
+	}
+
+	if r.FormValue("accepted") == "1" {
+		topics = append(topics, LiveTopicAccepted)
+	}
+
+	if r.FormValue("queue") == "1" && isCurator {
+		mongodb := r.Context().Value("mongodb").(*mongo.Database)
+
+		length, err := models.CountQueue(models.NewPhraseConnection(mongodb))
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+
+		topics = append(topics, LiveTopicQueue)
+		initial = append(initial, LiveQueueMessage(length))
+	}
+
+	if len(topics) == 0 {
+		libhttp.WriteJson(w, http.StatusBadRequest, map[string]string{"Error": "Nothing to stream"})
+		return
+	}
+
+	err := live.Stream(w, r, topics, initial...)
+	switch err {
+	case nil:
+	case libsse.ErrClosed, libsse.ErrTooManyClients:
+		// Shutting down or full; live.js tries again later
+		w.Header().Set("Retry-After", "5")
+		libhttp.WriteJson(w, http.StatusServiceUnavailable, map[string]string{"Error": err.Error()})
+	case libsse.ErrStreamingUnsupported:
+		libhttp.HandleErrorJson(w, err)
+	case libsse.ErrSlowClient:
+		logrus.Infoln("Dropped live event stream of", libhttp.ClientIP(r), "for falling behind")
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/models"
+)
+
+// notificationPageSize is how many notifications the notifications page shows
+const notificationPageSize = 50
+
+// notificationLabels describes each kind of notification in the preferences form
+var notificationLabels = map[string]string{
+	models.NotificationPhraseAccepted: "A curator accepted my phrase",
+	models.NotificationPhraseRejected: "A curator rejected my phrase",
+	models.NotificationFiveStarRating: "Someone rated my phrase 5 stars",
+	models.NotificationNewFollower:    "Someone followed me",
+	models.NotificationCuratorQueue:   "The curator queue is getting long",
+}
+
+type notificationPreference struct {
+	Type     string
+	Label    string
+	Delivery string
+}
+
+type notificationsPageData struct {
+	CurrentUser   *models.UserRow
+	IsCurator     bool
+	Notifications []models.NotificationRow
+	Unread        int
+	Preferences   []notificationPreference
+	// Saved is set right after the preferences were saved
+	Saved bool
+}
+
+// countUnreadNotifications counts the current user's unread notifications, or returns 0 if nobody is logged in
+func countUnreadNotifications(r *http.Request) int {
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+	if currentUser == nil {
+		return 0
+	}
+
+	count, err := models.NewNotification(db).CountUnread(nil, currentUser.ID)
+	if err != nil {
+		logrus.Errorln(err)
+	}
+
+	return count
+}
+
+// GetNotifications lists the current user's notifications and their preferences
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	notifications := models.NewNotification(db)
+
+	recent, err := notifications.Recent(nil, currentUser.ID, notificationPageSize)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	unread, err := notifications.CountUnread(nil, currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	preferences, err := notifications.Preferences(nil, currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := notificationsPageData{
+		CurrentUser:   currentUser,
+		IsCurator:     isCurator,
+		Notifications: recent,
+		Unread:        unread,
+		Saved:         r.URL.Query().Get("saved") != "",
+	}
+	for _, notificationType := range models.NotificationTypes {
+		// Only curators hear about the queue
+		if notificationType == models.NotificationCuratorQueue && !isCurator {
+			continue
+		}
+
+		pageData.Preferences = append(pageData.Preferences, notificationPreference{
+			Type:     notificationType,
+			Label:    notificationLabels[notificationType],
+			Delivery: preferences[notificationType],
+		})
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/notifications.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// PostReadNotification marks one of the current user's notifications as read
+func PostReadNotification(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	notificationID, err := strconv.ParseInt(mux.Vars(r)["notificationID"], 10, 64)
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	err = models.NewNotification(db).MarkRead(nil, currentUser.ID, notificationID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusFound)
+}
+
+// PostReadAllNotifications marks every notification of the current user as read
+func PostReadAllNotifications(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	err := models.NewNotification(db).MarkAllRead(nil, currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusFound)
+}
+
+// PostNotificationPreferences saves how the current user wants to get each kind of notification
+func PostNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	notifications := models.NewNotification(db)
+
+	// Start from the saved preferences so the ones missing from the form, like the curator queue for regular users, are kept
+	preferences, err := notifications.Preferences(nil, currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	for _, notificationType := range models.NotificationTypes {
+		if delivery := r.FormValue(notificationType); delivery != "" {
+			preferences[notificationType] = delivery
+		}
+	}
+
+	err = notifications.SetPreferences(nil, currentUser.ID, preferences)
+	if err == models.ErrUnknownNotificationDelivery {
+		libhttp.WriteJson(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications?saved=1", http.StatusFound)
+}
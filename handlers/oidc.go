@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/punocracy/punocracy/libevent"
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/liboidc"
+	"github.com/punocracy/punocracy/models"
+)
+
+type identitiesPageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	Identities   []models.IdentityRow
+	// Providers are the configured providers the user hasn't linked yet
+	Providers []string
+}
+
+// oidcProviderNames returns the names of the configured identity providers, sorted.
+func oidcProviderNames(r *http.Request) []string {
+	clients, _ := r.Context().Value("oidcClients").(map[string]*liboidc.Client)
+
+	names := []string{}
+	for name := range clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func getOIDCClient(r *http.Request) (string, *liboidc.Client) {
+	clients, _ := r.Context().Value("oidcClients").(map[string]*liboidc.Client)
+
+	name := mux.Vars(r)["provider"]
+	return name, clients[name]
+}
+
+// GetOIDCLogin sends the user to the identity provider to log in
+func GetOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	startOIDC(w, r, false)
+}
+
+// PostLinkIdentity sends the logged in user to the identity provider to link their account there
+func PostLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	startOIDC(w, r, true)
+}
+
+// startOIDC remembers state, nonce and PKCE verifier in the session and redirects to the provider.
+func startOIDC(w http.ResponseWriter, r *http.Request, link bool) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	name, client := getOIDCClient(r)
+	if client == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	values := make(map[string]string)
+	for _, key := range []string{"oidcState", "oidcNonce", "oidcVerifier"} {
+		value, err := liboidc.RandomString()
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+		values[key] = value
+	}
+
+	authURL, err := client.AuthCodeURL(values["oidcState"], values["oidcNonce"], values["oidcVerifier"])
+	if err != nil {
+		logrus.Errorln(err)
+		renderLogin(w, r, loginPageData{ErrorMessage: "Logging in with " + name + " is not available right now. Please try again later."})
+		return
+	}
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	for key, value := range values {
+		session.Values[key] = value
+	}
+	session.Values["oidcProvider"] = name
+	session.Values["oidcLink"] = link
+
+	err = session.Save(r, w)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GetOIDCCallback completes a login or account link when the provider redirects back.
+// Identities that aren't linked yet get a new account, unless the email belongs to an existing one:
+// taking over accounts by email would trust every provider with every account.
+func GetOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	name, client := getOIDCClient(r)
+	if client == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+
+	state, _ := session.Values["oidcState"].(string)
+	nonce, _ := session.Values["oidcNonce"].(string)
+	verifier, _ := session.Values["oidcVerifier"].(string)
+	provider, _ := session.Values["oidcProvider"].(string)
+	link, _ := session.Values["oidcLink"].(bool)
+
+	for _, key := range []string{"oidcState", "oidcNonce", "oidcVerifier", "oidcProvider", "oidcLink"} {
+		delete(session.Values, key)
+	}
+
+	if state == "" || provider != name || r.FormValue("state") != state {
+		w.WriteHeader(http.StatusBadRequest)
+		renderLogin(w, r, loginPageData{ErrorMessage: "Your login with " + name + " expired. Please try again."})
+		return
+	}
+
+	if r.FormValue("error") != "" {
+		logrus.Infoln("OIDC login failed:", name, r.FormValue("error"), r.FormValue("error_description"))
+		renderLogin(w, r, loginPageData{ErrorMessage: "Logging in with " + name + " was cancelled or failed."})
+		return
+	}
+
+	claims, err := client.Exchange(r.FormValue("code"), verifier, nonce)
+	if err != nil {
+		logrus.Errorln(err)
+		renderLogin(w, r, loginPageData{ErrorMessage: "Logging in with " + name + " failed. Please try again."})
+		return
+	}
+
+	identities := models.NewIdentity(db)
+	currentUser, _ := getUser(session)
+
+	if link && currentUser != nil {
+		err = identities.Link(nil, currentUser.ID, name, claims.Subject, claims.Email)
+		if err == models.ErrIdentityLinked {
+			renderIdentities(w, r, currentUser, "This "+name+" account is already linked to another user.")
+			return
+		}
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+
+		session.Save(r, w)
+		http.Redirect(w, r, "/account/identities", http.StatusFound)
+		return
+	}
+
+	u := models.NewUser(db)
+
+	var user *models.UserRow
+
+	identity, err := identities.GetByProviderSubject(nil, name, claims.Subject)
+	switch {
+	case err == nil:
+		user, err = u.GetByID(nil, identity.UserID)
+
+	case err == sql.ErrNoRows:
+		if claims.Email != "" {
+			if _, err := u.GetByEmail(nil, claims.Email); err == nil {
+				renderLogin(w, r, loginPageData{ErrorMessage: "An account with the email " + claims.Email + " already exists. " +
+					"Log in with your password, then link " + name + " from your account settings."})
+				return
+			}
+		}
+
+		user, err = signupExternal(u, claims, r.Context().Value("events").(*libevent.Bus))
+		if err == nil {
+			err = identities.Link(nil, user.ID, name, claims.Subject, claims.Email)
+		}
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	completeLogin(w, r, user)
+}
+
+// signupExternal creates an account for a new identity, deriving the username from the claims.
+func signupExternal(u *models.User, claims *liboidc.Claims, events *libevent.Bus) (*models.UserRow, error) {
+	candidates := []string{claims.PreferredUsername, strings.SplitN(claims.Email, "@", 2)[0], claims.Name}
+
+	base := "punster"
+	for _, candidate := range candidates {
+		if cleaned := cleanUsername(candidate); cleaned != "" {
+			base = cleaned
+			break
+		}
+	}
+
+	username, err := u.UniqueUsername(nil, base)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.SignupExternal(nil, username, claims.Email, claims.Email != "" && claims.EmailVerified, events)
+}
+
+// cleanUsername keeps letters, digits, dots, dashes and underscores, up to 30 characters.
+func cleanUsername(name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, name)
+
+	if runes := []rune(cleaned); len(runes) > 30 {
+		cleaned = string(runes[:30])
+	}
+
+	return cleaned
+}
+
+// GetAccountIdentities lists the external identities linked to the current user
+func GetAccountIdentities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	renderIdentities(w, r, currentUser, "")
+}
+
+func renderIdentities(w http.ResponseWriter, r *http.Request, currentUser *models.UserRow, errorMessage string) {
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	identities, err := models.NewIdentity(db).ListByUser(nil, currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	linked := make(map[string]bool)
+	for _, identity := range identities {
+		linked[identity.Provider] = true
+	}
+
+	pageData := identitiesPageData{
+		CurrentUser:  currentUser,
+		IsCurator:    currentUser.PermLevel <= models.Curator,
+		ErrorMessage: errorMessage,
+		Identities:   identities,
+	}
+	for _, name := range oidcProviderNames(r) {
+		if !linked[name] {
+			pageData.Providers = append(pageData.Providers, name)
+		}
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/identities.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// PostUnlinkIdentity removes one of the current user's linked identities
+func PostUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	identityID, err := strconv.ParseInt(r.FormValue("identityID"), 10, 64)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	err = models.NewIdentity(db).Unlink(nil, currentUser.ID, identityID)
+	if err == models.ErrLastLoginMethod {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadRequest)
+		renderIdentities(w, r, currentUser, "This is the only way you can log in. "+
+			"Set a password with \"Forgot your password?\" on the login page before unlinking it.")
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/account/identities", http.StatusFound)
+}
@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libsharecard"
+	"github.com/punocracy/punocracy/libstring"
+	"github.com/punocracy/punocracy/models"
+)
+
+type editPhrasePageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	PhraseID     string
+	PhraseText   string
+	ErrorMessage string
+	Revisions    []revisionDisplay
+}
+
+type revisionDisplay struct {
+	Index         int
+	PreviousIndex int
+	EditorName    string
+	EditDate      string
+	PhraseText    string
+}
+
+type revisionDiffPageData struct {
+	CurrentUser *models.UserRow
+	IsCurator   bool
+	PhraseID    string
+	From        revisionDisplay
+	To          revisionDisplay
+	Chunks      []diffChunkDisplay
+}
+
+type diffChunkDisplay struct {
+	Text     string
+	IsInsert bool
+	IsDelete bool
+}
+
+// GetEditPhrase shows the edit form for a phrase along with its revision history
+func GetEditPhrase(w http.ResponseWriter, r *http.Request) {
+	renderEditPhrase(w, r, "")
+}
+
+// PostEditPhrase saves a new revision of a phrase.
+// Submitters may edit their unreviewed or accepted phrases, curators may edit any phrase.
+func PostEditPhrase(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+
+	currentUser, _ := getUser(session)
+	if currentUser == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	phraseID, err := getPhraseIDFromPath(w, r)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+	phrasesCollection := models.NewPhraseConnection(mongdb)
+	revisionsCollection := models.NewPhraseRevisionsConnection(mongdb)
+
+	phraseText := r.FormValue("phraseText")
+
+	err = models.EditPhrase(phraseID, phraseText, *currentUser, models.NewWord(db), getModerator(r), phrasesCollection, revisionsCollection)
+	if err == models.ErrEditNotAllowed || err == models.ErrPhraseNotFound {
+		http.Redirect(w, r, "/now", http.StatusFound)
+		return
+	}
+	if moderationErr, ok := err.(*models.ModerationError); ok {
+		renderEditPhrase(w, r, "Your edit was rejected because it "+moderationErr.Reason+".")
+		return
+	}
+	if err != nil {
+		logrus.Errorln(err.Error())
+		renderEditPhrase(w, r, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/phrases/"+phraseID.Hex()+"/edit", http.StatusFound)
+}
+
+func renderEditPhrase(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+
+	currentUser, isCurator := getUser(session)
+	if currentUser == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	phraseID, err := getPhraseIDFromPath(w, r)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+	phrasesCollection := models.NewPhraseConnection(mongdb)
+	revisionsCollection := models.NewPhraseRevisionsConnection(mongdb)
+
+	phrase, err := models.GetPhraseByID(phraseID, phrasesCollection)
+	if err != nil || !models.CanEditPhrase(*currentUser, phrase) {
+		http.Redirect(w, r, "/now", http.StatusFound)
+		return
+	}
+
+	revisions, err := models.GetPhraseRevisions(phraseID, revisionsCollection)
+	if err != nil {
+		logrus.Errorln(err.Error())
+	}
+
+	pageData := editPhrasePageData{
+		CurrentUser:  currentUser,
+		IsCurator:    isCurator,
+		PhraseID:     phraseID.Hex(),
+		PhraseText:   phrase.PhraseText,
+		ErrorMessage: errorMessage,
+		Revisions:    revisionDisplays(revisions, models.NewUser(db)),
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/phrase-edit.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// GetPhraseRevisionDiff shows a word diff between two revisions of a phrase.
+// The revisions are picked with the "from" and "to" query parameters, defaulting to the last two.
+func GetPhraseRevisionDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+
+	currentUser, isCurator := getUser(session)
+	if currentUser == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	phraseID, err := getPhraseIDFromPath(w, r)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+	phrasesCollection := models.NewPhraseConnection(mongdb)
+	revisionsCollection := models.NewPhraseRevisionsConnection(mongdb)
+
+	phrase, err := models.GetPhraseByID(phraseID, phrasesCollection)
+	if err != nil || (!isCurator && phrase.SubmitterUserID != currentUser.ID) {
+		http.Redirect(w, r, "/now", http.StatusFound)
+		return
+	}
+
+	revisions, err := models.GetPhraseRevisions(phraseID, revisionsCollection)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	if len(revisions) < 2 {
+		http.Redirect(w, r, "/phrases/"+phraseID.Hex()+"/edit", http.StatusFound)
+		return
+	}
+
+	from := revisionIndexFromQuery(r, "from", len(revisions)-2, len(revisions))
+	to := revisionIndexFromQuery(r, "to", len(revisions)-1, len(revisions))
+
+	chunks := []diffChunkDisplay{}
+	for _, chunk := range libstring.DiffWords(revisions[from].PhraseText, revisions[to].PhraseText) {
+		chunks = append(chunks, diffChunkDisplay{
+			Text:     chunk.Text,
+			IsInsert: chunk.Kind == libstring.DiffInsert,
+			IsDelete: chunk.Kind == libstring.DiffDelete,
+		})
+	}
+
+	displays := revisionDisplays(revisions, models.NewUser(db))
+
+	pageData := revisionDiffPageData{
+		CurrentUser: currentUser,
+		IsCurator:   isCurator,
+		PhraseID:    phraseID.Hex(),
+		From:        displays[from],
+		To:          displays[to],
+		Chunks:      chunks,
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/phrase-revisions.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// revisionIndexFromQuery reads a revision index from the query string, falling back to a default when it is missing or out of range
+func revisionIndexFromQuery(r *http.Request, key string, defaultIndex int, count int) int {
+	index, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil || index < 0 || index >= count {
+		return defaultIndex
+	}
+
+	return index
+}
+
+func revisionDisplays(revisions []models.PhraseRevision, userTable *models.User) []revisionDisplay {
+	displays := []revisionDisplay{}
+
+	for i, revision := range revisions {
+		editorName := "anonymous"
+		editor, err := userTable.GetByID(nil, revision.EditorUserID)
+		if err == nil {
+			editorName = editor.Username
+		}
+
+		displays = append(displays, revisionDisplay{
+			Index:         i,
+			PreviousIndex: i - 1,
+			EditorName:    editorName,
+			EditDate:      revision.EditDate.Format("2006-01-02 15:04"),
+			PhraseText:    revision.PhraseText,
+		})
+	}
+
+	return displays
+}
+
+type phrasePageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	Phrase       phraseDisplay
+	CanEdit      bool
+	// CanComment is set for logged in users on accepted phrases
+	CanComment  bool
+	Comments    []commentDisplay
+	Ratings     []ratingBarDisplay
+	NumRatings  int
+	RelatedPuns []relatedPunsDisplay
+	Collections []collectionOption
+	// PageURL and CardURL are absolute, as required by the share metadata
+	PageURL string
+	CardURL string
+}
+
+type ratingBarDisplay struct {
+	Stars   int
+	Count   int
+	Percent int
+}
+
+type relatedPunsDisplay struct {
+	Word string
+	Puns []string
+}
+
+// newRatingHistogram returns a bar for each star rating, five stars first
+func newRatingHistogram(rating models.Rating) ([]ratingBarDisplay, int) {
+	counts := []int{rating.FiveStar, rating.FourStar, rating.ThreeStar, rating.TwoStar, rating.OneStar}
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	bars := []ratingBarDisplay{}
+	for i, count := range counts {
+		bar := ratingBarDisplay{Stars: 5 - i, Count: count}
+		if total > 0 {
+			bar.Percent = int(math.Round(100 * float64(count) / float64(total)))
+		}
+		bars = append(bars, bar)
+	}
+
+	return bars, total
+}
+
+// relatedPuns swaps each dictionary word of the phrase for its homophones
+func relatedPuns(db *sqlx.DB, phrase models.Phrase) ([]relatedPunsDisplay, error) {
+	wordTable := models.NewWord(db)
+
+	words, err := wordTable.GetByIDs(nil, phrase.WordList)
+	if err != nil {
+		return nil, err
+	}
+
+	related := []relatedPunsDisplay{}
+	for _, word := range words {
+		// QueryHlistString errors when the word has no homophones
+		homophones, err := wordTable.QueryHlistString(nil, word.Word)
+		if err != nil {
+			continue
+		}
+
+		puns := models.RelatedPuns(phrase, word, homophones)
+		if len(puns) > 0 {
+			related = append(related, relatedPunsDisplay{Word: word.Word, Puns: puns})
+		}
+	}
+
+	return related, nil
+}
+
+// getVisiblePhrase returns the phrase in the path if the current user may see it.
+// Phrases that weren't accepted are only shown to their submitter and curators.
+func getVisiblePhrase(r *http.Request, currentUser *models.UserRow, isCurator bool) (models.Phrase, error) {
+	phraseID, err := getPhraseIDFromPath(nil, r)
+	if err != nil {
+		return models.Phrase{}, mongo.ErrNoDocuments
+	}
+
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phrase, err := models.GetPhraseByID(phraseID, models.NewPhraseConnection(mongdb))
+	if err != nil {
+		return phrase, err
+	}
+
+	isSubmitter := currentUser != nil && currentUser.ID == phrase.SubmitterUserID
+	if phrase.DisplayPublic != models.Accepted && !isSubmitter && !isCurator {
+		return phrase, mongo.ErrNoDocuments
+	}
+
+	return phrase, nil
+}
+
+// GetPhrase shows a phrase with its ratings, related puns and discussion
+func GetPhrase(w http.ResponseWriter, r *http.Request) {
+	renderPhrase(w, r, http.StatusOK, "")
+}
+
+func renderPhrase(w http.ResponseWriter, r *http.Request, status int, errorMessage string) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	phrase, err := getVisiblePhrase(r, currentUser, isCurator)
+	if err == mongo.ErrNoDocuments {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+	config := r.Context().Value("config").(*viper.Viper)
+	userTable := models.NewUser(db)
+
+	comments, err := models.GetComments(phrase.PhraseID, models.NewCommentsConnection(mongdb))
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	related, err := relatedPuns(db, phrase)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	submitter, err := userTable.GetByID(nil, phrase.SubmitterUserID)
+	author := "[deleted]"
+	if err == nil {
+		author = submitter.Username
+	}
+
+	pageURL := config.GetString("base_url") + "/phrases/" + phrase.PhraseID.Hex()
+
+	pageData := phrasePageData{
+		CurrentUser:  currentUser,
+		IsCurator:    isCurator,
+		ErrorMessage: errorMessage,
+		Phrase:       newPhraseDisplay(phrase, author),
+		CanEdit:      currentUser != nil && models.CanEditPhrase(*currentUser, phrase),
+		CanComment:   currentUser != nil && phrase.DisplayPublic == models.Accepted,
+		Comments:     newCommentDisplays(comments, currentUser, userTable),
+		RelatedPuns:  related,
+		PageURL:      pageURL,
+		CardURL:      pageURL + "/card.png",
+	}
+	pageData.Phrase.CommentCount = models.CountUndeleted(comments)
+	pageData.Ratings, pageData.NumRatings = newRatingHistogram(phrase.PhraseRatings)
+
+	phraseList := []phraseDisplay{pageData.Phrase}
+	err = addFavorites(r, currentUser, phraseList)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	pageData.Phrase = phraseList[0]
+
+	pageData.Collections, err = collectionOptions(r, currentUser)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/phrase.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	tmpl.Execute(w, pageData)
+}
+
+// GetPhraseCard renders the image shown when a phrase is shared
+func GetPhraseCard(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	phrase, err := getVisiblePhrase(r, currentUser, isCurator)
+	if err == mongo.ErrNoDocuments {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	card := libsharecard.Card{Text: phrase.PhraseText, Rating: models.AverageRating(phrase.PhraseRatings)}
+	if submitter, err := models.NewUser(db).GetByID(nil, phrase.SubmitterUserID); err == nil {
+		card.Author = submitter.Username
+	}
+
+	var buf bytes.Buffer
+	if err := libsharecard.Render(&buf, card); err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	if phrase.DisplayPublic == models.Accepted {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	w.Write(buf.Bytes())
+}
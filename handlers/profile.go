@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libevent"
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/models"
+)
+
+// profilePhraseLimit is how many of a user's accepted phrases their profile shows
+const profilePhraseLimit = 20
+
+type profilePageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	User         *models.UserRow
+	Stats        models.UserStats
+	// AcceptancePercent is Stats.AcceptanceRate rounded for display
+	AcceptancePercent int
+	Phrases           []phraseDisplay
+	Followers         int
+	Following         int
+	// IsOwnProfile shows the form for editing the display name and bio
+	IsOwnProfile bool
+	// IsFollowing is set when the current user follows this one
+	IsFollowing bool
+}
+
+type profileJson struct {
+	Username    string           `json:"username"`
+	DisplayName string           `json:"displayName"`
+	Bio         string           `json:"bio"`
+	JoinedAt    time.Time        `json:"joinedAt"`
+	Reputation  int              `json:"reputation"`
+	Stats       models.UserStats `json:"stats"`
+	Followers   int              `json:"followers"`
+	Following   int              `json:"following"`
+	Phrases     []profilePhrase  `json:"phrases"`
+}
+
+type profilePhrase struct {
+	PhraseID       string    `json:"id"`
+	PhraseText     string    `json:"text"`
+	SubmissionDate time.Time `json:"submissionDate"`
+	AverageRating  float64   `json:"averageRating"`
+}
+
+// profile is everything shown about a user on their profile
+type profile struct {
+	User      *models.UserRow
+	Stats     models.UserStats
+	Phrases   []models.Phrase
+	Followers int
+	Following int
+}
+
+// getProfile loads the user with their statistics, accepted phrases and follower counts.
+// It returns sql.ErrNoRows if there is no such user.
+func getProfile(r *http.Request, username string) (*profile, error) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+	phrasesCollection := models.NewPhraseConnection(mongdb)
+	follow := models.NewFollow(db)
+
+	user, err := models.NewUser(db).GetByUsername(nil, username)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &profile{User: user}
+
+	p.Stats, err = models.GetUserStats(*user, phrasesCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Phrases, err = models.GetAcceptedPhrasesByUser(*user, profilePhraseLimit, phrasesCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Followers, err = follow.CountFollowers(nil, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Following, err = follow.CountFollowing(nil, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// GetProfile generates the public profile page of a user
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	renderProfile(w, r, mux.Vars(r)["username"], "")
+}
+
+func renderProfile(w http.ResponseWriter, r *http.Request, username, errorMessage string) {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	p, err := getProfile(r, username)
+	if err == sql.ErrNoRows {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := profilePageData{
+		CurrentUser:       currentUser,
+		IsCurator:         isCurator,
+		ErrorMessage:      errorMessage,
+		User:              p.User,
+		Stats:             p.Stats,
+		AcceptancePercent: int(math.Round(p.Stats.AcceptanceRate * 100)),
+		Followers:         p.Followers,
+		Following:         p.Following,
+		IsOwnProfile:      currentUser != nil && currentUser.ID == p.User.ID,
+	}
+	for _, phrase := range p.Phrases {
+		pageData.Phrases = append(pageData.Phrases, newPhraseDisplay(phrase, p.User.Username))
+	}
+	if err := addCommentCounts(r, pageData.Phrases); err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	if currentUser != nil && !pageData.IsOwnProfile {
+		db := r.Context().Value("db").(*sqlx.DB)
+
+		pageData.IsFollowing, err = models.NewFollow(db).IsFollowing(nil, currentUser.ID, p.User.ID)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/profile.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	if errorMessage != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	tmpl.Execute(w, pageData)
+}
+
+// GetAPIProfile returns the same data as the profile page as JSON
+func GetAPIProfile(w http.ResponseWriter, r *http.Request) {
+	p, err := getProfile(r, mux.Vars(r)["username"])
+	if err == sql.ErrNoRows {
+		libhttp.WriteJson(w, http.StatusNotFound, map[string]string{"Error": "user not found"})
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	profile := profileJson{
+		Username:    p.User.Username,
+		DisplayName: p.User.DisplayName,
+		Bio:         p.User.Bio,
+		JoinedAt:    p.User.CreatedAt,
+		Reputation:  p.User.Reputation,
+		Stats:       p.Stats,
+		Followers:   p.Followers,
+		Following:   p.Following,
+		Phrases:     []profilePhrase{},
+	}
+	for _, phrase := range p.Phrases {
+		profile.Phrases = append(profile.Phrases, profilePhrase{
+			PhraseID:       phrase.PhraseID.Hex(),
+			PhraseText:     phrase.PhraseText,
+			SubmissionDate: phrase.SubmissionDate,
+			AverageRating:  models.AverageRating(phrase.PhraseRatings),
+		})
+	}
+
+	libhttp.WriteJson(w, http.StatusOK, profile)
+}
+
+// PostProfile saves the display name and bio of the current user
+func PostProfile(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	_, err := models.NewUser(db).UpdateProfile(nil, currentUser.ID, r.FormValue("DisplayName"), r.FormValue("Bio"))
+	if err == models.ErrDisplayNameTooLong || err == models.ErrBioTooLong {
+		w.Header().Set("Content-Type", "text/html")
+		renderProfile(w, r, currentUser.Username, "Your display name can be at most 64 characters and your bio at most 500.")
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/u/"+url.PathEscape(currentUser.Username), http.StatusFound)
+}
+
+// PostFollow makes the current user follow the user in the path
+func PostFollow(w http.ResponseWriter, r *http.Request) {
+	changeFollow(w, r, true)
+}
+
+// PostUnfollow makes the current user stop following the user in the path
+func PostUnfollow(w http.ResponseWriter, r *http.Request) {
+	changeFollow(w, r, false)
+}
+
+func changeFollow(w http.ResponseWriter, r *http.Request, follow bool) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	events := r.Context().Value("events").(*libevent.Bus)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	user, err := models.NewUser(db).GetByUsername(nil, mux.Vars(r)["username"])
+	if err == sql.ErrNoRows {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	if follow {
+		err = models.NewFollow(db).Follow(nil, currentUser.ID, user.ID, events)
+	} else {
+		err = models.NewFollow(db).Unfollow(nil, currentUser.ID, user.ID)
+	}
+	if err != nil && err != models.ErrFollowSelf {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/u/"+url.PathEscape(user.Username), http.StatusFound)
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/models"
+)
+
+// calendarDays is how far ahead the curator calendar reaches
+const calendarDays = 30
+
+type punOfTheDayDisplay struct {
+	Day    string
+	Phrase phraseDisplay
+	// Scheduled is set when a curator picked the phrase
+	Scheduled bool
+}
+
+type punOfTheDayPageData struct {
+	CurrentUser *models.UserRow
+	IsCurator   bool
+	Day         string
+	PunOfTheDay *punOfTheDayDisplay
+	PreviousDay string
+	// NextDay is empty when Day is today
+	NextDay string
+}
+
+type punOfTheDayArchivePageData struct {
+	CurrentUser   *models.UserRow
+	IsCurator     bool
+	Month         string
+	PunsOfTheDay  []punOfTheDayDisplay
+	PreviousMonth string
+	// NextMonth is empty when Month is the current month
+	NextMonth string
+}
+
+type calendarDayDisplay struct {
+	Day         string
+	PunOfTheDay *punOfTheDayDisplay
+	IsToday     bool
+}
+
+type punOfTheDayCalendarPageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	Today        string
+	Days         []calendarDayDisplay
+}
+
+// newPunOfTheDayDisplay looks up the phrase of a pun of the day.
+// It returns nil if the phrase was rejected or deleted since it was featured.
+func newPunOfTheDayDisplay(r *http.Request, punOfTheDay models.PunOfTheDay) (*punOfTheDayDisplay, error) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phrase, err := models.GetPhraseByID(punOfTheDay.PhraseID, models.NewPhraseConnection(mongdb))
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if phrase.DisplayPublic != models.Accepted {
+		return nil, nil
+	}
+
+	author := "[deleted]"
+	if submitter, err := models.NewUser(db).GetByID(nil, phrase.SubmitterUserID); err == nil {
+		author = submitter.Username
+	}
+
+	return &punOfTheDayDisplay{
+		Day:       punOfTheDay.Day,
+		Phrase:    newPhraseDisplay(phrase, author),
+		Scheduled: punOfTheDay.ScheduledBy != 0,
+	}, nil
+}
+
+// currentPunOfTheDay returns today's pun of the day, or nil if there is none
+func currentPunOfTheDay(r *http.Request) (*punOfTheDayDisplay, error) {
+	scheduler := r.Context().Value("punOfTheDay").(*models.PunOfTheDayScheduler)
+
+	punOfTheDay, err := scheduler.Current()
+	if err == models.ErrNoPunOfTheDay {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newPunOfTheDayDisplay(r, punOfTheDay)
+}
+
+// GetPunOfTheDay shows the pun of a past day, or today's
+func GetPunOfTheDay(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	scheduler := r.Context().Value("punOfTheDay").(*models.PunOfTheDayScheduler)
+
+	day, err := models.ParseDay(mux.Vars(r)["day"])
+	if err != nil || day > scheduler.Today() {
+		renderNotFound(w, r)
+		return
+	}
+
+	pageData := punOfTheDayPageData{
+		CurrentUser: currentUser,
+		IsCurator:   isCurator,
+		Day:         day,
+		PreviousDay: models.AddDays(day, -1),
+	}
+	if day < scheduler.Today() {
+		pageData.NextDay = models.AddDays(day, 1)
+	}
+
+	punOfTheDay, err := scheduler.Get(day)
+	if err != nil && err != models.ErrNoPunOfTheDay {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	if err == nil {
+		pageData.PunOfTheDay, err = newPunOfTheDayDisplay(r, punOfTheDay)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/pun-of-the-day.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// GetPunOfTheDayArchive lists the puns of the day of a month, the current one unless ?month=YYYY-MM is given
+func GetPunOfTheDayArchive(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	scheduler := r.Context().Value("punOfTheDay").(*models.PunOfTheDayScheduler)
+
+	currentMonth := scheduler.Today()[:len("2006-01")]
+
+	month := r.FormValue("month")
+	start, err := time.Parse("2006-01", month)
+	if err != nil || month > currentMonth {
+		month = currentMonth
+		start, _ = time.Parse("2006-01", month)
+	}
+
+	puns, err := scheduler.Archive(month)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := punOfTheDayArchivePageData{
+		CurrentUser:   currentUser,
+		IsCurator:     isCurator,
+		Month:         start.Format("January 2006"),
+		PunsOfTheDay:  []punOfTheDayDisplay{},
+		PreviousMonth: start.AddDate(0, -1, 0).Format("2006-01"),
+	}
+	if month < currentMonth {
+		pageData.NextMonth = start.AddDate(0, 1, 0).Format("2006-01")
+	}
+
+	for _, punOfTheDay := range puns {
+		display, err := newPunOfTheDayDisplay(r, punOfTheDay)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+		if display != nil {
+			pageData.PunsOfTheDay = append(pageData.PunsOfTheDay, *display)
+		}
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/pun-of-the-day-archive.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// getCurator returns the current user if they are a curator, otherwise it redirects to the home page and returns nil
+func getCurator(w http.ResponseWriter, r *http.Request) *models.UserRow {
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+
+	currentUser, isCurator := getUser(session)
+	if !isCurator {
+		http.Redirect(w, r, "/now", http.StatusFound)
+		return nil
+	}
+
+	return currentUser
+}
+
+// GetPunOfTheDayCalendar shows curators the puns scheduled for the coming days
+func GetPunOfTheDayCalendar(w http.ResponseWriter, r *http.Request) {
+	renderPunOfTheDayCalendar(w, r, http.StatusOK, "")
+}
+
+func renderPunOfTheDayCalendar(w http.ResponseWriter, r *http.Request, status int, errorMessage string) {
+	w.Header().Set("Content-Type", "text/html")
+
+	currentUser := getCurator(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	scheduler := r.Context().Value("punOfTheDay").(*models.PunOfTheDayScheduler)
+
+	puns, err := scheduler.Calendar(calendarDays)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	byDay := make(map[string]models.PunOfTheDay)
+	for _, punOfTheDay := range puns {
+		byDay[punOfTheDay.Day] = punOfTheDay
+	}
+
+	today := scheduler.Today()
+	pageData := punOfTheDayCalendarPageData{CurrentUser: currentUser, IsCurator: true, ErrorMessage: errorMessage, Today: today}
+
+	for i := 0; i < calendarDays; i++ {
+		day := models.AddDays(today, i)
+		calendarDay := calendarDayDisplay{Day: day, IsToday: i == 0}
+
+		if punOfTheDay, ok := byDay[day]; ok {
+			calendarDay.PunOfTheDay, err = newPunOfTheDayDisplay(r, punOfTheDay)
+			if err != nil {
+				libhttp.HandleErrorJson(w, err)
+				return
+			}
+		}
+
+		pageData.Days = append(pageData.Days, calendarDay)
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/pun-of-the-day-calendar.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	tmpl.Execute(w, pageData)
+}
+
+// PostSchedulePunOfTheDay makes a phrase the pun of today or a future day
+func PostSchedulePunOfTheDay(w http.ResponseWriter, r *http.Request) {
+	currentUser := getCurator(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	scheduler := r.Context().Value("punOfTheDay").(*models.PunOfTheDayScheduler)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	phraseID, err := primitive.ObjectIDFromHex(r.FormValue("phraseID"))
+	if err != nil {
+		renderPunOfTheDayCalendar(w, r, http.StatusBadRequest, "That is not a valid phrase ID.")
+		return
+	}
+
+	phrase, err := models.GetPhraseByID(phraseID, models.NewPhraseConnection(mongdb))
+	if err == mongo.ErrNoDocuments {
+		renderPunOfTheDayCalendar(w, r, http.StatusBadRequest, "There is no phrase with that ID.")
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	err = scheduler.Schedule(r.FormValue("day"), phrase, *currentUser)
+	switch err {
+	case nil:
+	case models.ErrInvalidDay:
+		renderPunOfTheDayCalendar(w, r, http.StatusBadRequest, "Pick a day to schedule the phrase for.")
+		return
+	case models.ErrDayInPast:
+		renderPunOfTheDayCalendar(w, r, http.StatusBadRequest, "Only today and future days can be scheduled.")
+		return
+	case models.ErrNotSchedulable:
+		renderPunOfTheDayCalendar(w, r, http.StatusBadRequest, "Only accepted phrases can be pun of the day.")
+		return
+	default:
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/queuerater/pun-of-the-day", http.StatusFound)
+}
+
+// PostUnschedulePunOfTheDay clears a future day, so its pun is chosen automatically
+func PostUnschedulePunOfTheDay(w http.ResponseWriter, r *http.Request) {
+	currentUser := getCurator(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	scheduler := r.Context().Value("punOfTheDay").(*models.PunOfTheDayScheduler)
+
+	err := scheduler.Unschedule(r.FormValue("day"))
+	if err == models.ErrInvalidDay || err == models.ErrDayInPast {
+		renderPunOfTheDayCalendar(w, r, http.StatusBadRequest, "Only future days can be cleared.")
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/queuerater/pun-of-the-day", http.StatusFound)
+}
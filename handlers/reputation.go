@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libevent"
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libreputation"
+	"github.com/punocracy/punocracy/models"
+)
+
+type reputationPageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	Events       []models.ReputationEventRow
+	Capabilities []models.CapabilityRow
+}
+
+type capabilitiesPageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	Capabilities []models.CapabilityRow
+}
+
+// ratePhrase records the current user's rating.
+// The reputation subscriber awards the change in stars to the phrase's submitter.
+func ratePhrase(r *http.Request, currentUser *models.UserRow, rating int, phrase models.Phrase, phrasesCollection, ratingsCollection *mongo.Collection) error {
+	events := r.Context().Value("events").(*libevent.Bus)
+
+	return models.AddOrChangeRating(*currentUser, rating, phrase, events, phrasesCollection, ratingsCollection)
+}
+
+// GetAccountReputation shows the current user's reputation ledger and unlocked capabilities
+func GetAccountReputation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	reputation := models.NewReputation(db)
+
+	events, err := reputation.Ledger(nil, currentUser.ID, 100)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	capabilities, err := reputation.Capabilities(nil, currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := reputationPageData{CurrentUser: currentUser, IsCurator: isCurator, Events: events, Capabilities: capabilities}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/reputation.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// GetAdminCapabilities lists the capabilities waiting for an administrator to confirm them
+func GetAdminCapabilities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	capabilities, err := models.NewReputation(db).PendingCapabilities(nil)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := capabilitiesPageData{CurrentUser: currentUser, IsCurator: true, Capabilities: capabilities}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/admin/capabilities.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// PostAdminCapabilities grants or denies a pending capability
+func PostAdminCapabilities(w http.ResponseWriter, r *http.Request) {
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	userID, err := strconv.ParseInt(r.FormValue("userID"), 10, 64)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	capability := libreputation.Capability(r.FormValue("capability"))
+	granted := r.FormValue("decision") == "grant"
+
+	err = models.NewReputation(db).DecideCapability(nil, userID, capability, granted, *currentUser)
+	if err == models.ErrCapabilityNotPending {
+		libhttp.WriteJson(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	logrus.Infoln("Capability", capability, "for user", userID, "decided by", currentUser.Username, "granted:", granted)
+
+	http.Redirect(w, r, "/admin/capabilities", http.StatusFound)
+}
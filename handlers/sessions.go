@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libsession"
+	"github.com/punocracy/punocracy/models"
+)
+
+type sessionDisplay struct {
+	PublicID   string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	Current    bool
+}
+
+type accountSessionsPageData struct {
+	CurrentUser *models.UserRow
+	IsCurator   bool
+	Sessions    []sessionDisplay
+}
+
+// GetAccountSessions lists the sessions the current user is logged in with
+func GetAccountSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(*libsession.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	records, err := sessionStore.Backend.ListByUser(currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := accountSessionsPageData{CurrentUser: currentUser, IsCurator: isCurator}
+	for _, record := range records {
+		pageData.Sessions = append(pageData.Sessions, sessionDisplay{
+			PublicID:   record.PublicID(),
+			UserAgent:  record.UserAgent,
+			IPAddress:  record.IPAddress,
+			CreatedAt:  record.CreatedAt,
+			LastSeenAt: record.LastSeenAt,
+			Current:    record.ID == session.ID,
+		})
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/sessions.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// PostRevokeSession logs the current user out of one of their sessions
+func PostRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(*libsession.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	records, err := sessionStore.Backend.ListByUser(currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	// Sessions are only known by their public ID, so only the user's own sessions can be revoked
+	publicID := r.FormValue("session")
+	for _, record := range records {
+		if record.PublicID() == publicID {
+			err = sessionStore.Backend.Delete(record.ID)
+			if err != nil {
+				libhttp.HandleErrorJson(w, err)
+				return
+			}
+		}
+	}
+
+	http.Redirect(w, r, "/account/sessions", http.StatusFound)
+}
+
+// PostRevokeAllSessions logs the current user out everywhere, including this session
+func PostRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	sessionStore := r.Context().Value("sessionStore").(*libsession.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	err := sessionStore.Backend.DeleteByUser(currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	logrus.Infoln("Logged out everywhere:", currentUser.Username)
+
+	session.Options.MaxAge = -1
+	session.Save(r, w)
+
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
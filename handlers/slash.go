@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libslash"
+	"github.com/punocracy/punocracy/models"
+)
+
+// slashBodyLimit is the largest command or interaction accepted
+const slashBodyLimit = 64 * 1024
+
+// slashClient posts follow-up replies to Slack
+var slashClient = &http.Client{Timeout: 5 * time.Second}
+
+var slashPlatformNames = map[string]string{
+	libslash.Slack:   "Slack",
+	libslash.Discord: "Discord",
+}
+
+// readSlashBody reads the body the signature was computed over
+func readSlashBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return ioutil.ReadAll(http.MaxBytesReader(w, r.Body, slashBodyLimit))
+}
+
+func writeSlashResponse(w http.ResponseWriter, body []byte, err error) {
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// PostSlackCommand answers Slack's /pun slash command and the rate buttons of its replies
+func PostSlackCommand(w http.ResponseWriter, r *http.Request) {
+	config := r.Context().Value("config").(*viper.Viper)
+
+	secret := config.GetString("slash_slack_signing_secret")
+	if secret == "" {
+		libhttp.WriteJson(w, http.StatusNotFound, map[string]string{"Error": "Slack commands are not set up"})
+		return
+	}
+
+	body, err := readSlashBody(w, r)
+	if err != nil {
+		libhttp.WriteJson(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	err = libslash.VerifySlack(secret, r.Header, body, time.Now())
+	if err != nil {
+		libhttp.WriteJson(w, http.StatusUnauthorized, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	command, err := libslash.ParseSlack(body)
+	if err != nil {
+		libhttp.WriteJson(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	if command.Name == "" {
+		// Slack ignores what button presses are answered with, so the reply goes to the response URL.
+		// Link buttons have no action and need no reply.
+		if command.Action != "" {
+			response := rateFromChat(r, command)
+			go func() {
+				err := libslash.PostFollowUp(slashClient, command.ResponseURL, response)
+				if err != nil {
+					logrus.Errorln(err)
+				}
+			}()
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reply, err := libslash.EncodeSlack(runSlashCommand(r, command))
+	writeSlashResponse(w, reply, err)
+}
+
+// PostDiscordInteraction answers Discord's /pun slash command and the rate buttons of its replies
+func PostDiscordInteraction(w http.ResponseWriter, r *http.Request) {
+	config := r.Context().Value("config").(*viper.Viper)
+
+	publicKey, err := libslash.ParseDiscordPublicKey(config.GetString("slash_discord_public_key"))
+	if err != nil {
+		libhttp.WriteJson(w, http.StatusNotFound, map[string]string{"Error": "Discord commands are not set up"})
+		return
+	}
+
+	body, err := readSlashBody(w, r)
+	if err != nil {
+		libhttp.WriteJson(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	err = libslash.VerifyDiscord(publicKey, r.Header, body, time.Now())
+	if err != nil {
+		libhttp.WriteJson(w, http.StatusUnauthorized, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	command, err := libslash.ParseDiscord(body)
+	if err != nil {
+		libhttp.WriteJson(w, http.StatusBadRequest, map[string]string{"Error": err.Error()})
+		return
+	}
+
+	if command.Ping {
+		writeSlashResponse(w, libslash.DiscordPong(), nil)
+		return
+	}
+
+	var response libslash.Response
+	if command.Action != "" {
+		response = rateFromChat(r, command)
+	} else {
+		response = runSlashCommand(r, command)
+	}
+
+	reply, err := libslash.EncodeDiscord(response)
+	writeSlashResponse(w, reply, err)
+}
+
+// runSlashCommand answers /pun <word> with the puns the search page would show, best rated first
+func runSlashCommand(r *http.Request, command libslash.Command) libslash.Response {
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+	baseURL := config.GetString("base_url")
+
+	if command.Name != "pun" {
+		return libslash.Response{Text: "Unknown command /" + command.Name + ". Try /pun <word>."}
+	}
+
+	fields := strings.Fields(command.Text)
+	if len(fields) == 0 {
+		return libslash.Response{Text: "Usage: /pun <word>"}
+	}
+	word := strings.ToLower(fields[0])
+
+	words, err := models.NewWord(db).QueryHlistString(nil, word)
+	if err == models.ErrNoHomophones {
+		return libslash.Response{Text: fmt.Sprintf("We don't know any homophones of “%v” yet. Here are the words we do know: %v/words/a", word, baseURL)}
+	}
+	if err != nil {
+		logrus.Errorln(err)
+		return libslash.Response{Text: "Something went wrong looking for puns. Please try again."}
+	}
+
+	phrases, err := models.GetPhraseList(words, models.NewPhraseConnection(mongdb))
+	if err != nil {
+		logrus.Errorln(err)
+		return libslash.Response{Text: "Something went wrong looking for puns. Please try again."}
+	}
+	if len(phrases) == 0 {
+		return libslash.Response{Text: fmt.Sprintf("There are no phrases to pun on “%v” yet. Submit one at %v/submit", word, baseURL)}
+	}
+
+	sort.SliceStable(phrases, func(i, j int) bool {
+		return models.AverageRating(phrases[i].PhraseRatings) > models.AverageRating(phrases[j].PhraseRatings)
+	})
+	if len(phrases) > libslash.MaxSections {
+		phrases = phrases[:libslash.MaxSections]
+	}
+
+	puns := models.GeneratePuns(word, words, phrases)
+	userTable := models.NewUser(db)
+
+	response := libslash.Response{
+		Text:   fmt.Sprintf("Puns on “%v”, requested by %v", word, command.UserName),
+		Public: config.GetBool("slash_public"),
+	}
+	for i, phrase := range phrases {
+		author := "[deleted]"
+		if submitter, err := userTable.GetByID(nil, phrase.SubmitterUserID); err == nil {
+			author = submitter.Username
+		}
+
+		section := libslash.Section{
+			Text: fmt.Sprintf("%v\nfrom “%v” by %v: %v/phrases/%v", puns[i], phrase.PhraseText, author, baseURL, phrase.PhraseID.Hex()),
+		}
+		for stars := 1; stars <= 5; stars++ {
+			section.Buttons = append(section.Buttons, libslash.Button{
+				Label:  strconv.Itoa(stars) + "★",
+				Action: fmt.Sprintf("rate:%v:%v", phrase.PhraseID.Hex(), stars),
+			})
+		}
+		response.Sections = append(response.Sections, section)
+	}
+
+	return response
+}
+
+// rateFromChat rates a phrase for the Punocracy user who linked the chat account that pressed a rate button.
+// The reply is only shown to them.
+func rateFromChat(r *http.Request, command libslash.Command) libslash.Response {
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+	mongdb := r.Context().Value("mongodb").(*mongo.Database)
+
+	parts := strings.Split(command.Action, ":")
+	if len(parts) != 3 || parts[0] != "rate" {
+		return libslash.Response{Text: "That button doesn't work anymore."}
+	}
+	phraseID, err := primitive.ObjectIDFromHex(parts[1])
+	stars, starsErr := strconv.Atoi(parts[2])
+	if err != nil || starsErr != nil || stars < 1 || stars > 5 {
+		return libslash.Response{Text: "That button doesn't work anymore."}
+	}
+
+	provider := config.GetString("slash_" + command.Platform + "_identity_provider")
+	identity, err := models.NewIdentity(db).GetByProviderSubject(nil, provider, command.UserID)
+	if err == sql.ErrNoRows {
+		return libslash.Response{Text: fmt.Sprintf(
+			"To rate puns from %v, link your %v account to Punocracy first: %v/account/identities",
+			slashPlatformNames[command.Platform], slashPlatformNames[command.Platform], config.GetString("base_url"),
+		)}
+	}
+	if err != nil {
+		logrus.Errorln(err)
+		return libslash.Response{Text: "Something went wrong rating the pun. Please try again."}
+	}
+
+	user, err := models.NewUser(db).GetByID(nil, identity.UserID)
+	if err != nil {
+		logrus.Errorln(err)
+		return libslash.Response{Text: "Something went wrong rating the pun. Please try again."}
+	}
+
+	phrasesCollection := models.NewPhraseConnection(mongdb)
+	phrase, err := models.GetPhraseByID(phraseID, phrasesCollection)
+	if err != nil || phrase.DisplayPublic != models.Accepted {
+		return libslash.Response{Text: "That phrase can't be rated anymore."}
+	}
+
+	err = ratePhrase(r, user, stars, phrase, phrasesCollection, models.NewUserRatingsConnection(mongdb))
+	if err != nil {
+		logrus.Errorln(err)
+		return libslash.Response{Text: "Something went wrong rating the pun. Please try again."}
+	}
+
+	if stars == 1 {
+		return libslash.Response{Text: fmt.Sprintf("You rated “%v” 1 star.", phrase.PhraseText)}
+	}
+	return libslash.Response{Text: fmt.Sprintf("You rated “%v” %v stars.", phrase.PhraseText, stars)}
+}
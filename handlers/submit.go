@@ -1,20 +1,33 @@
 package handlers
 
 import (
-	"html/template"
 	"net/http"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/punocracy/punocracy/libevent"
 	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/libreputation"
 	"github.com/punocracy/punocracy/models"
 	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type submitPageData struct {
-	CurrentUser *models.UserRow
-	IsCurator   bool
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	Message      string
+	// NeedsVerification is set when the user has to verify their email before submitting
+	NeedsVerification bool
+}
+
+// needsVerification reports whether the config bars user from submitting until their email is verified.
+func needsVerification(r *http.Request, user *models.UserRow) bool {
+	config := r.Context().Value("config").(*viper.Viper)
+
+	return config.GetBool("require_verified_email") && !user.EmailVerified
 }
 
 // TODO: Address illegal access to these views
@@ -32,19 +45,12 @@ func GetSubmit(w http.ResponseWriter, r *http.Request) {
 
 	if !ok {
 		http.Redirect(w, r, "/now", http.StatusFound)
+		return
 	} else {
 		isCurator = currentUser.PermLevel <= models.Curator
 	}
 
-	pageData := submitPageData{currentUser, isCurator}
-
-	tmpl, err := template.ParseFiles("templates/dashboard-nosearch.html.tmpl", "templates/submit.html.tmpl")
-	if err != nil {
-		libhttp.HandleErrorJson(w, err)
-		return
-	}
-
-	tmpl.Execute(w, pageData)
+	renderSubmit(w, r, submitPageData{CurrentUser: currentUser, IsCurator: isCurator, NeedsVerification: needsVerification(r, currentUser)})
 }
 
 // PostSubmit handles the submission of a phrase.
@@ -62,10 +68,18 @@ func PostSubmit(w http.ResponseWriter, r *http.Request) {
 
 	if !ok {
 		http.Redirect(w, r, "/now", http.StatusFound)
+		return
 	} else {
 		isCurator = currentUser.PermLevel <= models.Curator
 	}
 
+	if needsVerification(r, currentUser) {
+		w.WriteHeader(http.StatusForbidden)
+		renderSubmit(w, r, submitPageData{CurrentUser: currentUser, IsCurator: isCurator, NeedsVerification: true})
+		return
+	}
+
+	config := r.Context().Value("config").(*viper.Viper)
 	db := r.Context().Value("db").(*sqlx.DB)
 
 	mongdb := r.Context().Value("mongodb").(*mongo.Database)
@@ -74,19 +88,66 @@ func PostSubmit(w http.ResponseWriter, r *http.Request) {
 	phrasesCollection := models.NewPhraseConnection(mongdb)
 	word := models.NewWord(db)
 
-	err := models.InsertPhrase(phrase, *currentUser, word, phrasesCollection)
-	logrus.Infoln("Before")
+	// Cap the number of phrases a user can have waiting in the curator queue
+	maxUnreviewed := config.GetInt64("max_unreviewed_submissions")
+	if maxUnreviewed > 0 && !isCurator {
+		outstanding, err := models.CountUnreviewedPhrases(*currentUser, phrasesCollection)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+
+		if outstanding >= maxUnreviewed {
+			w.WriteHeader(http.StatusTooManyRequests)
+			renderSubmit(w, r, submitPageData{
+				CurrentUser:  currentUser,
+				IsCurator:    isCurator,
+				ErrorMessage: "You have too many phrases waiting for review. Please wait for a curator to review them before submitting more.",
+			})
+			return
+		}
+	}
+
+	// Trusted users' clean phrases are published without waiting for a curator
+	skipQueue, err := models.NewReputation(db).HasCapability(nil, currentUser.ID, libreputation.SkipQueue)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	events := r.Context().Value("events").(*libevent.Bus)
+
+	message := ""
+	if skipQueue {
+		var inserted models.Phrase
+		inserted, err = models.InsertPhraseSkippingQueue(phrase, *currentUser, word, getModerator(r), events, phrasesCollection)
+		// Publishing without review earns nothing, so trusted users can't farm reputation with it
+		if err == nil && inserted.DisplayPublic == models.Accepted {
+			message = "Your phrase was published."
+		}
+	} else {
+		_, err = models.InsertPhrase(phrase, *currentUser, word, getModerator(r), events, phrasesCollection)
+	}
+	if moderationErr, ok := err.(*models.ModerationError); ok {
+		renderSubmit(w, r, submitPageData{
+			CurrentUser:  currentUser,
+			IsCurator:    isCurator,
+			ErrorMessage: "Your phrase was rejected because it " + moderationErr.Reason + ".",
+		})
+		return
+	}
 	if err != nil {
 		logrus.Errorln(err.Error())
-		logrus.Infoln("After")
 		// TODO: Handle multiple types of errors
 		http.Redirect(w, r, "/now", http.StatusFound)
 		return
 	}
 
-	pageData := submitPageData{currentUser, isCurator}
+	renderSubmit(w, r, submitPageData{CurrentUser: currentUser, IsCurator: isCurator, Message: message})
+}
 
-	tmpl, err := template.ParseFiles("templates/dashboard-nosearch.html.tmpl", "templates/submit.html.tmpl")
+func renderSubmit(w http.ResponseWriter, r *http.Request, pageData submitPageData) {
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/submit.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/viper"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/liblockout"
+	"github.com/punocracy/punocracy/libtotp"
+	"github.com/punocracy/punocracy/models"
+)
+
+// twoFactorLoginTimeout is how long a user has to enter their code after their password.
+const twoFactorLoginTimeout = 5 * time.Minute
+
+type twoFactorPageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	Enabled      bool
+	// Required is set when the user's permission level makes 2FA mandatory
+	Required          bool
+	RecoveryCodesLeft int
+	Secret            string
+	ProvisioningURI   string
+	// RecoveryCodes are only shown right after they are generated
+	RecoveryCodes []string
+}
+
+// completeLogin logs the user in, or if they enabled 2FA, remembers them as pending and asks for a code first.
+// The user's failed logins are only forgiven once they are logged in, so knowing the password doesn't reset
+// the backoff between guesses of the code.
+func completeLogin(w http.ResponseWriter, r *http.Request, user *models.UserRow) {
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+	loginGuard := r.Context().Value("loginGuard").(*liblockout.Guard)
+
+	enabled, err := models.NewTwoFactor(db).IsEnabled(nil, user.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+
+	next := "/now"
+	if enabled {
+		session.Values["twoFactorUserID"] = user.ID
+		session.Values["twoFactorStarted"] = time.Now().Unix()
+		next = "/login/2fa"
+	} else {
+		setSessionUser(session, user)
+	}
+
+	err = session.Save(r, w)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	if !enabled {
+		loginGuard.Succeed(user.Username)
+	}
+
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+func verifySecondFactor(twoFactor *models.TwoFactor, userID int64, code string) (bool, error) {
+	enrollment, err := twoFactor.Get(nil, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if counter, ok := libtotp.Validate(enrollment.Secret, code, time.Now(), 1); ok {
+		return twoFactor.UseCounter(nil, userID, counter)
+	}
+
+	return twoFactor.UseRecoveryCode(nil, userID, libtotp.HashRecoveryCode(code))
+}
+
+func renderTwoFactorLogin(w http.ResponseWriter, r *http.Request, pageData loginPageData) {
+	tmpl, err := parseTemplates(r, "templates/users/users-external.html.tmpl", "templates/users/login-2fa.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// pendingTwoFactorUser returns the user who entered their password but not yet their code.
+func pendingTwoFactorUser(r *http.Request, session *sessions.Session) *models.UserRow {
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	userID, _ := session.Values["twoFactorUserID"].(int64)
+	started, _ := session.Values["twoFactorStarted"].(int64)
+	if userID == 0 || time.Since(time.Unix(started, 0)) > twoFactorLoginTimeout {
+		return nil
+	}
+
+	user, err := models.NewUser(db).GetByID(nil, userID)
+	if err != nil {
+		return nil
+	}
+
+	return user
+}
+
+// GetTwoFactorLogin asks the user for their authenticator or recovery code
+func GetTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	if pendingTwoFactorUser(r, session) == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	renderTwoFactorLogin(w, r, loginPageData{})
+}
+
+// PostTwoFactorLogin checks the code and finishes logging in.
+// Wrong codes count as failed logins, so guessing codes runs into the same backoff and lockouts as guessing passwords.
+func PostTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+	loginGuard := r.Context().Value("loginGuard").(*liblockout.Guard)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+
+	user := pendingTwoFactorUser(r, session)
+	if user == nil {
+		renderLogin(w, r, loginPageData{ErrorMessage: "Your login expired. Please enter your password again."})
+		return
+	}
+
+	ip := libhttp.ClientIP(r)
+
+	if wait := loginGuard.Check(user.Username, ip); wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderTwoFactorLogin(w, r, loginPageData{ErrorMessage: fmt.Sprintf("Too many failed login attempts. Please try again in %v seconds.", seconds)})
+		return
+	}
+
+	ok, err := verifySecondFactor(models.NewTwoFactor(db), user.ID, r.FormValue("Code"))
+	if err != nil && err != sql.ErrNoRows {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	if !ok {
+		failLogin(db, loginGuard, user.Username, ip)
+		renderTwoFactorLogin(w, r, loginPageData{ErrorMessage: "That code is not valid. Please try again."})
+		return
+	}
+
+	loginGuard.Succeed(user.Username)
+
+	delete(session.Values, "twoFactorUserID")
+	delete(session.Values, "twoFactorStarted")
+	setSessionUser(session, user)
+
+	err = session.Save(r, w)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/now", http.StatusFound)
+}
+
+// twoFactorRequired reports whether the config makes 2FA mandatory for the user.
+func twoFactorRequired(r *http.Request, user *models.UserRow) bool {
+	config := r.Context().Value("config").(*viper.Viper)
+
+	return config.GetBool("require_2fa_for_curators") && user.PermLevel <= models.Curator
+}
+
+// GetAccountTwoFactor shows the 2FA status, or the enrollment form with a new secret
+func GetAccountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	renderAccountTwoFactor(w, r, twoFactorPageData{})
+}
+
+func renderAccountTwoFactor(w http.ResponseWriter, r *http.Request, pageData twoFactorPageData) {
+	config := r.Context().Value("config").(*viper.Viper)
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, isCurator := getUser(session)
+
+	pageData.CurrentUser = currentUser
+	pageData.IsCurator = isCurator
+	pageData.Required = twoFactorRequired(r, currentUser)
+
+	twoFactor := models.NewTwoFactor(db)
+
+	enabled, err := twoFactor.IsEnabled(nil, currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	pageData.Enabled = enabled
+
+	if enabled {
+		pageData.RecoveryCodesLeft, err = twoFactor.CountRecoveryCodes(nil, currentUser.ID)
+		if err != nil {
+			libhttp.HandleErrorJson(w, err)
+			return
+		}
+	} else {
+		// The secret stays in the session until a code from it confirms the enrollment
+		secret, ok := session.Values["totpPendingSecret"].(string)
+		if !ok {
+			secret, err = libtotp.GenerateSecret()
+			if err != nil {
+				libhttp.HandleErrorJson(w, err)
+				return
+			}
+
+			session.Values["totpPendingSecret"] = secret
+			err = session.Save(r, w)
+			if err != nil {
+				libhttp.HandleErrorJson(w, err)
+				return
+			}
+		}
+
+		pageData.Secret = secret
+		pageData.ProvisioningURI = libtotp.ProvisioningURI(config.GetString("totp_issuer"), currentUser.Username, secret)
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/two-factor.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// GetAccountTwoFactorQR renders the provisioning URI of the pending secret as a QR code
+func GetAccountTwoFactorQR(w http.ResponseWriter, r *http.Request) {
+	config := r.Context().Value("config").(*viper.Viper)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	secret, ok := session.Values["totpPendingSecret"].(string)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	png, err := qrcode.Encode(libtotp.ProvisioningURI(config.GetString("totp_issuer"), currentUser.Username, secret), qrcode.Medium, 256)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// PostEnableTwoFactor confirms the enrollment with a code from the pending secret and shows new recovery codes
+func PostEnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	secret, ok := session.Values["totpPendingSecret"].(string)
+	if !ok {
+		http.Redirect(w, r, "/account/2fa", http.StatusFound)
+		return
+	}
+
+	counter, ok := libtotp.Validate(secret, r.FormValue("Code"), time.Now(), 1)
+	if !ok {
+		renderAccountTwoFactor(w, r, twoFactorPageData{ErrorMessage: "That code is not valid. Make sure your device's clock is correct and try again."})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	err = models.NewTwoFactor(db).Enable(nil, currentUser.ID, secret, counter, hashes)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	delete(session.Values, "totpPendingSecret")
+	err = session.Save(r, w)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	renderAccountTwoFactor(w, r, twoFactorPageData{RecoveryCodes: codes})
+}
+
+// PostRegenerateRecoveryCodes replaces the recovery codes after checking a code
+func PostRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	twoFactor := models.NewTwoFactor(db)
+
+	ok, err := verifySecondFactor(twoFactor, currentUser.ID, r.FormValue("Code"))
+	if err != nil && err != sql.ErrNoRows {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	if !ok {
+		renderAccountTwoFactor(w, r, twoFactorPageData{ErrorMessage: "That code is not valid."})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	err = twoFactor.ReplaceRecoveryCodes(nil, currentUser.ID, hashes)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	renderAccountTwoFactor(w, r, twoFactorPageData{RecoveryCodes: codes})
+}
+
+// PostDisableTwoFactor turns 2FA off after checking a code, unless it is mandatory for the user
+func PostDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+
+	session, _ := sessionStore.Get(r, "punocracy-session")
+	currentUser, _ := getUser(session)
+
+	if twoFactorRequired(r, currentUser) {
+		w.WriteHeader(http.StatusForbidden)
+		renderAccountTwoFactor(w, r, twoFactorPageData{ErrorMessage: "Two-factor authentication is required for curators and administrators."})
+		return
+	}
+
+	twoFactor := models.NewTwoFactor(db)
+
+	ok, err := verifySecondFactor(twoFactor, currentUser.ID, r.FormValue("Code"))
+	if err != nil && err != sql.ErrNoRows {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+	if !ok {
+		renderAccountTwoFactor(w, r, twoFactorPageData{ErrorMessage: "That code is not valid."})
+		return
+	}
+
+	err = twoFactor.Disable(nil, currentUser.ID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/account/2fa", http.StatusFound)
+}
+
+// newRecoveryCodes returns ten recovery codes and the hashes to store for them.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := libtotp.GenerateRecoveryCodes(10)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = libtotp.HashRecoveryCode(code)
+	}
+
+	return codes, hashes, nil
+}
@@ -2,12 +2,18 @@ package handlers
 
 import (
 	"errors"
-	"html/template"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/punocracy/punocracy/libevent"
 	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/liblockout"
+	"github.com/punocracy/punocracy/libpassword"
 	"github.com/punocracy/punocracy/models"
 	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
@@ -17,7 +23,7 @@ import (
 func GetSignup(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
-	tmpl, err := template.ParseFiles("templates/users/users-external.html.tmpl", "templates/users/signup.html.tmpl")
+	tmpl, err := parseTemplates(r, "templates/users/users-external.html.tmpl", "templates/users/signup.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
@@ -38,7 +44,12 @@ func PostSignup(w http.ResponseWriter, r *http.Request) {
 	password := r.FormValue("Password")
 	passwordAgain := r.FormValue("PasswordAgain")
 
-	_, err := models.NewUser(db).Signup(nil, username, email, password, passwordAgain)
+	passwordPolicy := r.Context().Value("passwordPolicy").(*libpassword.Policy)
+	passwordHasher := r.Context().Value("passwordHasher").(*libpassword.Hasher)
+
+	events := r.Context().Value("events").(*libevent.Bus)
+
+	user, err := models.NewUser(db).Signup(nil, username, email, password, passwordAgain, passwordPolicy, passwordHasher, events)
 	if err != nil {
 		// TODO: Redirect to Login maybe with an error message
 		logrus.Infoln(err)
@@ -46,20 +57,39 @@ func PostSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A failed verification email shouldn't fail the signup, the user can ask for another one
+	err = sendVerificationEmail(r, user)
+	if err != nil {
+		logrus.Errorln(err.Error())
+	}
+
 	PostLogin(w, r)
 }
 
+type loginPageData struct {
+	ErrorMessage string
+	Message      string
+	// Providers are the external identity providers users can log in with
+	Providers []string
+}
+
 // GetLoginWithoutSession generates the login page without checking if an existing user has already logged in
 func GetLoginWithoutSession(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
-	tmpl, err := template.ParseFiles("templates/users/users-external.html.tmpl", "templates/users/login.html.tmpl")
+	renderLogin(w, r, loginPageData{})
+}
+
+func renderLogin(w http.ResponseWriter, r *http.Request, pageData loginPageData) {
+	pageData.Providers = oidcProviderNames(r)
+
+	tmpl, err := parseTemplates(r, "templates/users/users-external.html.tmpl", "templates/users/login.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
 	}
 
-	tmpl.Execute(w, nil)
+	tmpl.Execute(w, pageData)
 }
 
 // GetLogin first checks if a user is already logged in.
@@ -84,33 +114,62 @@ func GetLogin(w http.ResponseWriter, r *http.Request) {
 // PostLogin handles user authentication.
 // If the user has an account in the system, he/she is redirected to the home page
 // If the user used the wrong credentials, redirect them to the login page with an error message.
+// Failed attempts are tracked per username and per IP; too many of them delay further attempts
+// and eventually lock the username or IP out for a while.
 func PostLogin(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 
 	db := r.Context().Value("db").(*sqlx.DB)
-	sessionStore := r.Context().Value("sessionStore").(sessions.Store)
+	loginGuard := r.Context().Value("loginGuard").(*liblockout.Guard)
+	passwordHasher := r.Context().Value("passwordHasher").(*libpassword.Hasher)
 
 	username := r.FormValue("Username")
 	password := r.FormValue("Password")
+	ip := libhttp.ClientIP(r)
+
+	if wait := loginGuard.Check(username, ip); wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderLogin(w, r, loginPageData{ErrorMessage: fmt.Sprintf("Too many failed login attempts. Please try again in %v seconds.", seconds)})
+		return
+	}
 
 	u := models.NewUser(db)
 
-	user, err := u.GetUserByUsernameAndPassword(nil, username, password)
+	user, err := u.GetUserByUsernameAndPassword(nil, username, password, passwordHasher)
 	if err != nil {
 		logrus.Errorln(err.Error())
+
+		failLogin(db, loginGuard, username, ip)
+
 		http.Redirect(w, r, "/login", http.StatusFound)
+		return
 	}
 
-	session, _ := sessionStore.Get(r, "punocracy-session")
-	session.Values["user"] = user
+	// The failure counter is only reset once the second factor checked out too, see completeLogin
+	completeLogin(w, r, user)
+}
 
-	err = session.Save(r, w)
-	if err != nil {
-		libhttp.HandleErrorJson(w, err)
-		return
+// failLogin counts a failed login attempt and records any lockout it causes.
+func failLogin(db *sqlx.DB, loginGuard *liblockout.Guard, username, ip string) {
+	usernameLocked, ipLocked := loginGuard.Fail(username, ip)
+	if usernameLocked {
+		recordLockout(db, username, ip, models.LockoutByUsername, loginGuard.Usernames.Check(username))
 	}
+	if ipLocked {
+		recordLockout(db, username, ip, models.LockoutByIP, loginGuard.IPs.Check(ip))
+	}
+}
 
-	http.Redirect(w, r, "/now", 302)
+// recordLockout keeps a lockout notification for administrators
+func recordLockout(db *sqlx.DB, username, ip, reason string, duration time.Duration) {
+	logrus.Infoln("Login locked out by", reason, "for", username, "from", ip)
+
+	err := models.NewLoginLockout(db).Record(nil, username, ip, reason, time.Now().Add(duration))
+	if err != nil {
+		logrus.Errorln(err.Error())
+	}
 }
 
 // GetLogout deletes the current user from the session and redirects to the main page
@@ -121,7 +180,8 @@ func GetLogout(w http.ResponseWriter, r *http.Request) {
 
 	session, _ := sessionStore.Get(r, "punocracy-session")
 
-	delete(session.Values, "user")
+	// Deletes the stored session as well, so the cookie can't be replayed
+	session.Options.MaxAge = -1
 	session.Save(r, w)
 
 	http.Redirect(w, r, "/now", 302)
@@ -164,17 +224,12 @@ func PutUsersID(w http.ResponseWriter, r *http.Request) {
 	password := r.FormValue("Password")
 	passwordAgain := r.FormValue("PasswordAgain")
 
-	u := models.NewUser(db)
+	passwordPolicy := r.Context().Value("passwordPolicy").(*libpassword.Policy)
+	passwordHasher := r.Context().Value("passwordHasher").(*libpassword.Hasher)
 
-	currentUser, err = u.UpdateUsernameAndPasswordByID(nil, currentUser.ID, currentUser.Username, password, passwordAgain)
-	if err != nil {
-		libhttp.HandleErrorJson(w, err)
-		return
-	}
+	u := models.NewUser(db)
 
-	// Update currentUser stored in session.
-	session.Values["user"] = currentUser
-	err = session.Save(r, w)
+	currentUser, err = u.UpdateUsernameAndPasswordByID(nil, currentUser.ID, currentUser.Username, password, passwordAgain, passwordPolicy, passwordHasher)
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
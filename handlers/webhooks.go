@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/models"
+)
+
+// webhookLogSize is how many deliveries the delivery log shows
+const webhookLogSize = 100
+
+type webhooksPageData struct {
+	CurrentUser  *models.UserRow
+	IsCurator    bool
+	ErrorMessage string
+	Webhooks     []models.WebhookRow
+	Events       []string
+	// URL and SelectedEvents refill the form after an error
+	URL            string
+	SelectedEvents map[string]bool
+}
+
+type webhookPageData struct {
+	CurrentUser *models.UserRow
+	IsCurator   bool
+	Webhook     *models.WebhookRow
+	Deliveries  []models.WebhookDeliveryRow
+	Redelivered bool
+}
+
+func getWebhookIDFromPath(r *http.Request) (int64, error) {
+	return strconv.ParseInt(mux.Vars(r)["webhookID"], 10, 64)
+}
+
+// GetAdminWebhooks lists the webhooks and lets administrators register new ones
+func GetAdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	renderAdminWebhooks(w, r, webhooksPageData{CurrentUser: currentUser, SelectedEvents: map[string]bool{}})
+}
+
+// PostAdminWebhooks registers a webhook
+func PostAdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	r.ParseForm()
+
+	webhook, err := models.NewWebhook(db).Create(nil, r.FormValue("URL"), r.Form["Events"], *currentUser)
+	if err == models.ErrInvalidWebhookURL || err == models.ErrPrivateWebhookHost || err == models.ErrNoWebhookEvents || err == models.ErrUnknownWebhookEvent {
+		pageData := webhooksPageData{CurrentUser: currentUser, URL: r.FormValue("URL"), SelectedEvents: map[string]bool{}}
+		for _, event := range r.Form["Events"] {
+			pageData.SelectedEvents[event] = true
+		}
+
+		switch err {
+		case models.ErrInvalidWebhookURL:
+			pageData.ErrorMessage = "Enter an http or https URL to deliver events to."
+		case models.ErrPrivateWebhookHost:
+			pageData.ErrorMessage = "Webhooks can't be delivered to this server's own network."
+		case models.ErrNoWebhookEvents:
+			pageData.ErrorMessage = "Pick at least one event."
+		default:
+			pageData.ErrorMessage = "One of the events is unknown."
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		renderAdminWebhooks(w, r, pageData)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	logrus.Infoln("Webhook", webhook.ID, "registered by", currentUser.Username)
+
+	http.Redirect(w, r, "/admin/webhooks/"+strconv.FormatInt(webhook.ID, 10), http.StatusFound)
+}
+
+func renderAdminWebhooks(w http.ResponseWriter, r *http.Request, pageData webhooksPageData) {
+	w.Header().Set("Content-Type", "text/html")
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	webhooks, err := models.NewWebhook(db).All(nil)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData.IsCurator = true
+	pageData.Webhooks = webhooks
+	pageData.Events = models.WebhookEvents
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/admin/webhooks.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// GetAdminWebhook shows a webhook's secret and delivery log
+func GetAdminWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+	webhooks := models.NewWebhook(db)
+
+	webhookID, err := getWebhookIDFromPath(r)
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	webhook, err := webhooks.GetByID(nil, webhookID)
+	if err == sql.ErrNoRows {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	deliveries, err := webhooks.Deliveries(nil, webhookID, webhookLogSize)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	pageData := webhookPageData{
+		CurrentUser: currentUser,
+		IsCurator:   true,
+		Webhook:     webhook,
+		Deliveries:  deliveries,
+		Redelivered: r.URL.Query().Get("redelivered") != "",
+	}
+
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/admin/webhook.html.tmpl")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	tmpl.Execute(w, pageData)
+}
+
+// PostAdminWebhookActive pauses or resumes a webhook
+func PostAdminWebhookActive(w http.ResponseWriter, r *http.Request) {
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	webhookID, err := getWebhookIDFromPath(r)
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	err = models.NewWebhook(db).SetActive(nil, webhookID, r.FormValue("active") == "true")
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/webhooks/"+strconv.FormatInt(webhookID, 10), http.StatusFound)
+}
+
+// PostAdminWebhookDelete removes a webhook and its delivery log
+func PostAdminWebhookDelete(w http.ResponseWriter, r *http.Request) {
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	webhookID, err := getWebhookIDFromPath(r)
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	err = models.NewWebhook(db).Delete(nil, webhookID)
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	logrus.Infoln("Webhook", webhookID, "deleted by", currentUser.Username)
+
+	http.Redirect(w, r, "/admin/webhooks", http.StatusFound)
+}
+
+// PostAdminWebhookRedeliver sends a logged delivery again
+func PostAdminWebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	currentUser := getAdmin(w, r)
+	if currentUser == nil {
+		return
+	}
+
+	db := r.Context().Value("db").(*sqlx.DB)
+
+	webhookID, err := getWebhookIDFromPath(r)
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(mux.Vars(r)["deliveryID"], 10, 64)
+	if err != nil {
+		renderNotFound(w, r)
+		return
+	}
+
+	err = models.NewWebhook(db).Redeliver(nil, webhookID, deliveryID)
+	if err == models.ErrWebhookDeliveryNotFound {
+		renderNotFound(w, r)
+		return
+	}
+	if err != nil {
+		libhttp.HandleErrorJson(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/webhooks/"+strconv.FormatInt(webhookID, 10)+"?redelivered=1", http.StatusFound)
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"html/template"
 	"net/http"
 
 	"github.com/punocracy/punocracy/libhttp"
@@ -51,7 +50,7 @@ func GetWords(w http.ResponseWriter, r *http.Request) {
 
 	pageData := wordPageData{CurrentUser: currentUser, IsCurator: isCurator, Words: words}
 
-	tmpl, err := template.ParseFiles("templates/dashboard-nosearch.html.tmpl", "templates/word.html.tmpl")
+	tmpl, err := parseTemplates(r, "templates/dashboard-nosearch.html.tmpl", "templates/word.html.tmpl")
 	if err != nil {
 		libhttp.HandleErrorJson(w, err)
 		return
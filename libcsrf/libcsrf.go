@@ -0,0 +1,50 @@
+// Package libcsrf derives and checks the tokens that protect forms against cross-site request forgery.
+package libcsrf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+// FieldName is the form field a token is submitted in.
+const FieldName = "csrf_token"
+
+// HeaderName is the header a token can be submitted in instead, for scripts.
+const HeaderName = "X-CSRF-Token"
+
+// Token derives the token for binding, a value only the legitimate client knows, like its session ID.
+func Token(secret []byte, binding string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("csrf:" + binding))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Valid reports whether token is the token for binding.
+func Valid(secret []byte, binding, token string) bool {
+	if binding == "" || token == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(token), []byte(Token(secret, binding)))
+}
+
+// FromRequest returns the token submitted with r, from the header or the form.
+func FromRequest(r *http.Request) string {
+	if token := r.Header.Get(HeaderName); token != "" {
+		return token
+	}
+
+	return r.FormValue(FieldName)
+}
+
+// Safe reports whether the request method can't change state and needs no token.
+func Safe(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,45 @@
+package libcsrf
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestToken(t *testing.T) {
+	secret := []byte("zu7HZy1Da2abXWPP")
+	token := Token(secret, "session-a")
+
+	if !Valid(secret, "session-a", token) {
+		t.Error("Token should be valid for its own session.")
+	}
+	if Valid(secret, "session-b", token) {
+		t.Error("Token should not be valid for another session.")
+	}
+	if Valid([]byte("another secret"), "session-a", token) {
+		t.Error("Token should not be valid with another secret.")
+	}
+	if Valid(secret, "", Token(secret, "")) || Valid(secret, "session-a", "") {
+		t.Error("Empty binding or token should never be valid.")
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	form := url.Values{FieldName: {"from-form"}}
+	r := httptest.NewRequest("POST", "/submit", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if token := FromRequest(r); token != "from-form" {
+		t.Errorf("Token should be read from the form. Received: %v", token)
+	}
+
+	r.Header.Set(HeaderName, "from-header")
+	if token := FromRequest(r); token != "from-header" {
+		t.Errorf("Header should take precedence. Received: %v", token)
+	}
+
+	if !Safe("GET") || Safe("POST") || Safe("DELETE") {
+		t.Error("Only read-only methods should be safe.")
+	}
+}
@@ -0,0 +1,161 @@
+// Package libevent is an in-process publish/subscribe bus.
+// Every subscriber has its own goroutine and bounded queue, so slow side effects never hold up publishers.
+// Side effects that must not be lost subscribe synchronously instead.
+package libevent
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var ErrDrainTimeout = errors.New("libevent: subscribers did not drain in time")
+
+// Event is something that happened. Subscribers tell events apart with a type switch.
+type Event interface {
+	EventName() string
+}
+
+// Handler reacts to an event
+type Handler func(Event)
+
+type subscriber struct {
+	name    string
+	queue   chan Event
+	handle  Handler
+	dropped uint64
+}
+
+// Bus delivers published events to its subscribers.
+// A nil *Bus is valid and drops everything, which is handy in tests.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []*subscriber
+	synchronous []*subscriber
+	closed      bool
+	running     sync.WaitGroup
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe starts handing events to handle, in the order they were published.
+// At most queueSize events wait for it; further events are dropped until it catches up.
+func (b *Bus) Subscribe(name string, queueSize int, handle Handler) {
+	s := &subscriber{name: name, queue: make(chan Event, queueSize), handle: handle}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.subscribers = append(b.subscribers, s)
+
+	b.running.Add(1)
+	go func() {
+		defer b.running.Done()
+
+		for event := range s.queue {
+			s.run(event)
+		}
+	}()
+}
+
+// SubscribeSync hands events to handle in the publisher's goroutine, before Publish returns.
+// Nothing is queued, so no event is dropped, but handle holds up the publisher and should be quick,
+// like writing the event to an outbox. Synchronous subscribers get events published after Close as well.
+func (b *Bus) SubscribeSync(name string, handle Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.synchronous = append(b.synchronous, &subscriber{name: name, handle: handle})
+}
+
+// run handles one event, surviving a panicking handler so the subscriber keeps going
+func (s *subscriber) run(event Event) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logrus.Errorln("Subscriber", s.name, "panicked handling", event.EventName(), recovered)
+		}
+	}()
+
+	s.handle(event)
+}
+
+// Publish queues the event for every subscriber without waiting for them, then runs the synchronous subscribers.
+// Events published after Close are dropped, except for synchronous subscribers.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	synchronous := b.synchronous
+	if !b.closed {
+		for _, s := range b.subscribers {
+			select {
+			case s.queue <- event:
+			default:
+				atomic.AddUint64(&s.dropped, 1)
+				logrus.Warnln("Subscriber", s.name, "is behind, dropping", event.EventName())
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	// Outside the lock, so synchronous subscribers can publish events of their own
+	for _, s := range synchronous {
+		s.run(event)
+	}
+}
+
+// Dropped returns how many events the named subscriber missed because its queue was full
+func (b *Bus) Dropped(name string) uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var dropped uint64
+	for _, s := range b.subscribers {
+		if s.name == name {
+			dropped += atomic.LoadUint64(&s.dropped)
+		}
+	}
+
+	return dropped
+}
+
+// Close stops accepting events and waits up to timeout for subscribers to handle the ones already queued
+func (b *Bus) Close(timeout time.Duration) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, s := range b.subscribers {
+			close(s.queue)
+		}
+	}
+	b.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		b.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-time.After(timeout):
+		return ErrDrainTimeout
+	}
+}
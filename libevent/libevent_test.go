@@ -0,0 +1,173 @@
+package libevent
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testEvent struct {
+	n int
+}
+
+func (e testEvent) EventName() string {
+	return "test"
+}
+
+func TestPublish(t *testing.T) {
+	bus := NewBus()
+
+	var mu sync.Mutex
+	received := map[string][]int{}
+	for _, name := range []string{"first", "second"} {
+		name := name
+		bus.Subscribe(name, 10, func(event Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name] = append(received[name], event.(testEvent).n)
+		})
+	}
+
+	for i := 1; i <= 5; i++ {
+		bus.Publish(testEvent{i})
+	}
+
+	if err := bus.Close(time.Second); err != nil {
+		t.Fatalf("Closing should drain the queues. Error: %v", err)
+	}
+
+	expected := []int{1, 2, 3, 4, 5}
+	for _, name := range []string{"first", "second"} {
+		if !reflect.DeepEqual(received[name], expected) {
+			t.Errorf("Every subscriber should get every event in order. %v received: %v", name, received[name])
+		}
+	}
+
+	bus.Publish(testEvent{6})
+	if len(received["first"]) != 5 {
+		t.Errorf("Events published after Close should be dropped. Received: %v", received["first"])
+	}
+}
+
+func TestBoundedQueue(t *testing.T) {
+	bus := NewBus()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	handled := 0
+	bus.Subscribe("slow", 2, func(event Event) {
+		started <- struct{}{}
+		<-release
+		handled++
+	})
+
+	bus.Publish(testEvent{1})
+	<-started
+
+	// One event is being handled, two fit in the queue and the rest are dropped
+	for i := 2; i <= 5; i++ {
+		bus.Publish(testEvent{i})
+	}
+
+	if dropped := bus.Dropped("slow"); dropped != 2 {
+		t.Errorf("Events that don't fit in the queue should be dropped. Received: %v", dropped)
+	}
+
+	go func() {
+		for range started {
+		}
+	}()
+	close(release)
+
+	if err := bus.Close(time.Second); err != nil {
+		t.Fatalf("Closing should drain the queue. Error: %v", err)
+	}
+	if handled != 3 {
+		t.Errorf("Queued events should be handled before Close returns. Received: %v", handled)
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	bus := NewBus()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	bus.Subscribe("stuck", 1, func(event Event) {
+		<-release
+	})
+	bus.Publish(testEvent{1})
+
+	if err := bus.Close(10 * time.Millisecond); err != ErrDrainTimeout {
+		t.Errorf("Close should give up on subscribers that don't finish. Received: %v", err)
+	}
+}
+
+func TestSubscribeSync(t *testing.T) {
+	bus := NewBus()
+
+	// A stuck subscriber with a full queue must not cost the synchronous one any events
+	release := make(chan struct{})
+	bus.Subscribe("stuck", 1, func(event Event) {
+		<-release
+	})
+
+	received := []int{}
+	bus.SubscribeSync("outbox", func(event Event) {
+		n := event.(testEvent).n
+		received = append(received, n)
+		if n == 2 {
+			// Publishing from a synchronous subscriber should not deadlock
+			bus.Publish(testEvent{20})
+		}
+	})
+
+	for i := 1; i <= 5; i++ {
+		bus.Publish(testEvent{i})
+	}
+
+	expected := []int{1, 2, 20, 3, 4, 5}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Synchronous subscribers should get every event before Publish returns. Received: %v", received)
+	}
+
+	close(release)
+	bus.Close(time.Second)
+
+	bus.Publish(testEvent{6})
+	if len(received) != 7 {
+		t.Errorf("Synchronous subscribers should get events published after Close. Received: %v", received)
+	}
+}
+
+func TestPanickingSubscriber(t *testing.T) {
+	bus := NewBus()
+
+	handled := 0
+	bus.Subscribe("flaky", 10, func(event Event) {
+		if event.(testEvent).n == 1 {
+			panic("boom")
+		}
+		handled++
+	})
+
+	bus.Publish(testEvent{1})
+	bus.Publish(testEvent{2})
+
+	if err := bus.Close(time.Second); err != nil {
+		t.Fatalf("Closing should drain the queue. Error: %v", err)
+	}
+	if handled != 1 {
+		t.Errorf("A panic should not stop the subscriber. Received: %v", handled)
+	}
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+
+	bus.Publish(testEvent{1})
+	if err := bus.Close(time.Second); err != nil {
+		t.Errorf("Closing a nil bus should do nothing. Received: %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+// Package libfeed writes syndication feeds as Atom, RSS 2.0 or JSON Feed,
+// and serves them with ETag and Last-Modified so readers can poll cheaply.
+package libfeed
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Format is a feed format, named after the file extension used for it
+type Format string
+
+// Supported formats
+const (
+	Atom Format = "atom"
+	RSS  Format = "rss"
+	JSON Format = "json"
+)
+
+var ErrUnknownFormat = errors.New("libfeed: unknown feed format")
+
+// Item is one entry of a feed
+type Item struct {
+	// ID must never change for the same item, even if its link does
+	ID        string
+	Title     string
+	Link      string
+	Author    string
+	Content   string
+	Published time.Time
+	Updated   time.Time
+}
+
+// Feed is a list of items, newest first
+type Feed struct {
+	ID    string
+	Title string
+	// Description is shown by readers that support it
+	Description string
+	// Link is the HTML page the feed mirrors
+	Link  string
+	Items []Item
+	// Ranked feeds, like the best rated phrases, change order without their items being updated.
+	// They are served without Last-Modified so readers only go by the ETag.
+	Ranked bool
+}
+
+// Updated returns when an item of the feed last changed, or the zero time for empty feeds
+func (f *Feed) Updated() time.Time {
+	updated := time.Time{}
+	for _, item := range f.Items {
+		if item.Updated.After(updated) {
+			updated = item.Updated
+		}
+	}
+
+	return updated
+}
+
+// ContentType returns the media type of a format
+func ContentType(format Format) string {
+	switch format {
+	case Atom:
+		return "application/atom+xml; charset=utf-8"
+	case RSS:
+		return "application/rss+xml; charset=utf-8"
+	case JSON:
+		return "application/feed+json; charset=utf-8"
+	}
+
+	return ""
+}
+
+// Encode writes the feed in format. selfURL is the address the feed is served at.
+func (f *Feed) Encode(w io.Writer, format Format, selfURL string) error {
+	switch format {
+	case Atom:
+		return encodeXML(w, f.atom(selfURL))
+	case RSS:
+		return encodeXML(w, f.rss(selfURL))
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(f.jsonFeed(selfURL))
+	}
+
+	return ErrUnknownFormat
+}
+
+// Serve writes the feed as the response to r, or 304 Not Modified when the reader's copy is current
+func Serve(w http.ResponseWriter, r *http.Request, feed *Feed, format Format, selfURL string) error {
+	var body bytes.Buffer
+	if err := feed.Encode(&body, format, selfURL); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+
+	w.Header().Set("Content-Type", ContentType(format))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	modified := feed.Updated()
+	if feed.Ranked {
+		modified = time.Time{}
+	}
+
+	// ServeContent answers If-None-Match and If-Modified-Since for us, and ignores the latter for the zero time
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body.Bytes()))
+
+	return nil
+}
+
+func encodeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(v)
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     atomText    `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published,omitempty"`
+	Author    *atomPerson `xml:"author"`
+	Link      atomLink    `xml:"link"`
+	Content   atomText    `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    atomText    `xml:"title"`
+	Subtitle *atomText   `xml:"subtitle"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+func (f *Feed) atom(selfURL string) atomFeed {
+	feed := atomFeed{
+		ID:      f.ID,
+		Title:   atomText{Type: "text", Body: f.Title},
+		Updated: f.Updated().UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+			{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+		},
+		Entries: []atomEntry{},
+	}
+	if f.Description != "" {
+		feed.Subtitle = &atomText{Type: "text", Body: f.Description}
+	}
+
+	for _, item := range f.Items {
+		entry := atomEntry{
+			ID:      item.ID,
+			Title:   atomText{Type: "text", Body: item.Title},
+			Updated: item.Updated.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: item.Link, Rel: "alternate", Type: "text/html"},
+			Content: atomText{Type: "text", Body: item.Content},
+		}
+		if !item.Published.IsZero() {
+			entry.Published = item.Published.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Body        string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	Description string  `xml:"description"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName  xml.Name   `xml:"rss"`
+	Version  string     `xml:"version,attr"`
+	AtomNS   string     `xml:"xmlns:atom,attr"`
+	DublinNS string     `xml:"xmlns:dc,attr"`
+	Channel  rssChannel `xml:"channel"`
+}
+
+func (f *Feed) rss(selfURL string) rssFeed {
+	description := f.Description
+	if description == "" {
+		description = f.Title
+	}
+
+	channel := rssChannel{
+		Title:       f.Title,
+		Link:        f.Link,
+		Description: description,
+		AtomLink:    atomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+		Items:       []rssItem{},
+	}
+	if updated := f.Updated(); !updated.IsZero() {
+		channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, item := range f.Items {
+		published := item.Published
+		if published.IsZero() {
+			published = item.Updated
+		}
+
+		channel.Items = append(channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{Body: item.ID},
+			PubDate:     published.UTC().Format(time.RFC1123Z),
+			Creator:     item.Author,
+			Description: item.Content,
+		})
+	}
+
+	return rssFeed{
+		Version:  "2.0",
+		AtomNS:   "http://www.w3.org/2005/Atom",
+		DublinNS: "http://purl.org/dc/elements/1.1/",
+		Channel:  channel,
+	}
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url"`
+	Title         string       `json:"title"`
+	ContentText   string       `json:"content_text"`
+	DatePublished string       `json:"date_published,omitempty"`
+	DateModified  string       `json:"date_modified"`
+	Authors       []jsonAuthor `json:"authors,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string     `json:"version"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	HomePageURL string     `json:"home_page_url"`
+	FeedURL     string     `json:"feed_url"`
+	Items       []jsonItem `json:"items"`
+}
+
+func (f *Feed) jsonFeed(selfURL string) jsonFeed {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		Description: f.Description,
+		HomePageURL: f.Link,
+		FeedURL:     selfURL,
+		Items:       []jsonItem{},
+	}
+
+	for _, item := range f.Items {
+		entry := jsonItem{
+			ID:           item.ID,
+			URL:          item.Link,
+			Title:        item.Title,
+			ContentText:  item.Content,
+			DateModified: item.Updated.UTC().Format(time.RFC3339),
+		}
+		if !item.Published.IsZero() {
+			entry.DatePublished = item.Published.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			entry.Authors = []jsonAuthor{{Name: item.Author}}
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+
+	return feed
+}
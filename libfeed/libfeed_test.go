@@ -0,0 +1,158 @@
+package libfeed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFeedForTest() *Feed {
+	published := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+	return &Feed{
+		ID:    "tag:example.com,2019:feeds/new",
+		Title: "New Puns",
+		Link:  "https://example.com/now",
+		Items: []Item{
+			{
+				ID:        "tag:example.com,2019:phrases/2",
+				Title:     "Time flies like an arrow & fruit flies like a banana",
+				Link:      "https://example.com/phrases/2",
+				Author:    "groucho",
+				Content:   "Time flies like an arrow & fruit flies like a banana",
+				Published: published,
+				Updated:   published.Add(2 * time.Hour),
+			},
+			{
+				ID:        "tag:example.com,2019:phrases/1",
+				Title:     "I used to be a banker but I lost interest",
+				Link:      "https://example.com/phrases/1",
+				Published: published,
+				Updated:   published.Add(time.Hour),
+			},
+		},
+	}
+}
+
+func TestUpdated(t *testing.T) {
+	feed := newFeedForTest()
+
+	expected := time.Date(2019, time.December, 1, 14, 0, 0, 0, time.UTC)
+	if !feed.Updated().Equal(expected) {
+		t.Errorf("A feed is updated when its latest item is. Received: %v", feed.Updated())
+	}
+
+	if !(&Feed{}).Updated().IsZero() {
+		t.Errorf("Empty feeds should have the zero updated time")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	feed := newFeedForTest()
+
+	for _, format := range []Format{Atom, RSS} {
+		var buf bytes.Buffer
+		if err := feed.Encode(&buf, format, "https://example.com/feeds/new."+string(format)); err != nil {
+			t.Fatalf("Encoding %v should work. Error: %v", format, err)
+		}
+
+		var parsed struct{}
+		if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+			t.Errorf("The %v feed should be well formed XML. Error: %v", format, err)
+		}
+		if !strings.Contains(buf.String(), "fruit flies like a banana") || !strings.Contains(buf.String(), "tag:example.com,2019:phrases/2") {
+			t.Errorf("The %v feed should contain the items. Received: %v", format, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := feed.Encode(&buf, JSON, "https://example.com/feeds/new.json"); err != nil {
+		t.Fatalf("Encoding JSON should work. Error: %v", err)
+	}
+
+	var parsed jsonFeed
+	if err := json.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("The JSON feed should be valid JSON. Error: %v", err)
+	}
+	if len(parsed.Items) != 2 || parsed.Items[0].DateModified != "2019-12-01T14:00:00Z" || parsed.Items[1].Authors != nil {
+		t.Errorf("The JSON feed should contain the items. Received: %+v", parsed)
+	}
+
+	if err := feed.Encode(&buf, Format("yaml"), ""); err != ErrUnknownFormat {
+		t.Errorf("Unknown formats should be refused. Received: %v", err)
+	}
+}
+
+func TestServeConditionalGet(t *testing.T) {
+	feed := newFeedForTest()
+
+	first := httptest.NewRecorder()
+	Serve(first, httptest.NewRequest("GET", "/feeds/new.atom", nil), feed, Atom, "https://example.com/feeds/new.atom")
+
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("Feeds should be served with an ETag and Last-Modified. Received: %v %v", first.Code, first.Header())
+	}
+
+	request := httptest.NewRequest("GET", "/feeds/new.atom", nil)
+	request.Header.Set("If-None-Match", etag)
+	second := httptest.NewRecorder()
+	Serve(second, request, feed, Atom, "https://example.com/feeds/new.atom")
+	if second.Code != http.StatusNotModified {
+		t.Errorf("A matching ETag should give 304 Not Modified. Received: %v", second.Code)
+	}
+
+	request = httptest.NewRequest("GET", "/feeds/new.atom", nil)
+	request.Header.Set("If-Modified-Since", feed.Updated().Format(http.TimeFormat))
+	third := httptest.NewRecorder()
+	Serve(third, request, feed, Atom, "https://example.com/feeds/new.atom")
+	if third.Code != http.StatusNotModified {
+		t.Errorf("An unchanged feed should give 304 Not Modified. Received: %v", third.Code)
+	}
+
+	request = httptest.NewRequest("GET", "/feeds/new.atom", nil)
+	request.Header.Set("If-Modified-Since", feed.Updated().Add(-time.Minute).Format(http.TimeFormat))
+	fourth := httptest.NewRecorder()
+	Serve(fourth, request, feed, Atom, "https://example.com/feeds/new.atom")
+	if fourth.Code != http.StatusOK {
+		t.Errorf("A feed updated since should be sent again. Received: %v", fourth.Code)
+	}
+}
+
+func TestServeRanked(t *testing.T) {
+	feed := newFeedForTest()
+	feed.Ranked = true
+
+	first := httptest.NewRecorder()
+	Serve(first, httptest.NewRequest("GET", "/feeds/top.atom", nil), feed, Atom, "https://example.com/feeds/top.atom")
+
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") != "" {
+		t.Fatalf("Ranked feeds should be served with an ETag only. Received: %v %v", first.Code, first.Header())
+	}
+
+	// Reordering the items doesn't update them
+	feed.Items[0], feed.Items[1] = feed.Items[1], feed.Items[0]
+
+	request := httptest.NewRequest("GET", "/feeds/top.atom", nil)
+	request.Header.Set("If-None-Match", etag)
+	request.Header.Set("If-Modified-Since", feed.Updated().Format(http.TimeFormat))
+	second := httptest.NewRecorder()
+	Serve(second, request, feed, Atom, "https://example.com/feeds/top.atom")
+	if second.Code != http.StatusOK {
+		t.Errorf("A reordered ranked feed should be sent again. Received: %v", second.Code)
+	}
+
+	request = httptest.NewRequest("GET", "/feeds/top.atom", nil)
+	request.Header.Set("If-Modified-Since", feed.Updated().Format(http.TimeFormat))
+	third := httptest.NewRecorder()
+	Serve(third, request, feed, Atom, "https://example.com/feeds/top.atom")
+	if third.Code != http.StatusOK {
+		t.Errorf("Ranked feeds should ignore If-Modified-Since. Received: %v", third.Code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 )
@@ -55,3 +56,26 @@ func HandleErrorJson(w http.ResponseWriter, err error) {
 	errJson, _ := json.Marshal(errMap)
 	http.Error(w, string(errJson), http.StatusInternalServerError)
 }
+
+// WriteJson writes data as a JSON response with the given status code.
+func WriteJson(w http.ResponseWriter, status int, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		HandleErrorJson(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// ClientIP returns the IP address of the client that sent the request.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -1,6 +1,8 @@
 package libhttp
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -18,3 +20,30 @@ func TestParseBasicAuth(t *testing.T) {
 		t.Error("Parsing basic auth should work.")
 	}
 }
+
+func TestClientIP(t *testing.T) {
+	r := &http.Request{RemoteAddr: "192.0.2.1:1234"}
+	if ip := ClientIP(r); ip != "192.0.2.1" {
+		t.Errorf("IP is not as expected. Received: %v", ip)
+	}
+
+	r.RemoteAddr = "[2001:db8::1]:1234"
+	if ip := ClientIP(r); ip != "2001:db8::1" {
+		t.Errorf("IPv6 address is not as expected. Received: %v", ip)
+	}
+}
+
+func TestWriteJson(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteJson(w, http.StatusCreated, map[string]int{"stars": 5})
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Status code is not as expected. Received: %v", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content type is not as expected. Received: %v", contentType)
+	}
+	if body := w.Body.String(); body != `{"stars":5}` {
+		t.Errorf("Body is not as expected. Received: %v", body)
+	}
+}
@@ -0,0 +1,182 @@
+// Package liblockout tracks failed login attempts and applies exponential backoff and temporary lockouts.
+package liblockout
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy configures when a key starts backing off and when it is locked out.
+type Policy struct {
+	// BackoffAfter is the number of consecutive failures allowed before delays start
+	BackoffAfter int
+	// BaseDelay is the first delay; it doubles with every further failure
+	BaseDelay time.Duration
+	// LockoutAfter is the number of consecutive failures that locks the key out
+	LockoutAfter int
+	// LockoutDuration is how long a lockout lasts
+	LockoutDuration time.Duration
+}
+
+type record struct {
+	failures    int
+	lastFailure time.Time
+	blockedTill time.Time
+	locked      bool
+}
+
+// Tracker counts consecutive failures per key.
+type Tracker struct {
+	policy  Policy
+	mutex   sync.Mutex
+	records map[string]*record
+
+	lastSweep time.Time
+
+	// Now returns the current time. It can be replaced in tests.
+	Now func() time.Time
+}
+
+// NewTracker is the constructor for Tracker.
+func NewTracker(policy Policy) *Tracker {
+	return &Tracker{
+		policy:  policy,
+		records: make(map[string]*record),
+		Now:     time.Now,
+	}
+}
+
+// Check returns how long the key has to wait before its next attempt, or 0 if it may try now.
+func (t *Tracker) Check(key string) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	r := t.current(key)
+	if r == nil {
+		return 0
+	}
+
+	if wait := r.blockedTill.Sub(t.Now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Fail records a failed attempt for the key.
+// It returns true when this failure starts a lockout, so the caller can report it.
+func (t *Tracker) Fail(key string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	r := t.current(key)
+	if r == nil {
+		r = &record{}
+		t.records[key] = r
+	}
+
+	now := t.Now()
+	r.failures++
+	r.lastFailure = now
+
+	if t.policy.LockoutAfter > 0 && r.failures >= t.policy.LockoutAfter {
+		r.blockedTill = now.Add(t.policy.LockoutDuration)
+		startsLockout := !r.locked
+		r.locked = true
+		return startsLockout
+	}
+
+	if t.policy.BackoffAfter > 0 && r.failures > t.policy.BackoffAfter {
+		delay := t.policy.BaseDelay << uint(r.failures-t.policy.BackoffAfter-1)
+		if delay <= 0 || (t.policy.LockoutDuration > 0 && delay > t.policy.LockoutDuration) {
+			delay = t.policy.LockoutDuration
+		}
+		r.blockedTill = now.Add(delay)
+	}
+
+	return false
+}
+
+// Reset forgets the failures of a key, e.g. after a successful login.
+func (t *Tracker) Reset(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.records, key)
+}
+
+// current returns the record of a key, dropping it if it has expired.
+func (t *Tracker) current(key string) *record {
+	now := t.Now()
+	t.sweep(now)
+
+	r, ok := t.records[key]
+	if !ok {
+		return nil
+	}
+
+	if t.expired(r, now) {
+		delete(t.records, key)
+		return nil
+	}
+
+	return r
+}
+
+// expired reports whether a record can be forgotten. A finished lockout starts over with a clean slate,
+// and other records expire once they have not failed for a full lockout duration.
+func (t *Tracker) expired(r *record, now time.Time) bool {
+	if now.Before(r.blockedTill) {
+		return false
+	}
+
+	return r.locked || now.Sub(r.lastFailure) >= t.policy.LockoutDuration
+}
+
+// sweep drops expired records so memory does not grow with every username ever tried.
+func (t *Tracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+
+	for key, r := range t.records {
+		if t.expired(r, now) {
+			delete(t.records, key)
+		}
+	}
+}
+
+// Guard tracks failed logins both per username and per client IP.
+type Guard struct {
+	Usernames *Tracker
+	IPs       *Tracker
+}
+
+// NewGuard is the constructor for Guard.
+func NewGuard(usernamePolicy, ipPolicy Policy) *Guard {
+	return &Guard{
+		Usernames: NewTracker(usernamePolicy),
+		IPs:       NewTracker(ipPolicy),
+	}
+}
+
+// Check returns how long a login for username from ip has to wait, or 0 if it may try now.
+func (g *Guard) Check(username, ip string) time.Duration {
+	wait := g.Usernames.Check(username)
+	if ipWait := g.IPs.Check(ip); ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait
+}
+
+// Fail records a failed login and reports whether the username or the IP got locked out by it.
+func (g *Guard) Fail(username, ip string) (usernameLocked bool, ipLocked bool) {
+	return g.Usernames.Fail(username), g.IPs.Fail(ip)
+}
+
+// Succeed clears the failures of a username after it logged in.
+// The IP keeps its failures so one valid account cannot be used to reset guessing from that address.
+func (g *Guard) Succeed(username string) {
+	g.Usernames.Reset(username)
+}
@@ -0,0 +1,153 @@
+package liblockout
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTrackerForTest() (*Tracker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)}
+
+	tracker := NewTracker(Policy{
+		BackoffAfter:    3,
+		BaseDelay:       time.Second,
+		LockoutAfter:    6,
+		LockoutDuration: 15 * time.Minute,
+	})
+	tracker.Now = clock.Now
+
+	return tracker, clock
+}
+
+func TestTrackerBackoff(t *testing.T) {
+	tracker, clock := newTrackerForTest()
+
+	// The first failures are free
+	for i := 0; i < 3; i++ {
+		tracker.Fail("alice")
+		if wait := tracker.Check("alice"); wait != 0 {
+			t.Fatalf("Failure %v should not delay the next attempt. Wait: %v", i+1, wait)
+		}
+	}
+
+	// Then every failure doubles the delay
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second} {
+		tracker.Fail("alice")
+		if wait := tracker.Check("alice"); wait != expected {
+			t.Errorf("Delay is not as expected. Expected: %v, received: %v", expected, wait)
+		}
+		clock.Advance(expected)
+	}
+
+	// Other keys are not affected
+	if wait := tracker.Check("bob"); wait != 0 {
+		t.Errorf("Unrelated key should not be delayed. Wait: %v", wait)
+	}
+
+	// A reset clears the delay
+	tracker.Fail("alice")
+	tracker.Reset("alice")
+	if wait := tracker.Check("alice"); wait != 0 {
+		t.Errorf("Reset key should not be delayed. Wait: %v", wait)
+	}
+}
+
+func TestTrackerLockoutExpiry(t *testing.T) {
+	tracker, clock := newTrackerForTest()
+
+	locked := false
+	for i := 0; i < 6; i++ {
+		clock.Advance(time.Hour / 100)
+		if tracker.Fail("alice") {
+			locked = true
+		}
+	}
+	if !locked {
+		t.Fatal("Reaching the threshold should start a lockout.")
+	}
+	if wait := tracker.Check("alice"); wait != 15*time.Minute {
+		t.Fatalf("Locked out key should wait the full lockout. Wait: %v", wait)
+	}
+
+	// Failing while locked extends the lockout but does not report it again
+	clock.Advance(5 * time.Minute)
+	if tracker.Fail("alice") {
+		t.Error("Failure during a lockout should not start a new one.")
+	}
+	if wait := tracker.Check("alice"); wait != 15*time.Minute {
+		t.Errorf("Failure during a lockout should extend it. Wait: %v", wait)
+	}
+
+	// The lockout expires and the key starts over
+	clock.Advance(15 * time.Minute)
+	if wait := tracker.Check("alice"); wait != 0 {
+		t.Fatalf("Expired lockout should not delay. Wait: %v", wait)
+	}
+	tracker.Fail("alice")
+	if wait := tracker.Check("alice"); wait != 0 {
+		t.Errorf("First failure after a lockout should not delay. Wait: %v", wait)
+	}
+}
+
+func TestTrackerFailuresExpire(t *testing.T) {
+	tracker, clock := newTrackerForTest()
+
+	for i := 0; i < 5; i++ {
+		tracker.Fail("alice")
+	}
+
+	// Old failures are forgotten after a lockout duration without new ones
+	clock.Advance(15 * time.Minute)
+	tracker.Fail("alice")
+	if wait := tracker.Check("alice"); wait != 0 {
+		t.Errorf("Failures should have expired. Wait: %v", wait)
+	}
+	if len(tracker.records) != 1 {
+		t.Errorf("Expired records should be swept. Records: %v", len(tracker.records))
+	}
+}
+
+func TestGuard(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)}
+
+	guard := NewGuard(
+		Policy{LockoutAfter: 2, LockoutDuration: time.Minute},
+		Policy{LockoutAfter: 3, LockoutDuration: time.Hour},
+	)
+	guard.Usernames.Now = clock.Now
+	guard.IPs.Now = clock.Now
+
+	guard.Fail("alice", "10.0.0.1")
+	usernameLocked, ipLocked := guard.Fail("alice", "10.0.0.1")
+	if !usernameLocked || ipLocked {
+		t.Fatalf("Only the username should be locked. Username: %v, IP: %v", usernameLocked, ipLocked)
+	}
+
+	// Guessing another account from the same address locks the address
+	_, ipLocked = guard.Fail("bob", "10.0.0.1")
+	if !ipLocked {
+		t.Fatal("The IP should be locked.")
+	}
+	if wait := guard.Check("carol", "10.0.0.1"); wait != time.Hour {
+		t.Errorf("Locked IP should block every username. Wait: %v", wait)
+	}
+
+	// Succeeding clears the username only
+	clock.Advance(time.Hour)
+	guard.Succeed("alice")
+	if wait := guard.Check("alice", "10.0.0.2"); wait != 0 {
+		t.Errorf("Username should be cleared. Wait: %v", wait)
+	}
+}
@@ -0,0 +1,136 @@
+// Package libmail sends email through pluggable mailers.
+package libmail
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// ErrMailerDisabled is returned by the mailer used when none is configured
+var ErrMailerDisabled = errors.New("libmail: no mailer is configured")
+
+// Mailer sends a plain text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// formatMessage builds an RFC 5322 message.
+func formatMessage(from, to, subject, body string, date time.Time) string {
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+
+	return strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.Replace(body, "\n", "\r\n", -1)
+}
+
+// checkHeader rejects header values that could inject extra headers.
+func checkHeader(values ...string) error {
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("mail header %q must not contain line breaks", value)
+		}
+	}
+
+	return nil
+}
+
+// SMTPMailer sends mail through an SMTP server, authenticating if Username is set.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Send implements Mailer.
+func (s *SMTPMailer) Send(to, subject, body string) error {
+	if err := checkHeader(to, subject); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	message := formatMessage(s.From, to, subject, body, time.Now())
+	return smtp.SendMail(s.Addr, auth, s.From, []string{to}, []byte(message))
+}
+
+// FileMailer appends every message to a file instead of sending it. Useful for local testing.
+type FileMailer struct {
+	Path  string
+	From  string
+	mutex sync.Mutex
+}
+
+// Send implements Mailer.
+func (f *FileMailer) Send(to, subject, body string) error {
+	if err := checkHeader(to, subject); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(formatMessage(f.From, to, subject, body, time.Now()) + "\r\n\r\n")
+	return err
+}
+
+// DisabledMailer refuses to send anything. It is the default, so links in account emails
+// don't end up anywhere until a mailer is chosen.
+type DisabledMailer struct{}
+
+// Send implements Mailer.
+func (d *DisabledMailer) Send(to, subject, body string) error {
+	return ErrMailerDisabled
+}
+
+// LogMailer logs every message instead of sending it.
+// Messages carry password reset and verification links, so it is only meant for local development.
+type LogMailer struct{}
+
+// Send implements Mailer.
+func (l *LogMailer) Send(to, subject, body string) error {
+	logrus.Infoln("Mail to", to, "subject", subject, "\n"+body)
+	return nil
+}
+
+// New creates the mailer selected by kind: "smtp", "file", "log" or "none".
+func New(kind, smtpAddr, smtpUsername, smtpPassword, from, filePath string) (Mailer, error) {
+	switch kind {
+	case "smtp":
+		return &SMTPMailer{Addr: smtpAddr, From: from, Username: smtpUsername, Password: smtpPassword}, nil
+	case "file":
+		return &FileMailer{Path: filePath, From: from}, nil
+	case "log":
+		return &LogMailer{}, nil
+	case "none", "":
+		return &DisabledMailer{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown mailer %q", kind)
+}
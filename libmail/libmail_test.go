@@ -0,0 +1,58 @@
+package libmail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libmail")
+	if err != nil {
+		t.Fatalf("Creating temp dir should not fail. Error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	mailer := &FileMailer{Path: filepath.Join(dir, "mail.txt"), From: "punocracy@example.com"}
+
+	err = mailer.Send("user@example.com", "Hello", "First line\nSecond line")
+	if err != nil {
+		t.Fatalf("Sending mail should not fail. Error: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(mailer.Path)
+	if err != nil {
+		t.Fatalf("Reading mail file should not fail. Error: %v", err)
+	}
+
+	for _, expected := range []string{"From: punocracy@example.com\r\n", "To: user@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nFirst line\r\nSecond line"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Mail file should contain %q. Content: %q", expected, content)
+		}
+	}
+
+	if err := mailer.Send("user@example.com\r\nBcc: everyone@example.com", "Hello", "body"); err == nil {
+		t.Error("Header injection should be rejected.")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("pigeon", "", "", "", "", ""); err == nil {
+		t.Error("Unknown mailer should fail.")
+	}
+
+	mailer, err := New("", "", "", "", "", "")
+	if _, ok := mailer.(*DisabledMailer); !ok || err != nil {
+		t.Errorf("Default mailer should be disabled. Received: %T, error: %v", mailer, err)
+	}
+	if err := mailer.Send("user@example.com", "Reset your password", "https://example.com/password/reset?token=secret"); err != ErrMailerDisabled {
+		t.Errorf("The disabled mailer should refuse to send. Received: %v", err)
+	}
+
+	mailer, err = New("log", "", "", "", "", "")
+	if _, ok := mailer.(*LogMailer); !ok || err != nil {
+		t.Errorf("The log mailer should be available when asked for. Received: %T, error: %v", mailer, err)
+	}
+}
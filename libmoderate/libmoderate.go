@@ -0,0 +1,239 @@
+// Package libmoderate scores text for disallowed content before it reaches the curators.
+package libmoderate
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/punocracy/punocracy/libtokenize"
+)
+
+// Verdict is the outcome of moderating a piece of text.
+type Verdict int
+
+const (
+	// Clean text goes to the curator queue as usual
+	Clean Verdict = iota
+	// Flagged text goes to the curator queue with its findings highlighted
+	Flagged
+	// Rejected text never reaches the curator queue
+	Rejected
+)
+
+// Finding is a part of the text that a Scorer objected to.
+// Start and End are byte offsets into the text.
+type Finding struct {
+	Start  int
+	End    int
+	Term   string
+	Score  float64
+	Reason string
+}
+
+// Scorer inspects text and reports what it found objectionable.
+// Implement it to plug additional checks, such as an external classifier, into a Pipeline.
+type Scorer interface {
+	Score(text string) []Finding
+}
+
+// Result is the outcome of running a Pipeline.
+type Result struct {
+	Verdict  Verdict
+	Score    float64
+	Findings []Finding
+}
+
+// Reason describes why text was flagged or rejected.
+func (r Result) Reason() string {
+	reasons := []string{}
+	seen := make(map[string]bool)
+	for _, finding := range r.Findings {
+		if !seen[finding.Reason] {
+			seen[finding.Reason] = true
+			reasons = append(reasons, finding.Reason)
+		}
+	}
+
+	return strings.Join(reasons, " and ")
+}
+
+// Terms returns the distinct terms found, in the order they appear.
+func (r Result) Terms() []string {
+	terms := []string{}
+	seen := make(map[string]bool)
+	for _, finding := range r.Findings {
+		if !seen[finding.Term] {
+			seen[finding.Term] = true
+			terms = append(terms, finding.Term)
+		}
+	}
+
+	return terms
+}
+
+// Pipeline runs every Scorer over a text and adds up their scores.
+// Text scoring at least RejectThreshold is rejected, and at least FlagThreshold is flagged.
+// A threshold of 0 disables that verdict.
+type Pipeline struct {
+	Scorers         []Scorer
+	FlagThreshold   float64
+	RejectThreshold float64
+}
+
+// Check moderates a piece of text.
+func (p *Pipeline) Check(text string) Result {
+	result := Result{Verdict: Clean, Findings: []Finding{}}
+	if p == nil {
+		return result
+	}
+
+	for _, scorer := range p.Scorers {
+		for _, finding := range scorer.Score(text) {
+			result.Score += finding.Score
+			result.Findings = append(result.Findings, finding)
+		}
+	}
+
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		return result.Findings[i].Start < result.Findings[j].Start
+	})
+
+	if p.RejectThreshold > 0 && result.Score >= p.RejectThreshold {
+		result.Verdict = Rejected
+	} else if p.FlagThreshold > 0 && result.Score >= p.FlagThreshold {
+		result.Verdict = Flagged
+	}
+
+	return result
+}
+
+// BlocklistScorer scores every word of the text found in its list of terms.
+// Terms are matched against normalized words, so matching ignores case and punctuation.
+type BlocklistScorer struct {
+	Terms map[string]float64
+}
+
+// Score implements Scorer.
+func (b BlocklistScorer) Score(text string) []Finding {
+	findings := []Finding{}
+
+	for _, token := range libtokenize.Tokenize(text) {
+		key := token.Key()
+		score, ok := b.Terms[key]
+		if !ok {
+			key = libtokenize.Stem(key)
+			score, ok = b.Terms[key]
+		}
+		if !ok {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Start:  token.Start,
+			End:    token.End,
+			Term:   key,
+			Score:  score,
+			Reason: "contains a blocked word",
+		})
+	}
+
+	return findings
+}
+
+// linkPattern matches URLs with a scheme, www. hosts and bare domain names with common TLDs.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://[^\s]+|www\.[^\s]+|[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|info|biz|io|co|ru|xyz|top|ly|me)\b(?:/[^\s]*)?)`)
+
+// LinkScorer scores every link in the text, since phrases never need them and spammers always do.
+type LinkScorer struct {
+	ScorePerLink float64
+}
+
+// Score implements Scorer.
+func (l LinkScorer) Score(text string) []Finding {
+	findings := []Finding{}
+
+	for _, match := range linkPattern.FindAllStringIndex(text, -1) {
+		findings = append(findings, Finding{
+			Start:  match[0],
+			End:    match[1],
+			Term:   text[match[0]:match[1]],
+			Score:  l.ScorePerLink,
+			Reason: "contains a link",
+		})
+	}
+
+	return findings
+}
+
+// Segment is a piece of text that is either highlighted or not.
+type Segment struct {
+	Text        string
+	Highlighted bool
+}
+
+// Highlight splits text into segments, highlighting the parts covered by findings.
+func Highlight(text string, findings []Finding) []Segment {
+	segments := []Segment{}
+
+	sorted := make([]Finding, len(findings))
+	copy(sorted, findings)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	last := 0
+	for _, finding := range sorted {
+		if finding.End <= last || finding.Start >= len(text) {
+			continue
+		}
+		start := finding.Start
+		if start < last {
+			start = last
+		}
+		end := finding.End
+		if end > len(text) {
+			end = len(text)
+		}
+
+		if start > last {
+			segments = append(segments, Segment{Text: text[last:start]})
+		}
+		segments = append(segments, Segment{Text: text[start:end], Highlighted: true})
+		last = end
+	}
+
+	if last < len(text) {
+		segments = append(segments, Segment{Text: text[last:]})
+	}
+
+	return segments
+}
+
+// HighlightTerms highlights every word of text whose normalized form is one of terms.
+// It lets stored phrases be highlighted again without keeping byte offsets around.
+func HighlightTerms(text string, terms []string) []Segment {
+	blocklist := BlocklistScorer{Terms: make(map[string]float64)}
+	for _, term := range terms {
+		blocklist.Terms[libtokenize.Normalize(term)] = 1
+	}
+
+	findings := blocklist.Score(text)
+	for _, term := range terms {
+		// Links and other terms that are not a single word are matched verbatim
+		if tokens := libtokenize.Tokenize(term); len(tokens) == 1 && tokens[0].Text == term {
+			continue
+		}
+
+		for offset := 0; term != ""; {
+			index := strings.Index(text[offset:], term)
+			if index < 0 {
+				break
+			}
+			findings = append(findings, Finding{Start: offset + index, End: offset + index + len(term), Term: term})
+			offset += index + len(term)
+		}
+	}
+
+	return Highlight(text, findings)
+}
@@ -0,0 +1,86 @@
+package libmoderate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newPipelineForTest() *Pipeline {
+	return &Pipeline{
+		Scorers: []Scorer{
+			BlocklistScorer{Terms: map[string]float64{"darn": 1, "heck": 0.5}},
+			LinkScorer{ScorePerLink: 2},
+		},
+		FlagThreshold:   0.5,
+		RejectThreshold: 2,
+	}
+}
+
+func TestPipelineCheck(t *testing.T) {
+	pipeline := newPipelineForTest()
+
+	tests := []struct {
+		input    string
+		verdict  Verdict
+		expected []string
+	}{
+		{"To write with a broken pencil is pointless", Clean, []string{}},
+		{"What the HECK is a homophone?", Flagged, []string{"heck"}},
+		{"Darn it, what the heck!", Flagged, []string{"darn", "heck"}},
+		{"Darn, darn, darn.", Rejected, []string{"darn"}},
+		{"Cheap pens at www.example.com/pens", Rejected, []string{"www.example.com/pens"}},
+		{"Visit https://example.org now", Rejected, []string{"https://example.org"}},
+		{"Buy now at pens.biz", Rejected, []string{"pens.biz"}},
+	}
+
+	for _, test := range tests {
+		result := pipeline.Check(test.input)
+		if result.Verdict != test.verdict {
+			t.Errorf("Verdict for %q is not as expected. Expected: %v, received: %v (score %v)", test.input, test.verdict, result.Verdict, result.Score)
+		}
+		if terms := result.Terms(); !reflect.DeepEqual(terms, test.expected) {
+			t.Errorf("Terms for %q are not as expected. Expected: %q, received: %q", test.input, test.expected, terms)
+		}
+	}
+
+	var nilPipeline *Pipeline
+	if result := nilPipeline.Check("darn"); result.Verdict != Clean {
+		t.Error("Nil pipeline should accept everything.")
+	}
+}
+
+func TestResultReason(t *testing.T) {
+	result := newPipelineForTest().Check("Darn! See darn.com")
+	if reason := result.Reason(); reason != "contains a blocked word and contains a link" {
+		t.Errorf("Reason is not as expected. Received: %v", reason)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	text := "Darn it, what the heck!"
+	segments := Highlight(text, newPipelineForTest().Check(text).Findings)
+	expected := []Segment{
+		{"Darn", true},
+		{" it, what the ", false},
+		{"heck", true},
+		{"!", false},
+	}
+
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("Segments are not as expected. Received: %#v", segments)
+	}
+}
+
+func TestHighlightTerms(t *testing.T) {
+	segments := HighlightTerms("A classy heck of a site: www.example.com", []string{"heck", "www.example.com"})
+	expected := []Segment{
+		{"A classy ", false},
+		{"heck", true},
+		{" of a site: ", false},
+		{"www.example.com", true},
+	}
+
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("Segments are not as expected. Received: %#v", segments)
+	}
+}
@@ -0,0 +1,433 @@
+// Package liboidc implements OpenID Connect login with the authorization code flow and PKCE.
+// Any provider that publishes a discovery document can be used.
+package liboidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidIDToken is returned for ID tokens that fail validation.
+var ErrInvalidIDToken = errors.New("oidc: id token is invalid")
+
+// leeway allows for clock differences between us and the provider.
+const leeway = time.Minute
+
+// Provider holds the endpoints from a provider's discovery document.
+type Provider struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Claims are the ID token claims used to identify the user.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            float64  `json:"exp"`
+	IssuedAt          float64  `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience is a JSON string or array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	return contains(a, value)
+}
+
+// Client logs users in with one provider.
+type Client struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	HTTPClient   *http.Client
+	// Now is the clock, replaceable in tests
+	Now func() time.Time
+
+	mutex    sync.Mutex
+	provider *Provider
+	keys     map[string]crypto.PublicKey
+}
+
+// NewClient creates a Client. The provider is discovered on first use.
+func NewClient(issuer, clientID, clientSecret, redirectURL string, scopes []string) *Client {
+	return &Client{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		Now:          time.Now,
+	}
+}
+
+// Provider fetches and caches the discovery document. Failures are not cached, so a later call retries.
+func (c *Client) Provider() (*Provider, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.provider != nil {
+		return c.provider, nil
+	}
+
+	provider := &Provider{}
+	err := c.getJSON(strings.TrimSuffix(c.Issuer, "/")+"/.well-known/openid-configuration", provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider.Issuer != c.Issuer {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q, expected %q", provider.Issuer, c.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing endpoints")
+	}
+
+	c.provider = provider
+	return provider, nil
+}
+
+// RandomString returns a URL safe random string, for state, nonce and PKCE verifier values.
+func RandomString() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge for verifier.
+func CodeChallenge(verifier string) string {
+	digest := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// AuthCodeURL is where to send the user to log in with the provider.
+func (c *Client) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	provider, err := c.Provider()
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, c.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return provider.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the validated ID token claims.
+func (c *Client) Exchange(code, verifier, nonce string) (*Claims, error) {
+	provider, err := c.Provider()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {c.ClientID},
+	}
+
+	postSecret := len(provider.TokenAuthMethods) > 0 && !contains(provider.TokenAuthMethods, "client_secret_basic")
+	if postSecret {
+		form.Set("client_secret", c.ClientSecret)
+	}
+
+	request, err := http.NewRequest("POST", provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if !postSecret && c.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("oidc: token response could not be read: %v", err)
+	}
+
+	if response.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("oidc: token request failed: %v %v", tokens.Error, tokens.ErrorDescription)
+	}
+
+	return c.VerifyIDToken(tokens.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token.
+func (c *Client) VerifyIDToken(rawToken, nonce string) (*Claims, error) {
+	provider, err := c.Provider()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	key, err := c.key(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !verifySignature(header.Algorithm, key, parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidIDToken
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	now := c.Now()
+	expiry := time.Unix(int64(claims.Expiry), 0)
+
+	switch {
+	case claims.Issuer != provider.Issuer:
+		return nil, fmt.Errorf("%v: issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.Audience.contains(c.ClientID):
+		return nil, fmt.Errorf("%v: audience %v", ErrInvalidIDToken, claims.Audience)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != c.ClientID:
+		return nil, fmt.Errorf("%v: authorized party %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	case !now.Add(-leeway).Before(expiry):
+		return nil, fmt.Errorf("%v: expired", ErrInvalidIDToken)
+	case time.Unix(int64(claims.IssuedAt), 0).After(now.Add(leeway)):
+		return nil, fmt.Errorf("%v: issued in the future", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%v: nonce mismatch", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%v: missing subject", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// key returns the provider's signing key with the given ID, refetching the key set once for unknown IDs
+// so the provider can rotate keys.
+func (c *Client) key(keyID string) (crypto.PublicKey, error) {
+	c.mutex.Lock()
+	key, ok := c.keys[keyID]
+	jwksURI := c.provider.JWKSURI
+	c.mutex.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := c.getJSON(jwksURI, &keySet); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if publicKey, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = publicKey
+		}
+	}
+
+	c.mutex.Lock()
+	c.keys = keys
+	c.mutex.Unlock()
+
+	key, ok = keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%v: unknown signing key %q", ErrInvalidIDToken, keyID)
+	}
+
+	return key, nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("oidc: unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("oidc: unsupported key type %q", k.KeyType)
+}
+
+// verifySignature supports RS256 and ES256, the algorithms providers use for ID tokens.
+// Anything else, in particular "none" and symmetric algorithms, is rejected.
+func verifySignature(algorithm string, key crypto.PublicKey, signingInput string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch algorithm {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) == nil
+
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(ecKey, digest[:], r, s)
+	}
+
+	return false
+}
+
+func (c *Client) getJSON(address string, target interface{}) error {
+	response, err := c.HTTPClient.Get(address)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %v returned %v", address, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, target)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package liboidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubProvider is a minimal identity provider: discovery, a key set and a token endpoint.
+type stubProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// issued maps authorization codes to the PKCE challenge and nonce they were issued with
+	issued map[string][2]string
+	claims map[string]interface{}
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Generating key should not fail. Error: %v", err)
+	}
+
+	stub := &stubProvider{key: key, issued: make(map[string][2]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 stub.server.URL,
+			"authorization_endpoint": stub.server.URL + "/authorize",
+			"token_endpoint":         stub.server.URL + "/token",
+			"jwks_uri":               stub.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		issued, ok := stub.issued[r.FormValue("code")]
+		if clientID != "punocracy" || secret != "s3cret" || !ok || CodeChallenge(r.FormValue("code_verifier")) != issued[0] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := map[string]interface{}{
+			"iss":   stub.server.URL,
+			"sub":   "user-123",
+			"aud":   "punocracy",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": issued[1],
+			"email": "punster@example.com",
+		}
+		for name, value := range stub.claims {
+			claims[name] = value
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": stub.sign(t, claims), "token_type": "Bearer"})
+	})
+
+	stub.server = httptest.NewServer(mux)
+	return stub
+}
+
+func (s *stubProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "key-1"})
+	payload, _ := json.Marshal(claims)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Signing should not fail. Error: %v", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestLogin(t *testing.T) {
+	stub := newStubProvider(t)
+	defer stub.server.Close()
+
+	client := NewClient(stub.server.URL, "punocracy", "s3cret", "http://localhost/login/stub/callback", []string{"email"})
+
+	state, _ := RandomString()
+	nonce, _ := RandomString()
+	verifier, _ := RandomString()
+
+	authURL, err := client.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("Building the auth URL should not fail. Error: %v", err)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if !strings.HasPrefix(authURL, stub.server.URL+"/authorize?") || query.Get("state") != state ||
+		query.Get("code_challenge_method") != "S256" || query.Get("scope") != "openid email" {
+		t.Errorf("Auth URL is not as expected. Received: %v", authURL)
+	}
+
+	// The provider redirects back with a code tied to the challenge and nonce it received
+	stub.issued["code-1"] = [2]string{query.Get("code_challenge"), query.Get("nonce")}
+
+	if _, err := client.Exchange("code-1", "wrong verifier", nonce); err == nil {
+		t.Error("Exchange with the wrong PKCE verifier should fail.")
+	}
+
+	claims, err := client.Exchange("code-1", verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange should not fail. Error: %v", err)
+	}
+	if claims.Subject != "user-123" || claims.Email != "punster@example.com" {
+		t.Errorf("Claims are not as expected. Received: %#v", claims)
+	}
+
+	if _, err := client.Exchange("code-1", verifier, "another nonce"); err == nil {
+		t.Error("ID token with another nonce should be rejected.")
+	}
+
+	stub.claims = map[string]interface{}{"aud": []string{"someone-else"}}
+	if _, err := client.Exchange("code-1", verifier, nonce); err == nil {
+		t.Error("ID token for another audience should be rejected.")
+	}
+
+	stub.claims = map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}
+	if _, err := client.Exchange("code-1", verifier, nonce); err == nil {
+		t.Error("Expired ID token should be rejected.")
+	}
+}
+
+func TestVerifyIDTokenRejectsForgeries(t *testing.T) {
+	stub := newStubProvider(t)
+	defer stub.server.Close()
+
+	client := NewClient(stub.server.URL, "punocracy", "s3cret", "http://localhost/callback", nil)
+
+	claims := map[string]interface{}{"iss": stub.server.URL, "sub": "user-123", "aud": "punocracy", "exp": time.Now().Add(time.Hour).Unix()}
+	token := stub.sign(t, claims)
+
+	if _, err := client.VerifyIDToken(token, ""); err != nil {
+		t.Fatalf("Valid ID token should verify. Error: %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+
+	unsignedHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"key-1"}`))
+	if _, err := client.VerifyIDToken(unsignedHeader+"."+parts[1]+".", ""); err == nil {
+		t.Error("Unsigned ID token should be rejected.")
+	}
+
+	forgedPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + stub.server.URL + `","sub":"admin","aud":"punocracy","exp":9999999999}`))
+	if _, err := client.VerifyIDToken(parts[0]+"."+forgedPayload+"."+parts[2], ""); err == nil {
+		t.Error("ID token with a modified payload should be rejected.")
+	}
+}
@@ -0,0 +1,260 @@
+// Package libpassword checks new passwords against a policy and hashes them with bcrypt or argon2id.
+package libpassword
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrBlank is returned for empty passwords.
+var ErrBlank = errors.New("password cannot be blank")
+
+// ErrBreached is returned for passwords found in the breached password list.
+var ErrBreached = errors.New("password appears in a list of breached passwords, please choose another one")
+
+// ErrMismatch is returned by Verify when the password does not match the hash.
+var ErrMismatch = errors.New("password does not match")
+
+// ErrUnknownHash is returned for hashes in a format the package does not know.
+var ErrUnknownHash = errors.New("password hash format is unknown")
+
+// TooShortError is returned for passwords shorter than the policy allows.
+type TooShortError struct {
+	MinLength int
+}
+
+func (e *TooShortError) Error() string {
+	return fmt.Sprintf("password must be at least %v characters long", e.MinLength)
+}
+
+// Policy decides which new passwords are acceptable. A nil Policy only rejects blank passwords.
+type Policy struct {
+	MinLength int
+	// Breached holds upper case hex SHA-1 digests of known breached passwords
+	Breached map[string]struct{}
+}
+
+// Check returns an error explaining why password is not acceptable, or nil.
+func (p *Policy) Check(password string) error {
+	if password == "" {
+		return ErrBlank
+	}
+	if p == nil {
+		return nil
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &TooShortError{MinLength: p.MinLength}
+	}
+
+	if _, found := p.Breached[sha1Hex(password)]; found {
+		return ErrBreached
+	}
+
+	return nil
+}
+
+// LoadBreached reads a breached password list with one entry per line.
+// Entries are either plain passwords or SHA-1 digests optionally followed by ":count",
+// the format of the Pwned Passwords downloads.
+func LoadBreached(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		breached[breachedKey(line)] = struct{}{}
+	}
+
+	return breached, scanner.Err()
+}
+
+func breachedKey(line string) string {
+	digest := line
+	if i := strings.IndexByte(digest, ':'); i == 40 {
+		digest = digest[:i]
+	}
+
+	if len(digest) == 40 {
+		if _, err := hex.DecodeString(digest); err == nil {
+			return strings.ToUpper(digest)
+		}
+	}
+
+	return sha1Hex(line)
+}
+
+func sha1Hex(password string) string {
+	digest := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(digest[:]))
+}
+
+// Supported hashing algorithms
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+// Hasher hashes new passwords with the configured algorithm and parameters.
+// A nil Hasher uses bcrypt with bcrypt.DefaultCost.
+type Hasher struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2id parameters, Memory is in KiB
+	ArgonTime    uint32
+	ArgonMemory  uint32
+	ArgonThreads uint8
+}
+
+const (
+	argonSaltLength = 16
+	argonKeyLength  = 32
+)
+
+func (h *Hasher) algorithm() string {
+	if h == nil || h.Algorithm == "" {
+		return Bcrypt
+	}
+	return h.Algorithm
+}
+
+func (h *Hasher) bcryptCost() int {
+	if h == nil || h.BcryptCost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.BcryptCost
+}
+
+// Validate checks that the algorithm is known and its parameters are usable.
+func (h *Hasher) Validate() error {
+	switch h.algorithm() {
+	case Bcrypt:
+		if cost := h.bcryptCost(); cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %v and %v", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return nil
+
+	case Argon2id:
+		if h.ArgonTime < 1 || h.ArgonMemory < 8*uint32(h.ArgonThreads) || h.ArgonThreads < 1 {
+			return errors.New("argon2id needs at least one pass, one thread and 8 KiB of memory per thread")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown password hashing algorithm %q", h.algorithm())
+}
+
+// Hash hashes password.
+func (h *Hasher) Hash(password string) (string, error) {
+	switch h.algorithm() {
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost())
+		return string(hash), err
+
+	case Argon2id:
+		salt := make([]byte, argonSaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(password), salt, h.ArgonTime, h.ArgonMemory, h.ArgonThreads, argonKeyLength)
+
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, h.ArgonMemory, h.ArgonTime, h.ArgonThreads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	return "", fmt.Errorf("unknown password hashing algorithm %q", h.algorithm())
+}
+
+// Verify checks password against a hash made with any supported algorithm, whatever the Hasher is configured to use.
+func (h *Hasher) Verify(hash, password string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return err
+		}
+
+		computed := argon2.IDKey([]byte(password), salt, params.ArgonTime, params.ArgonMemory, params.ArgonThreads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return ErrMismatch
+		}
+		return nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrMismatch
+	}
+	return err
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or weaker parameters than the Hasher's.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	switch h.algorithm() {
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost < h.bcryptCost()
+
+	case Argon2id:
+		params, _, _, err := parseArgon2id(hash)
+		return err != nil ||
+			params.ArgonTime < h.ArgonTime ||
+			params.ArgonMemory < h.ArgonMemory ||
+			params.ArgonThreads < h.ArgonThreads
+	}
+
+	return false
+}
+
+func parseArgon2id(hash string) (*Hasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return nil, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrUnknownHash
+	}
+
+	params := &Hasher{Algorithm: Argon2id}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.ArgonMemory, &params.ArgonTime, &params.ArgonThreads); err != nil {
+		return nil, nil, nil, ErrUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrUnknownHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrUnknownHash
+	}
+
+	return params, salt, key, nil
+}
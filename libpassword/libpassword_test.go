@@ -0,0 +1,95 @@
+package libpassword
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	var nilPolicy *Policy
+	if err := nilPolicy.Check(""); err != ErrBlank {
+		t.Errorf("Blank password should be rejected. Received: %v", err)
+	}
+	if err := nilPolicy.Check("a"); err != nil {
+		t.Errorf("Nil policy should accept any other password. Received: %v", err)
+	}
+
+	file, err := ioutil.TempFile("", "breached")
+	if err != nil {
+		t.Fatalf("Creating temp file should not fail. Error: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	// "password1" in plain text and "letmein123" as a Pwned Passwords style digest
+	file.WriteString("password1\r\nE286977B13F1A89E20D0459207545D15FE1EBA08:12\n\n")
+	file.Close()
+
+	breached, err := LoadBreached(file.Name())
+	if err != nil {
+		t.Fatalf("Loading breached list should not fail. Error: %v", err)
+	}
+
+	policy := &Policy{MinLength: 8, Breached: breached}
+
+	if err, ok := policy.Check("shørt").(*TooShortError); !ok || err.MinLength != 8 {
+		t.Errorf("Short password should be rejected. Received: %v", err)
+	}
+	if err := policy.Check("password1"); err != ErrBreached {
+		t.Errorf("Plain breached password should be rejected. Received: %v", err)
+	}
+	if err := policy.Check("letmein123"); err != ErrBreached {
+		t.Errorf("Hashed breached password should be rejected. Received: %v", err)
+	}
+	if err := policy.Check("correct horse battery staple"); err != nil {
+		t.Errorf("Good password should be accepted. Received: %v", err)
+	}
+}
+
+func TestHasher(t *testing.T) {
+	weakBcrypt := &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}
+	strongBcrypt := &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}
+	argon := &Hasher{Algorithm: Argon2id, ArgonTime: 1, ArgonMemory: 64, ArgonThreads: 1}
+	strongArgon := &Hasher{Algorithm: Argon2id, ArgonTime: 2, ArgonMemory: 64, ArgonThreads: 1}
+
+	for _, hasher := range []*Hasher{weakBcrypt, argon} {
+		if err := hasher.Validate(); err != nil {
+			t.Errorf("Hasher should be valid. Error: %v", err)
+		}
+
+		hash, err := hasher.Hash("s3cret")
+		if err != nil {
+			t.Fatalf("Hashing should not fail. Error: %v", err)
+		}
+
+		// Any hasher verifies any supported format
+		if err := strongBcrypt.Verify(hash, "s3cret"); err != nil {
+			t.Errorf("Correct password should verify against %v. Error: %v", hash, err)
+		}
+		if err := strongArgon.Verify(hash, "wrong"); err != ErrMismatch {
+			t.Errorf("Wrong password should not verify against %v. Received: %v", hash, err)
+		}
+		if hasher.NeedsRehash(hash) {
+			t.Errorf("Hash made with the same parameters should not need rehash: %v", hash)
+		}
+	}
+
+	weakHash, _ := weakBcrypt.Hash("s3cret")
+	argonHash, _ := argon.Hash("s3cret")
+
+	if !strongBcrypt.NeedsRehash(weakHash) {
+		t.Error("Hash with lower bcrypt cost should need rehash.")
+	}
+	if !strongBcrypt.NeedsRehash(argonHash) || !argon.NeedsRehash(weakHash) {
+		t.Error("Hash made with another algorithm should need rehash.")
+	}
+	if !strongArgon.NeedsRehash(argonHash) {
+		t.Error("Hash with fewer argon2id passes should need rehash.")
+	}
+
+	if err := (&Hasher{Algorithm: "md5"}).Validate(); err == nil {
+		t.Error("Unknown algorithm should be invalid.")
+	}
+}
@@ -0,0 +1,163 @@
+// Package libratelimit provides token-bucket rate limiting with pluggable storage backends.
+package libratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit describes a token bucket: Burst tokens at most, refilled at Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses limits written as "<count>/<unit>", e.g. "10/m" allows bursts of 10 requests
+// refilled over a minute. Units are s, m, h and d. An empty string or "0" disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("rate limit %q must look like <count>/<unit>", s)
+	}
+
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid count", s)
+	}
+
+	var period time.Duration
+	switch parts[1] {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	case "d":
+		period = 24 * time.Hour
+	default:
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid unit", s)
+	}
+
+	return Limit{Rate: float64(count) / period.Seconds(), Burst: count}, nil
+}
+
+// Disabled reports whether the limit lets every request through.
+func (l Limit) Disabled() bool {
+	return l.Burst <= 0 || l.Rate <= 0
+}
+
+// Backend stores token buckets. TakeAll removes one token from each of the buckets named by keys and reports
+// whether the request is allowed, and if not, how long until every bucket has a token.
+// A request is only allowed if every bucket has a token, and a denied request takes no tokens at all.
+type Backend interface {
+	TakeAll(keys []string, limit Limit) (bool, time.Duration, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+
+	// full is when the bucket will have refilled completely
+	full time.Time
+}
+
+// MemoryBackend keeps token buckets in process memory.
+type MemoryBackend struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	// Now returns the current time. It can be replaced in tests.
+	Now func() time.Time
+}
+
+// NewMemoryBackend is the constructor for MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets: make(map[string]*bucket),
+		Now:     time.Now,
+	}
+}
+
+// Take removes one token from the bucket named key, like TakeAll with a single key.
+func (m *MemoryBackend) Take(key string, limit Limit) (bool, time.Duration, error) {
+	return m.TakeAll([]string{key}, limit)
+}
+
+// TakeAll implements Backend.
+func (m *MemoryBackend) TakeAll(keys []string, limit Limit) (bool, time.Duration, error) {
+	if limit.Disabled() {
+		return true, 0, nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.Now()
+	m.sweep(now)
+
+	buckets := make([]*bucket, 0, len(keys))
+	var wait time.Duration
+	for _, key := range keys {
+		b := m.refill(key, limit, now)
+		buckets = append(buckets, b)
+
+		if b.tokens < 1 {
+			if bucketWait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second)); bucketWait > wait {
+				wait = bucketWait
+			}
+		}
+	}
+	if wait > 0 {
+		return false, wait, nil
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+		b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)))
+	}
+
+	return true, 0, nil
+}
+
+// refill returns the bucket named key, topped up for the time elapsed since it was last used
+func (m *MemoryBackend) refill(key string, limit Limit, now time.Time) *bucket {
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.updated = now
+	}
+
+	return b
+}
+
+// sweep drops buckets that have refilled completely, since a missing bucket starts out full.
+// This keeps memory bounded by the number of recently limited keys.
+func (m *MemoryBackend) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package libratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("10/m")
+	if err != nil {
+		t.Fatalf("Parsing a valid limit should not fail. Error: %v", err)
+	}
+	if limit.Burst != 10 || limit.Rate != 10.0/60 {
+		t.Errorf("Limit is not as expected. Received: %#v", limit)
+	}
+
+	limit, err = ParseLimit("")
+	if err != nil || !limit.Disabled() {
+		t.Errorf("Empty limit should be disabled. Received: %#v, error: %v", limit, err)
+	}
+
+	for _, invalid := range []string{"10", "ten/m", "10/w", "-1/s"} {
+		if _, err := ParseLimit(invalid); err == nil {
+			t.Errorf("Parsing %q should fail.", invalid)
+		}
+	}
+}
+
+func TestMemoryBackendTake(t *testing.T) {
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+	backend := NewMemoryBackend()
+	backend.Now = func() time.Time { return now }
+
+	limit := Limit{Rate: 1, Burst: 2}
+
+	// The bucket starts full
+	for i := 0; i < 2; i++ {
+		ok, _, err := backend.Take("user:1", limit)
+		if err != nil || !ok {
+			t.Fatalf("Request %v should be allowed. Error: %v", i, err)
+		}
+	}
+
+	ok, wait, _ := backend.Take("user:1", limit)
+	if ok {
+		t.Fatal("Request over the burst should be denied.")
+	}
+	if wait != time.Second {
+		t.Errorf("Retry wait is not as expected. Received: %v", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _, _ := backend.Take("user:2", limit); !ok {
+		t.Error("Request for another key should be allowed.")
+	}
+
+	// A token is refilled after a second
+	now = now.Add(time.Second)
+	if ok, _, _ := backend.Take("user:1", limit); !ok {
+		t.Error("Request after refill should be allowed.")
+	}
+
+	// Disabled limits let everything through
+	for i := 0; i < 100; i++ {
+		if ok, _, _ := backend.Take("user:1", Limit{}); !ok {
+			t.Fatal("Disabled limit should allow every request.")
+		}
+	}
+}
+
+func TestMemoryBackendTakeAll(t *testing.T) {
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+	backend := NewMemoryBackend()
+	backend.Now = func() time.Time { return now }
+
+	limit := Limit{Rate: 1, Burst: 2}
+
+	// Use up the user's bucket from another IP
+	backend.TakeAll([]string{"ip:a", "user:1"}, limit)
+	backend.TakeAll([]string{"ip:a", "user:1"}, limit)
+
+	ok, wait, _ := backend.TakeAll([]string{"ip:b", "user:1"}, limit)
+	if ok {
+		t.Fatal("Request should be denied when any bucket is empty.")
+	}
+	if wait != time.Second {
+		t.Errorf("Retry wait is not as expected. Received: %v", wait)
+	}
+
+	// The denied request must not have cost the other IP any tokens
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := backend.Take("ip:b", limit); !ok {
+			t.Errorf("Denied requests should not take tokens from the other buckets. Request %v was denied.", i)
+		}
+	}
+}
+
+func TestMemoryBackendSweep(t *testing.T) {
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+	backend := NewMemoryBackend()
+	backend.Now = func() time.Time { return now }
+
+	backend.Take("ip:127.0.0.1", Limit{Rate: 1, Burst: 5})
+
+	now = now.Add(time.Hour)
+	backend.Take("ip:127.0.0.2", Limit{Rate: 1, Burst: 5})
+
+	if _, ok := backend.buckets["ip:127.0.0.1"]; ok {
+		t.Error("Refilled bucket should have been swept.")
+	}
+	if _, ok := backend.buckets["ip:127.0.0.2"]; !ok {
+		t.Error("Active bucket should not have been swept.")
+	}
+}
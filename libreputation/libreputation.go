@@ -0,0 +1,74 @@
+// Package libreputation computes reputation points and the capabilities they unlock.
+package libreputation
+
+// Capability is something users can do once their reputation is high enough and an administrator agreed
+type Capability string
+
+// Capabilities that can be unlocked
+const (
+	// SkipQueue publishes the user's clean submissions without waiting for a curator
+	SkipQueue Capability = "skip_queue"
+	// CuratorNomination promotes the user to curator
+	CuratorNomination Capability = "curator_nomination"
+)
+
+// Capabilities lists every capability in the order they are usually unlocked
+var Capabilities = []Capability{SkipQueue, CuratorNomination}
+
+// Policy decides how many points events are worth and which capabilities they unlock.
+// A nil Policy awards no points.
+type Policy struct {
+	// AcceptedPoints are awarded when a curator accepts one of the user's phrases
+	AcceptedPoints int
+	// RejectedPoints are awarded when a curator rejects one, so they are usually negative
+	RejectedPoints int
+	// PointsPerStar are awarded for every star another user rates one of the user's accepted phrases with
+	PointsPerStar int
+	// Thresholds are the reputation at which each capability unlocks. Capabilities without one never unlock.
+	Thresholds map[Capability]int
+}
+
+// Accepted returns the points for an accepted phrase.
+func (p *Policy) Accepted() int {
+	if p == nil {
+		return 0
+	}
+
+	return p.AcceptedPoints
+}
+
+// Rejected returns the points for a rejected phrase.
+func (p *Policy) Rejected() int {
+	if p == nil {
+		return 0
+	}
+
+	return p.RejectedPoints
+}
+
+// Rating returns the points for a rating changing from oldRating to newRating stars.
+// oldRating is 0 for a new rating.
+func (p *Policy) Rating(oldRating, newRating int) int {
+	if p == nil {
+		return 0
+	}
+
+	return (newRating - oldRating) * p.PointsPerStar
+}
+
+// Unlocked returns the capabilities whose threshold was crossed by reputation going from before to after.
+func (p *Policy) Unlocked(before, after int) []Capability {
+	unlocked := []Capability{}
+	if p == nil {
+		return unlocked
+	}
+
+	for _, capability := range Capabilities {
+		threshold, ok := p.Thresholds[capability]
+		if ok && threshold > 0 && before < threshold && after >= threshold {
+			unlocked = append(unlocked, capability)
+		}
+	}
+
+	return unlocked
+}
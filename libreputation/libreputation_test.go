@@ -0,0 +1,61 @@
+package libreputation
+
+import (
+	"testing"
+)
+
+func TestPolicyPoints(t *testing.T) {
+	policy := &Policy{AcceptedPoints: 10, RejectedPoints: -2, PointsPerStar: 1}
+
+	if points := policy.Accepted(); points != 10 {
+		t.Errorf("Accepted points are not as expected. Received: %v", points)
+	}
+	if points := policy.Rejected(); points != -2 {
+		t.Errorf("Rejected points are not as expected. Received: %v", points)
+	}
+	if points := policy.Rating(0, 4); points != 4 {
+		t.Errorf("A new 4 star rating should be worth 4 points. Received: %v", points)
+	}
+	if points := policy.Rating(5, 2); points != -3 {
+		t.Errorf("Lowering a rating from 5 to 2 stars should cost 3 points. Received: %v", points)
+	}
+
+	var none *Policy
+	if points := none.Accepted() + none.Rejected() + none.Rating(0, 5); points != 0 {
+		t.Errorf("A nil policy should award no points. Received: %v", points)
+	}
+}
+
+func TestPolicyUnlocked(t *testing.T) {
+	policy := &Policy{Thresholds: map[Capability]int{SkipQueue: 100, CuratorNomination: 500}}
+
+	tests := []struct {
+		before, after int
+		expected      []Capability
+	}{
+		{0, 50, []Capability{}},
+		{95, 105, []Capability{SkipQueue}},
+		{90, 100, []Capability{SkipQueue}},
+		{100, 110, []Capability{}},
+		{50, 600, []Capability{SkipQueue, CuratorNomination}},
+		{600, 50, []Capability{}},
+	}
+
+	for _, test := range tests {
+		unlocked := policy.Unlocked(test.before, test.after)
+		if len(unlocked) != len(test.expected) {
+			t.Errorf("Going from %v to %v should unlock %v. Received: %v", test.before, test.after, test.expected, unlocked)
+			continue
+		}
+		for i := range unlocked {
+			if unlocked[i] != test.expected[i] {
+				t.Errorf("Going from %v to %v should unlock %v. Received: %v", test.before, test.after, test.expected, unlocked)
+			}
+		}
+	}
+
+	disabled := &Policy{Thresholds: map[Capability]int{SkipQueue: 0}}
+	if unlocked := disabled.Unlocked(0, 1000); len(unlocked) != 0 {
+		t.Errorf("A threshold of 0 should disable the capability. Received: %v", unlocked)
+	}
+}
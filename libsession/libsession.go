@@ -0,0 +1,372 @@
+// Package libsession provides a gorilla/sessions store that keeps session values on the server.
+// The cookie only carries the signed and encrypted session ID, so sessions can be listed and revoked.
+package libsession
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+
+	"github.com/punocracy/punocracy/libhttp"
+)
+
+// ErrNotFound is returned by backends for unknown session IDs.
+var ErrNotFound = errors.New("session not found")
+
+// userIDKey remembers which user a stored session belongs to, so a login or logout gets a fresh session ID.
+const userIDKey = "libsession.userID"
+
+// lastSeenKey holds when the loaded session was last seen, so Touch can skip recent sessions. It is never saved.
+const lastSeenKey = "libsession.lastSeenAt"
+
+// DefaultTouchInterval is how often NewStore's stores record activity on a session
+const DefaultTouchInterval = time.Minute
+
+// Record is a session as kept by a Backend.
+type Record struct {
+	ID         string
+	UserID     int64
+	Data       []byte
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+// PublicID identifies the session in listings without revealing the ID itself.
+func (r *Record) PublicID() string {
+	digest := sha256.Sum256([]byte(r.ID))
+	return hex.EncodeToString(digest[:8])
+}
+
+// Backend persists session records.
+type Backend interface {
+	// Load returns ErrNotFound if there is no session with that ID
+	Load(id string) (*Record, error)
+	// Save creates or replaces a session but keeps the CreatedAt of an existing one
+	Save(record *Record) error
+	Touch(id string, lastSeenAt, expiresAt time.Time) error
+	Delete(id string) error
+	DeleteByUser(userID int64) error
+	ListByUser(userID int64) ([]*Record, error)
+	DeleteExpired(now time.Time) error
+}
+
+// CodecsFromSecrets derives a signing and an encryption key from each secret.
+// The first secret encodes new cookies, the others are only used to decode,
+// so secrets can be rotated by prepending a new one and later dropping the old one.
+func CodecsFromSecrets(secrets ...string) []securecookie.Codec {
+	keyPairs := make([][]byte, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		hashKey := sha256.Sum256([]byte("hash:" + secret))
+		blockKey := sha256.Sum256([]byte("block:" + secret))
+		keyPairs = append(keyPairs, hashKey[:], blockKey[:])
+	}
+
+	return securecookie.CodecsFromPairs(keyPairs...)
+}
+
+// Store implements sessions.Store on top of a Backend.
+type Store struct {
+	Backend Backend
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+	// UserID returns the user the session values belong to, or 0 for anonymous sessions
+	UserID func(values map[interface{}]interface{}) int64
+	// Transient lists the keys of values that only last for the request, like data loaded from elsewhere.
+	// They are left out when the session is saved.
+	Transient []string
+	// TouchInterval is how long Touch waits after the session was last seen before writing to the backend again
+	TouchInterval time.Duration
+	// Now is the clock, replaceable in tests
+	Now func() time.Time
+}
+
+// NewStore creates a Store whose sessions last maxAge seconds.
+func NewStore(backend Backend, userID func(map[interface{}]interface{}) int64, maxAge int, secrets ...string) *Store {
+	store := &Store{
+		Backend:       backend,
+		Codecs:        CodecsFromSecrets(secrets...),
+		Options:       &sessions.Options{Path: "/", MaxAge: maxAge, HttpOnly: true, SameSite: http.SameSiteLaxMode},
+		UserID:        userID,
+		TouchInterval: DefaultTouchInterval,
+		Now:           time.Now,
+	}
+
+	for _, codec := range store.Codecs {
+		if cookie, ok := codec.(*securecookie.SecureCookie); ok {
+			cookie.MaxAge(maxAge)
+		}
+	}
+
+	return store
+}
+
+// Get returns the session for the request, cached for the lifetime of the request.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named by the cookie, or starts a new one.
+// Cookies that cannot be decoded, for example because their key was rotated out, start a new session.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &id, s.Codecs...); err != nil {
+		return session, nil
+	}
+
+	record, err := s.Backend.Load(id)
+	if err == ErrNotFound {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if !s.Now().Before(record.ExpiresAt) {
+		return session, nil
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(record.Data)).Decode(&session.Values)
+	if err != nil {
+		return session, err
+	}
+
+	session.ID = id
+	session.IsNew = false
+	session.Values[lastSeenKey] = record.LastSeenAt
+
+	return session, nil
+}
+
+// Save stores the session values and sets the cookie.
+// A negative MaxAge deletes the session, and a session that changes user gets a new ID.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.Backend.Delete(session.ID); err != nil {
+				return err
+			}
+		}
+
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	userID := s.UserID(session.Values)
+
+	if previousUserID, ok := session.Values[userIDKey].(int64); session.ID != "" && ok && previousUserID != userID {
+		if err := s.Backend.Delete(session.ID); err != nil {
+			return err
+		}
+		session.ID = ""
+	}
+
+	if session.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+
+	session.Values[userIDKey] = userID
+
+	values := make(map[interface{}]interface{}, len(session.Values))
+	for key, value := range session.Values {
+		values[key] = value
+	}
+	delete(values, lastSeenKey)
+	for _, key := range s.Transient {
+		delete(values, key)
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(values); err != nil {
+		return err
+	}
+
+	now := s.Now()
+	err := s.Backend.Save(&Record{
+		ID:         session.ID,
+		UserID:     userID,
+		Data:       data.Bytes(),
+		UserAgent:  r.UserAgent(),
+		IPAddress:  libhttp.ClientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Duration(session.Options.MaxAge) * time.Second),
+	})
+	if err != nil {
+		return err
+	}
+
+	session.Values[lastSeenKey] = now
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Touch records activity on a stored session and extends its expiry.
+// Sessions seen less than TouchInterval ago are left alone, so busy sessions don't write on every request.
+func (s *Store) Touch(session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+
+	now := s.Now()
+	if lastSeenAt, ok := session.Values[lastSeenKey].(time.Time); ok && now.Sub(lastSeenAt) < s.TouchInterval {
+		return nil
+	}
+
+	err := s.Backend.Touch(session.ID, now, now.Add(time.Duration(session.Options.MaxAge)*time.Second))
+	if err == nil {
+		session.Values[lastSeenKey] = now
+	}
+
+	return err
+}
+
+func newID() (string, error) {
+	idBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(idBytes), nil
+}
+
+// MemoryBackend keeps sessions in memory. Sessions are lost on restart, so it is meant for tests and development.
+type MemoryBackend struct {
+	records map[string]Record
+	mutex   sync.Mutex
+}
+
+// NewMemoryBackend creates an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{records: make(map[string]Record)}
+}
+
+// Load implements Backend.
+func (m *MemoryBackend) Load(id string) (*Record, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	record, ok := m.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &record, nil
+}
+
+// Save implements Backend.
+func (m *MemoryBackend) Save(record *Record) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	saved := *record
+	if existing, ok := m.records[record.ID]; ok {
+		saved.CreatedAt = existing.CreatedAt
+	}
+	m.records[record.ID] = saved
+
+	return nil
+}
+
+// Touch implements Backend.
+func (m *MemoryBackend) Touch(id string, lastSeenAt, expiresAt time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if record, ok := m.records[id]; ok {
+		record.LastSeenAt = lastSeenAt
+		record.ExpiresAt = expiresAt
+		m.records[id] = record
+	}
+
+	return nil
+}
+
+// Delete implements Backend.
+func (m *MemoryBackend) Delete(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.records, id)
+	return nil
+}
+
+// DeleteByUser implements Backend.
+func (m *MemoryBackend) DeleteByUser(userID int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, record := range m.records {
+		if record.UserID == userID {
+			delete(m.records, id)
+		}
+	}
+
+	return nil
+}
+
+// ListByUser implements Backend. Sessions are sorted by last activity, most recent first.
+func (m *MemoryBackend) ListByUser(userID int64) ([]*Record, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	records := []*Record{}
+	for _, record := range m.records {
+		if record.UserID == userID {
+			record := record
+			records = append(records, &record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].LastSeenAt.After(records[j].LastSeenAt)
+	})
+
+	return records, nil
+}
+
+// DeleteExpired implements Backend.
+func (m *MemoryBackend) DeleteExpired(now time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, record := range m.records {
+		if !now.Before(record.ExpiresAt) {
+			delete(m.records, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package libsession
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testUserID(values map[interface{}]interface{}) int64 {
+	userID, _ := values["userID"].(int64)
+	return userID
+}
+
+// roundTrip saves the session of a request and returns a new request carrying the resulting cookie.
+func roundTrip(t *testing.T, store *Store, r *http.Request, change func(values map[interface{}]interface{})) (*http.Request, string) {
+	session, err := store.Get(r, "test-session")
+	if err != nil {
+		t.Fatalf("Getting session should not fail. Error: %v", err)
+	}
+
+	change(session.Values)
+
+	w := httptest.NewRecorder()
+	if err := session.Save(r, w); err != nil {
+		t.Fatalf("Saving session should not fail. Error: %v", err)
+	}
+
+	next := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Value != "" {
+			next.AddCookie(cookie)
+		}
+	}
+
+	return next, session.ID
+}
+
+func TestStore(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStore(backend, testUserID, 3600, "new secret", "old secret")
+
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time { return now }
+
+	r, anonymousID := roundTrip(t, store, httptest.NewRequest("GET", "/", nil), func(values map[interface{}]interface{}) {
+		values["theme"] = "dark"
+	})
+
+	// Logging in keeps the values but rotates the session ID
+	r, userID := roundTrip(t, store, r, func(values map[interface{}]interface{}) {
+		if values["theme"] != "dark" {
+			t.Errorf("Session values should survive a round trip. Received: %v", values)
+		}
+		values["userID"] = int64(7)
+	})
+	if userID == anonymousID {
+		t.Error("Session ID should change when the user changes.")
+	}
+	if _, err := backend.Load(anonymousID); err != ErrNotFound {
+		t.Errorf("Session of the previous user should be deleted. Received: %v", err)
+	}
+
+	records, _ := backend.ListByUser(7)
+	if len(records) != 1 || records[0].ID != userID || records[0].PublicID() == userID {
+		t.Errorf("User should have one listed session. Received: %v", records)
+	}
+
+	// Cookies signed with a rotated out secret are still accepted while the secret is listed
+	rotated := NewStore(backend, testUserID, 3600, "newest secret", "new secret")
+	rotated.Now = store.Now
+	session, _ := rotated.Get(r, "test-session")
+	if session.IsNew || session.ID != userID {
+		t.Errorf("Cookie encoded with an older secret should decode. Received: %v", session.ID)
+	}
+
+	unknown := NewStore(backend, testUserID, 3600, "unrelated secret")
+	unknown.Now = store.Now
+	session, _ = unknown.Get(cloneRequest(r), "test-session")
+	if !session.IsNew {
+		t.Error("Cookie encoded with an unknown secret should start a new session.")
+	}
+
+	// Revoking the user's sessions logs them out
+	backend.DeleteByUser(7)
+	session, _ = store.Get(cloneRequest(r), "test-session")
+	if !session.IsNew || session.Values["userID"] != nil {
+		t.Errorf("Revoked session should not load. Received: %v", session.Values)
+	}
+
+	// Expired sessions don't load
+	r, _ = roundTrip(t, store, httptest.NewRequest("GET", "/", nil), func(values map[interface{}]interface{}) {
+		values["userID"] = int64(8)
+	})
+	now = now.Add(2 * time.Hour)
+	session, _ = store.Get(r, "test-session")
+	if !session.IsNew {
+		t.Error("Expired session should not load.")
+	}
+
+	backend.DeleteExpired(now)
+	if records, _ := backend.ListByUser(8); len(records) != 0 {
+		t.Errorf("Expired sessions should be deleted. Received: %v", records)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	store := NewStore(NewMemoryBackend(), testUserID, 3600, "secret")
+	store.Transient = []string{"user"}
+
+	r, _ := roundTrip(t, store, httptest.NewRequest("GET", "/", nil), func(values map[interface{}]interface{}) {
+		values["userID"] = int64(7)
+		values["user"] = "loaded for this request"
+	})
+
+	session, _ := store.Get(r, "test-session")
+	if session.Values["userID"] != int64(7) || session.Values["user"] != nil {
+		t.Errorf("Only the values that aren't transient should be saved. Received: %v", session.Values)
+	}
+}
+
+// countingBackend counts the calls to Touch
+type countingBackend struct {
+	*MemoryBackend
+	touches int
+}
+
+func (c *countingBackend) Touch(id string, lastSeenAt, expiresAt time.Time) error {
+	c.touches++
+	return c.MemoryBackend.Touch(id, lastSeenAt, expiresAt)
+}
+
+func TestTouchInterval(t *testing.T) {
+	backend := &countingBackend{MemoryBackend: NewMemoryBackend()}
+	store := NewStore(backend, testUserID, 3600, "secret")
+
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time { return now }
+
+	r, id := roundTrip(t, store, httptest.NewRequest("GET", "/", nil), func(values map[interface{}]interface{}) {
+		values["userID"] = int64(7)
+	})
+
+	now = now.Add(30 * time.Second)
+	session, _ := store.Get(cloneRequest(r), "test-session")
+	store.Touch(session)
+	if backend.touches != 0 {
+		t.Errorf("Sessions seen within the touch interval should not be touched. Received: %v touches", backend.touches)
+	}
+
+	now = now.Add(time.Minute)
+	session, _ = store.Get(cloneRequest(r), "test-session")
+	store.Touch(session)
+	store.Touch(session)
+	if backend.touches != 1 {
+		t.Errorf("Sessions should be touched once the interval passed. Received: %v touches", backend.touches)
+	}
+
+	record, _ := backend.Load(id)
+	if !record.LastSeenAt.Equal(now) {
+		t.Errorf("Touching should record the activity. Received: %v", record.LastSeenAt)
+	}
+}
+
+// cloneRequest copies the cookies of r into a fresh request, so the session registry of r isn't reused.
+func cloneRequest(r *http.Request) *http.Request {
+	clone := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range r.Cookies() {
+		clone.AddCookie(cookie)
+	}
+	return clone
+}
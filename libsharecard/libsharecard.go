@@ -0,0 +1,141 @@
+// Package libsharecard renders the PNG image shown when a phrase is shared on social media.
+// Everything is drawn locally with the bundled Go fonts, so no external service is involved.
+package libsharecard
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Width and Height are the size recommended for OpenGraph and Twitter summary_large_image cards.
+const (
+	Width  = 1200
+	Height = 630
+
+	margin       = 80
+	maxTextLines = 6
+)
+
+var (
+	background = color.RGBA{0x2c, 0x3e, 0x50, 0xff}
+	foreground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	accent     = color.RGBA{0x18, 0xbc, 0x9c, 0xff}
+	muted      = color.RGBA{0x95, 0xa5, 0xa6, 0xff}
+)
+
+// Card is what is shown on a share card.
+type Card struct {
+	Text   string
+	Author string
+	// Rating is the average star rating, 0 when the phrase hasn't been rated
+	Rating float64
+}
+
+// Render draws card and writes it to w as a PNG.
+func Render(w io.Writer, card Card) error {
+	textFace, err := newFace(gobold.TTF, 56)
+	if err != nil {
+		return err
+	}
+	defer textFace.Close()
+
+	smallFace, err := newFace(goregular.TTF, 32)
+	if err != nil {
+		return err
+	}
+	defer smallFace.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, Width, 12), image.NewUniform(accent), image.Point{}, draw.Src)
+
+	lineHeight := textFace.Metrics().Height.Ceil() + 12
+	lines := Wrap(textFace, card.Text, Width-2*margin, maxTextLines)
+
+	// Centre the phrase in the space above the footer
+	y := margin + (Height-2*margin-60-len(lines)*lineHeight)/2 + textFace.Metrics().Ascent.Ceil()
+	for _, line := range lines {
+		drawString(img, textFace, foreground, margin, y, line)
+		y += lineHeight
+	}
+
+	footerY := Height - margin
+	if card.Author != "" {
+		drawString(img, smallFace, muted, margin, footerY, "— "+card.Author)
+	}
+
+	footer := "Punocracy"
+	if card.Rating > 0 {
+		footer = fmt.Sprintf("%.1f / 5 on Punocracy", card.Rating)
+	}
+	footerWidth := font.MeasureString(smallFace, footer).Ceil()
+	drawString(img, smallFace, accent, Width-margin-footerWidth, footerY, footer)
+
+	return png.Encode(w, img)
+}
+
+// Wrap breaks text into lines no wider than width pixels when drawn with face.
+// Words wider than a line get a line of their own. At most maxLines lines are returned,
+// the last one ending in an ellipsis if text had to be cut.
+func Wrap(face font.Face, text string, width, maxLines int) []string {
+	lines := []string{}
+	line := ""
+
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+
+		if line != "" && font.MeasureString(face, candidate).Ceil() > width {
+			lines = append(lines, line)
+			line = word
+		} else {
+			line = candidate
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := lines[maxLines-1]
+		for strings.Contains(last, " ") && font.MeasureString(face, last+"…").Ceil() > width {
+			last = last[:strings.LastIndex(last, " ")]
+		}
+		lines[maxLines-1] = last + "…"
+	}
+
+	return lines
+}
+
+func newFace(ttf []byte, size float64) (font.Face, error) {
+	parsed, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, err
+	}
+
+	return opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+func drawString(img draw.Image, face font.Face, c color.Color, x, y int, s string) {
+	drawer := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	drawer.DrawString(s)
+}
@@ -0,0 +1,61 @@
+package libsharecard
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestWrap(t *testing.T) {
+	face, err := newFace(goregular.TTF, 20)
+	if err != nil {
+		t.Fatalf("Parsing the font should work. Error: %v", err)
+	}
+	defer face.Close()
+
+	text := "I used to be a banker but I lost interest in the whole thing"
+	width := font.MeasureString(face, "I used to be a banker").Ceil()
+
+	lines := Wrap(face, text, width, 10)
+	if len(lines) < 2 {
+		t.Errorf("Long text should be wrapped. Received: %v", lines)
+	}
+	for _, line := range lines {
+		if font.MeasureString(face, line).Ceil() > width {
+			t.Errorf("Lines should fit the width. Received: %q", line)
+		}
+	}
+	if strings.Join(lines, " ") != text {
+		t.Errorf("Wrapping should keep every word. Received: %v", lines)
+	}
+
+	cut := Wrap(face, text, width, 2)
+	if len(cut) != 2 || !strings.HasSuffix(cut[1], "…") {
+		t.Errorf("Text longer than maxLines should be cut with an ellipsis. Received: %v", cut)
+	}
+
+	if lines := Wrap(face, "supercalifragilistic", 1, 3); len(lines) != 1 {
+		t.Errorf("A word wider than a line should get its own line. Received: %v", lines)
+	}
+}
+
+func TestRender(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := Render(&buf, Card{Text: "Time flies like an arrow; fruit flies like a banana.", Author: "groucho", Rating: 4.5})
+	if err != nil {
+		t.Fatalf("Rendering should work. Error: %v", err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("The card should be a valid PNG. Error: %v", err)
+	}
+	if img.Bounds().Dx() != Width || img.Bounds().Dy() != Height {
+		t.Errorf("The card should be %vx%v. Received: %v", Width, Height, img.Bounds())
+	}
+}
@@ -0,0 +1,447 @@
+// Package libslash speaks the slash command formats of Slack and Discord:
+// it verifies request signatures, parses commands and button presses, and encodes replies with buttons.
+package libslash
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Platforms a command can come from
+const (
+	Slack   = "slack"
+	Discord = "discord"
+)
+
+// Signature headers
+const (
+	SlackTimestampHeader   = "X-Slack-Request-Timestamp"
+	SlackSignatureHeader   = "X-Slack-Signature"
+	DiscordTimestampHeader = "X-Signature-Timestamp"
+	DiscordSignatureHeader = "X-Signature-Ed25519"
+)
+
+// SignatureTolerance is how old a signed request can be before it is refused as a replay
+const SignatureTolerance = 5 * time.Minute
+
+// MaxSections is how many sections with buttons one reply can have. Discord allows five rows of buttons.
+const MaxSections = 5
+
+// DiscordMaxContent is how many characters Discord allows in a message
+const DiscordMaxContent = 2000
+
+var ErrInvalidSignature = errors.New("libslash: invalid signature")
+var ErrSignatureExpired = errors.New("libslash: signature timestamp is too old")
+var ErrInvalidPublicKey = errors.New("libslash: invalid Discord public key")
+var ErrMalformedRequest = errors.New("libslash: malformed request")
+
+// Command is a slash command or a button press, whichever chat it came from
+type Command struct {
+	Platform string
+	// Name is the command without its slash, empty for button presses
+	Name string
+	// Text is what was typed after the command
+	Text     string
+	UserID   string
+	UserName string
+	// Action is the value of the pressed button, empty for commands
+	Action string
+	// ResponseURL is where Slack takes the reply to a button press
+	ResponseURL string
+	// Ping is set for the requests Discord sends to check the endpoint
+	Ping bool
+}
+
+// Button either sends Action back when pressed or opens URL
+type Button struct {
+	Label  string
+	Action string
+	URL    string
+}
+
+// Section is a paragraph of a reply with an optional row of up to five buttons
+type Section struct {
+	Text    string
+	Buttons []Button
+}
+
+// Response is a reply to a command or button press
+type Response struct {
+	Text string
+	// Public replies are shown to the whole channel, the others only to whoever ran the command
+	Public   bool
+	Sections []Section
+}
+
+func checkTimestamp(timestamp string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if math.Abs(now.Sub(time.Unix(seconds, 0)).Seconds()) > SignatureTolerance.Seconds() {
+		return ErrSignatureExpired
+	}
+
+	return nil
+}
+
+// SignSlack computes the X-Slack-Signature of body sent at timestamp
+func SignSlack(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:", timestamp)
+	mac.Write(body)
+
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySlack checks that a request was signed with the app's signing secret recently
+func VerifySlack(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get(SlackTimestampHeader)
+	if err := checkTimestamp(timestamp, now); err != nil {
+		return err
+	}
+
+	seconds, _ := strconv.ParseInt(timestamp, 10, 64)
+	if !hmac.Equal([]byte(SignSlack(secret, seconds, body)), []byte(header.Get(SlackSignatureHeader))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// ParseDiscordPublicKey decodes the hex public key shown in the Discord developer portal
+func ParseDiscordPublicKey(hexKey string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// SignDiscord computes the X-Signature-Ed25519 of body sent at timestamp
+func SignDiscord(key ed25519.PrivateKey, timestamp int64, body []byte) string {
+	message := append([]byte(strconv.FormatInt(timestamp, 10)), body...)
+	return hex.EncodeToString(ed25519.Sign(key, message))
+}
+
+// VerifyDiscord checks that a request was signed by Discord recently
+func VerifyDiscord(key ed25519.PublicKey, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get(DiscordTimestampHeader)
+	if err := checkTimestamp(timestamp, now); err != nil {
+		return err
+	}
+
+	signature, err := hex.DecodeString(header.Get(DiscordSignatureHeader))
+	if err != nil || !ed25519.Verify(key, append([]byte(timestamp), body...), signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Actions []struct {
+		Value string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// ParseSlack reads a slash command, or a button press if the form has a payload
+func ParseSlack(body []byte) (Command, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return Command{}, ErrMalformedRequest
+	}
+
+	if payload := form.Get("payload"); payload != "" {
+		var interaction slackInteraction
+		if err := json.Unmarshal([]byte(payload), &interaction); err != nil || interaction.Type != "block_actions" {
+			return Command{}, ErrMalformedRequest
+		}
+
+		command := Command{
+			Platform:    Slack,
+			UserID:      interaction.User.ID,
+			UserName:    interaction.User.Username,
+			ResponseURL: interaction.ResponseURL,
+		}
+		// Link buttons report their clicks too, without a value
+		if len(interaction.Actions) > 0 {
+			command.Action = interaction.Actions[0].Value
+		}
+
+		return command, nil
+	}
+
+	if form.Get("command") == "" {
+		return Command{}, ErrMalformedRequest
+	}
+
+	return Command{
+		Platform:    Slack,
+		Name:        strings.TrimPrefix(form.Get("command"), "/"),
+		Text:        strings.TrimSpace(form.Get("text")),
+		UserID:      form.Get("user_id"),
+		UserName:    form.Get("user_name"),
+		ResponseURL: form.Get("response_url"),
+	}, nil
+}
+
+// Discord interaction and response types
+const (
+	discordPing             = 1
+	discordApplicationCmd   = 2
+	discordMessageComponent = 3
+
+	discordPong                     = 1
+	discordChannelMessageWithSource = 4
+
+	discordEphemeral = 64
+)
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type discordInteraction struct {
+	Type int `json:"type"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Value interface{} `json:"value"`
+		} `json:"options"`
+		CustomID string `json:"custom_id"`
+	} `json:"data"`
+	// Member is set in servers and User in direct messages
+	Member *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+}
+
+// ParseDiscord reads an interaction: a ping, a slash command or a button press
+func ParseDiscord(body []byte) (Command, error) {
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		return Command{}, ErrMalformedRequest
+	}
+
+	command := Command{Platform: Discord}
+	if interaction.Member != nil {
+		command.UserID = interaction.Member.User.ID
+		command.UserName = interaction.Member.User.Username
+	} else if interaction.User != nil {
+		command.UserID = interaction.User.ID
+		command.UserName = interaction.User.Username
+	}
+
+	switch interaction.Type {
+	case discordPing:
+		command.Ping = true
+	case discordApplicationCmd:
+		command.Name = interaction.Data.Name
+		values := []string{}
+		for _, option := range interaction.Data.Options {
+			values = append(values, fmt.Sprint(option.Value))
+		}
+		command.Text = strings.TrimSpace(strings.Join(values, " "))
+	case discordMessageComponent:
+		command.Action = interaction.Data.CustomID
+	default:
+		return Command{}, ErrMalformedRequest
+	}
+
+	return command, nil
+}
+
+// escapeSlack escapes the characters Slack reserves for links and mentions
+func escapeSlack(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// EncodeSlack writes a reply in Slack's message format, with the sections as Block Kit blocks
+func EncodeSlack(response Response) ([]byte, error) {
+	return json.Marshal(slackMessage(response))
+}
+
+// EncodeSlackFollowUp writes a reply to a button press, to be posted to its ResponseURL.
+// It is added below the message with the button instead of replacing it.
+func EncodeSlackFollowUp(response Response) ([]byte, error) {
+	message := slackMessage(response)
+	message["replace_original"] = false
+
+	return json.Marshal(message)
+}
+
+func slackMessage(response Response) map[string]interface{} {
+	message := map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          escapeSlack(response.Text),
+	}
+	if response.Public {
+		message["response_type"] = "in_channel"
+	}
+
+	blocks := []interface{}{}
+	if response.Text != "" {
+		blocks = append(blocks, slackSection(response.Text))
+	}
+	for i, section := range response.Sections {
+		blocks = append(blocks, slackSection(section.Text))
+
+		if len(section.Buttons) == 0 {
+			continue
+		}
+
+		elements := []interface{}{}
+		for j, button := range section.Buttons {
+			element := map[string]interface{}{
+				"type":      "button",
+				"text":      map[string]interface{}{"type": "plain_text", "text": button.Label},
+				"action_id": fmt.Sprintf("button_%d_%d", i, j),
+			}
+			if button.URL != "" {
+				element["url"] = button.URL
+			} else {
+				element["value"] = button.Action
+			}
+			elements = append(elements, element)
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "actions", "elements": elements})
+	}
+	message["blocks"] = blocks
+
+	return message
+}
+
+func slackSection(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": escapeSlack(text)},
+	}
+}
+
+// shorten cuts text to at most length characters, marking the cut with an ellipsis
+func shorten(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	if length <= 0 {
+		return ""
+	}
+
+	return string(runes[:length-1]) + "…"
+}
+
+// EncodeDiscord writes a reply in Discord's interaction response format, with a row of buttons per section.
+// Sections that don't fit in DiscordMaxContent are left out along with their buttons, the first one is shortened instead.
+func EncodeDiscord(response Response) ([]byte, error) {
+	paragraphs := []string{}
+	length := 0
+	if response.Text != "" {
+		text := shorten(response.Text, DiscordMaxContent)
+		paragraphs = append(paragraphs, text)
+		length = utf8.RuneCountInString(text)
+	}
+
+	rows := []interface{}{}
+	for i, section := range response.Sections {
+		separator := 0
+		if len(paragraphs) > 0 {
+			separator = len("\n\n")
+		}
+
+		text := section.Text
+		if length+separator+utf8.RuneCountInString(text) > DiscordMaxContent {
+			if i > 0 {
+				break
+			}
+			text = shorten(text, DiscordMaxContent-length-separator)
+			if text == "" {
+				break
+			}
+		}
+		paragraphs = append(paragraphs, text)
+		length += separator + utf8.RuneCountInString(text)
+
+		if len(section.Buttons) == 0 || len(rows) == MaxSections {
+			continue
+		}
+
+		components := []interface{}{}
+		for _, button := range section.Buttons {
+			component := map[string]interface{}{"type": 2, "label": button.Label}
+			if button.URL != "" {
+				// Link style
+				component["style"] = 5
+				component["url"] = button.URL
+			} else {
+				// Primary style
+				component["style"] = 1
+				component["custom_id"] = button.Action
+			}
+			components = append(components, component)
+		}
+		rows = append(rows, map[string]interface{}{"type": 1, "components": components})
+	}
+
+	data := map[string]interface{}{
+		"content":    strings.Join(paragraphs, "\n\n"),
+		"components": rows,
+		// Puns quote user submitted text, which must not ping anyone
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+	if !response.Public {
+		data["flags"] = discordEphemeral
+	}
+
+	return json.Marshal(map[string]interface{}{"type": discordChannelMessageWithSource, "data": data})
+}
+
+// DiscordPong is the answer to Discord's pings
+func DiscordPong() []byte {
+	body, _ := json.Marshal(map[string]interface{}{"type": discordPong})
+	return body
+}
+
+// PostFollowUp sends a Slack follow-up reply to the response URL of a button press
+func PostFollowUp(client *http.Client, responseURL string, response Response) error {
+	body, err := EncodeSlackFollowUp(response)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("libslash: response URL answered %v", resp.Status)
+	}
+
+	return nil
+}
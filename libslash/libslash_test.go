@@ -0,0 +1,270 @@
+package libslash
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestVerifySlack(t *testing.T) {
+	now := time.Now()
+	body := []byte("command=%2Fpun&text=quill&user_id=U1")
+
+	header := http.Header{}
+	header.Set(SlackTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	header.Set(SlackSignatureHeader, SignSlack("signing-secret", now.Unix(), body))
+
+	if err := VerifySlack("signing-secret", header, body, now); err != nil {
+		t.Errorf("A correctly signed request should verify. Error: %v", err)
+	}
+	if err := VerifySlack("other-secret", header, body, now); err != ErrInvalidSignature {
+		t.Errorf("Another secret should not verify. Received: %v", err)
+	}
+	if err := VerifySlack("signing-secret", header, []byte("command=%2Fpun&text=quilt&user_id=U1"), now); err != ErrInvalidSignature {
+		t.Errorf("A tampered body should not verify. Received: %v", err)
+	}
+	if err := VerifySlack("signing-secret", header, body, now.Add(10*time.Minute)); err != ErrSignatureExpired {
+		t.Errorf("Old requests should be refused as replays. Received: %v", err)
+	}
+
+	header.Del(SlackTimestampHeader)
+	if err := VerifySlack("signing-secret", header, body, now); err != ErrInvalidSignature {
+		t.Errorf("Requests without a timestamp should not verify. Received: %v", err)
+	}
+}
+
+func TestVerifyDiscord(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Generating a key should work. Error: %v", err)
+	}
+
+	parsedKey, err := ParseDiscordPublicKey(hex.EncodeToString(publicKey))
+	if err != nil {
+		t.Fatalf("A hex public key should parse. Error: %v", err)
+	}
+	if _, err := ParseDiscordPublicKey("abcd"); err != ErrInvalidPublicKey {
+		t.Errorf("Short keys should be refused. Received: %v", err)
+	}
+
+	now := time.Now()
+	body := []byte(`{"type":1}`)
+
+	header := http.Header{}
+	header.Set(DiscordTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	header.Set(DiscordSignatureHeader, SignDiscord(privateKey, now.Unix(), body))
+
+	if err := VerifyDiscord(parsedKey, header, body, now); err != nil {
+		t.Errorf("A correctly signed request should verify. Error: %v", err)
+	}
+	if err := VerifyDiscord(parsedKey, header, []byte(`{"type":2}`), now); err != ErrInvalidSignature {
+		t.Errorf("A tampered body should not verify. Received: %v", err)
+	}
+	if err := VerifyDiscord(parsedKey, header, body, now.Add(-10*time.Minute)); err != ErrSignatureExpired {
+		t.Errorf("Old requests should be refused as replays. Received: %v", err)
+	}
+
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	if err := VerifyDiscord(otherKey, header, body, now); err != ErrInvalidSignature {
+		t.Errorf("Another key should not verify. Received: %v", err)
+	}
+}
+
+func TestParseSlack(t *testing.T) {
+	command, err := ParseSlack([]byte("command=%2Fpun&text=+Quill+&user_id=U1&user_name=sam&response_url=https%3A%2F%2Fhooks.slack.com%2F1"))
+	if err != nil {
+		t.Fatalf("A slash command should parse. Error: %v", err)
+	}
+	expected := Command{Platform: Slack, Name: "pun", Text: "Quill", UserID: "U1", UserName: "sam", ResponseURL: "https://hooks.slack.com/1"}
+	if command != expected {
+		t.Errorf("The command should be read from the form. Received: %+v", command)
+	}
+
+	payload := `{"type":"block_actions","user":{"id":"U1","username":"sam"},"actions":[{"value":"rate:abc:5"}],"response_url":"https://hooks.slack.com/2"}`
+	command, err = ParseSlack([]byte("payload=" + url.QueryEscape(payload)))
+	if err != nil {
+		t.Fatalf("A button press should parse. Error: %v", err)
+	}
+	if command.Action != "rate:abc:5" || command.UserID != "U1" || command.ResponseURL != "https://hooks.slack.com/2" || command.Name != "" {
+		t.Errorf("The button press should be read from the payload. Received: %+v", command)
+	}
+
+	if _, err := ParseSlack([]byte("text=quill")); err != ErrMalformedRequest {
+		t.Errorf("Forms without a command should be refused. Received: %v", err)
+	}
+}
+
+func TestParseDiscord(t *testing.T) {
+	command, err := ParseDiscord([]byte(`{"type":1}`))
+	if err != nil || !command.Ping {
+		t.Errorf("Pings should parse. Received: %+v, %v", command, err)
+	}
+
+	command, err = ParseDiscord([]byte(`{"type":2,"data":{"name":"pun","options":[{"name":"word","type":3,"value":"quill"}]},"member":{"user":{"id":"42","username":"sam"}}}`))
+	if err != nil {
+		t.Fatalf("A slash command should parse. Error: %v", err)
+	}
+	expected := Command{Platform: Discord, Name: "pun", Text: "quill", UserID: "42", UserName: "sam"}
+	if command != expected {
+		t.Errorf("The command should be read from the interaction. Received: %+v", command)
+	}
+
+	command, err = ParseDiscord([]byte(`{"type":3,"data":{"custom_id":"rate:abc:4"},"user":{"id":"42","username":"sam"}}`))
+	if err != nil || command.Action != "rate:abc:4" || command.UserID != "42" {
+		t.Errorf("A button press in a direct message should parse. Received: %+v, %v", command, err)
+	}
+
+	if _, err := ParseDiscord([]byte(`{"type":9}`)); err != ErrMalformedRequest {
+		t.Errorf("Unknown interactions should be refused. Received: %v", err)
+	}
+}
+
+var testResponse = Response{
+	Text:   "Puns on <quill> & more",
+	Public: true,
+	Sections: []Section{
+		{Text: "Quill me softly", Buttons: []Button{{Label: "1★", Action: "rate:abc:1"}, {Label: "View", URL: "https://punocracy.example/phrases/abc"}}},
+	},
+}
+
+func TestEncodeSlack(t *testing.T) {
+	body, err := EncodeSlack(testResponse)
+	if err != nil {
+		t.Fatalf("Encoding should work. Error: %v", err)
+	}
+
+	var message struct {
+		ResponseType string `json:"response_type"`
+		Text         string `json:"text"`
+		Blocks       []struct {
+			Type     string `json:"type"`
+			Elements []struct {
+				Value string `json:"value"`
+				URL   string `json:"url"`
+			} `json:"elements"`
+		} `json:"blocks"`
+	}
+	json.Unmarshal(body, &message)
+
+	if message.ResponseType != "in_channel" {
+		t.Errorf("Public replies should be shown in the channel. Received: %v", message.ResponseType)
+	}
+	if message.Text != "Puns on &lt;quill&gt; &amp; more" {
+		t.Errorf("Text should be escaped so it cannot mention anyone. Received: %v", message.Text)
+	}
+	if len(message.Blocks) != 3 || message.Blocks[2].Type != "actions" {
+		t.Fatalf("Sections with buttons should become a section and an actions block. Received: %s", body)
+	}
+	if elements := message.Blocks[2].Elements; elements[0].Value != "rate:abc:1" || elements[1].URL == "" {
+		t.Errorf("Buttons should carry their action or URL. Received: %+v", elements)
+	}
+
+	testResponse.Public = false
+	defer func() { testResponse.Public = true }()
+
+	body, _ = EncodeSlackFollowUp(testResponse)
+	var followUp map[string]interface{}
+	json.Unmarshal(body, &followUp)
+	if followUp["response_type"] != "ephemeral" || followUp["replace_original"] != false {
+		t.Errorf("Follow-ups should be private and not replace the message. Received: %s", body)
+	}
+}
+
+func TestEncodeDiscord(t *testing.T) {
+	sections := []Section{}
+	for i := 0; i < MaxSections+1; i++ {
+		sections = append(sections, Section{Text: "pun", Buttons: []Button{{Label: "5★", Action: "rate:abc:5"}}})
+	}
+
+	body, err := EncodeDiscord(Response{Text: "Puns", Sections: sections})
+	if err != nil {
+		t.Fatalf("Encoding should work. Error: %v", err)
+	}
+
+	var response struct {
+		Type int `json:"type"`
+		Data struct {
+			Content    string        `json:"content"`
+			Flags      int           `json:"flags"`
+			Components []interface{} `json:"components"`
+		} `json:"data"`
+	}
+	json.Unmarshal(body, &response)
+
+	if response.Type != 4 {
+		t.Errorf("Replies should be channel messages. Received: %v", response.Type)
+	}
+	if response.Data.Flags != 64 {
+		t.Errorf("Private replies should be ephemeral. Received: %v", response.Data.Flags)
+	}
+	if len(response.Data.Components) != MaxSections {
+		t.Errorf("Discord allows at most %v rows of buttons. Received: %v", MaxSections, len(response.Data.Components))
+	}
+}
+
+func TestEncodeDiscordContentLimit(t *testing.T) {
+	decode := func(body []byte) (string, int) {
+		var response struct {
+			Data struct {
+				Content    string        `json:"content"`
+				Components []interface{} `json:"components"`
+			} `json:"data"`
+		}
+		json.Unmarshal(body, &response)
+		return response.Data.Content, len(response.Data.Components)
+	}
+
+	long := strings.Repeat("ü", 700)
+	sections := []Section{}
+	for i := 0; i < MaxSections; i++ {
+		sections = append(sections, Section{Text: long, Buttons: []Button{{Label: "5★", Action: "rate:abc:5"}}})
+	}
+
+	body, err := EncodeDiscord(Response{Text: "Puns", Sections: sections})
+	if err != nil {
+		t.Fatalf("Encoding should work. Error: %v", err)
+	}
+	content, rows := decode(body)
+	if length := utf8.RuneCountInString(content); length > DiscordMaxContent {
+		t.Errorf("Content should fit in a Discord message. Received: %v characters", length)
+	}
+	if rows != 2 {
+		t.Errorf("Sections that don't fit should be left out with their buttons. Received: %v rows", rows)
+	}
+
+	body, _ = EncodeDiscord(Response{Text: "Puns", Sections: []Section{{Text: strings.Repeat("ü", 3000)}}})
+	content, _ = decode(body)
+	if length := utf8.RuneCountInString(content); length != DiscordMaxContent || !strings.HasSuffix(content, "…") {
+		t.Errorf("A section too long on its own should be shortened. Received: %v characters", length)
+	}
+}
+
+func TestPostFollowUp(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- body
+	}))
+	defer server.Close()
+
+	err := PostFollowUp(server.Client(), server.URL, Response{Text: "Rated 5 stars"})
+	if err != nil {
+		t.Fatalf("Posting should work. Error: %v", err)
+	}
+
+	var message map[string]interface{}
+	json.Unmarshal(<-received, &message)
+	if message["text"] != "Rated 5 stars" {
+		t.Errorf("The reply should be posted to the response URL. Received: %v", message)
+	}
+}
@@ -0,0 +1,210 @@
+// Package libsse streams Server-Sent Events to browsers.
+// Every connection subscribes to topics and has its own bounded queue, so a slow client never holds up publishers;
+// a client that falls too far behind is disconnected and left to reconnect.
+package libsse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrStreamingUnsupported = errors.New("libsse: the response cannot be streamed")
+var ErrClosed = errors.New("libsse: the broker is closed")
+var ErrSlowClient = errors.New("libsse: the client fell too far behind")
+var ErrTooManyClients = errors.New("libsse: too many open streams")
+
+// Defaults NewBroker uses for settings that aren't positive
+const (
+	DefaultBufferSize = 32
+	DefaultHeartbeat  = 15 * time.Second
+	DefaultRetry      = 5 * time.Second
+)
+
+// Message is one event of a stream
+type Message struct {
+	// Event is the type browsers listen to with addEventListener. Empty means "message".
+	Event string
+	Data  []byte
+}
+
+// WriteTo writes the message in the text/event-stream format
+func (m Message) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+
+	if m.Event != "" {
+		fmt.Fprintf(&buf, "event: %v\n", m.Event)
+	}
+	for _, line := range bytes.Split(m.Data, []byte("\n")) {
+		fmt.Fprintf(&buf, "data: %s\n", bytes.TrimSuffix(line, []byte("\r")))
+	}
+	buf.WriteString("\n")
+
+	return buf.WriteTo(w)
+}
+
+type client struct {
+	topics map[string]bool
+	queue  chan Message
+	// slow is closed when the client's queue overflowed
+	slow chan struct{}
+}
+
+// Broker hands published messages to the clients streaming the topic
+type Broker struct {
+	// BufferSize is how many messages a client can fall behind by before it is disconnected
+	BufferSize int
+	// Heartbeat is how often idle streams get a comment, so proxies don't time them out
+	Heartbeat time.Duration
+	// Retry tells browsers how long to wait before reconnecting
+	Retry time.Duration
+	// MaxClients is how many streams can be open at once. Zero means no limit.
+	MaxClients int
+
+	mu      sync.Mutex
+	clients map[*client]bool
+	closed  chan struct{}
+}
+
+// NewBroker creates a broker without clients. Settings that aren't positive get their defaults,
+// as a zero heartbeat or a negative buffer size would make every stream panic.
+func NewBroker(bufferSize int, heartbeat, retry time.Duration, maxClients int) *Broker {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	if heartbeat <= 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	if retry <= 0 {
+		retry = DefaultRetry
+	}
+	if maxClients < 0 {
+		maxClients = 0
+	}
+
+	return &Broker{
+		BufferSize: bufferSize,
+		Heartbeat:  heartbeat,
+		Retry:      retry,
+		MaxClients: maxClients,
+		clients:    make(map[*client]bool),
+		closed:     make(chan struct{}),
+	}
+}
+
+// Publish queues the message for every client streaming the topic without waiting for them
+func (b *Broker) Publish(topic string, m Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for c := range b.clients {
+		if !c.topics[topic] {
+			continue
+		}
+
+		select {
+		case c.queue <- m:
+		default:
+			delete(b.clients, c)
+			close(c.slow)
+		}
+	}
+}
+
+// Clients counts the open streams
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.clients)
+}
+
+// Close ends every stream and refuses new ones
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.closed:
+	default:
+		close(b.closed)
+	}
+}
+
+// Stream sends the initial messages, then the messages published to topics until the client goes away or the broker closes.
+// It returns ErrSlowClient if the client was disconnected for falling behind,
+// and ErrTooManyClients without writing anything if MaxClients streams are open already.
+func (b *Broker) Stream(w http.ResponseWriter, r *http.Request, topics []string, initial ...Message) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return ErrStreamingUnsupported
+	}
+
+	c := &client{topics: make(map[string]bool), queue: make(chan Message, b.BufferSize), slow: make(chan struct{})}
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+
+	b.mu.Lock()
+	select {
+	case <-b.closed:
+		b.mu.Unlock()
+		return ErrClosed
+	default:
+	}
+	if b.MaxClients > 0 && len(b.clients) >= b.MaxClients {
+		b.mu.Unlock()
+		return ErrTooManyClients
+	}
+	b.clients[c] = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", b.Retry/time.Millisecond); err != nil {
+		return err
+	}
+	for _, m := range initial {
+		if _, err := m.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(b.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-b.closed:
+			return nil
+		case <-c.slow:
+			return ErrSlowClient
+		case m := <-c.queue:
+			if _, err := m.WriteTo(w); err != nil {
+				return err
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+		}
+
+		flusher.Flush()
+	}
+}
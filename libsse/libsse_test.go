@@ -0,0 +1,224 @@
+package libsse
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMessageWriteTo(t *testing.T) {
+	var buf bytes.Buffer
+	Message{Event: "rating", Data: []byte("first\nsecond")}.WriteTo(&buf)
+
+	expected := "event: rating\ndata: first\ndata: second\n\n"
+	if buf.String() != expected {
+		t.Errorf("Every line of data should get its own field. Received: %q", buf.String())
+	}
+}
+
+// readEvent reads the next event or comment block from a stream
+func readEvent(t *testing.T, reader *bufio.Reader) string {
+	var block strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("The stream should not end yet. Error: %v", err)
+		}
+		if line == "\n" {
+			return block.String()
+		}
+		block.WriteString(line)
+	}
+}
+
+func waitForClients(t *testing.T, broker *Broker, count int) {
+	for i := 0; broker.Clients() != count; i++ {
+		if i == 100 {
+			t.Fatalf("Expected %v clients. Received: %v", count, broker.Clients())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStream(t *testing.T) {
+	broker := NewBroker(10, time.Hour, 3*time.Second, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		broker.Stream(w, r, []string{"phrase:1"}, Message{Event: "hello", Data: []byte("{}")})
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Connecting should work. Error: %v", err)
+	}
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Streams should be text/event-stream. Received: %v", contentType)
+	}
+
+	reader := bufio.NewReader(response.Body)
+	if retry := readEvent(t, reader); retry != "retry: 3000\n" {
+		t.Errorf("Streams should start with the reconnection delay. Received: %q", retry)
+	}
+	if hello := readEvent(t, reader); hello != "event: hello\ndata: {}\n" {
+		t.Errorf("The initial messages should follow. Received: %q", hello)
+	}
+
+	waitForClients(t, broker, 1)
+	broker.Publish("phrase:2", Message{Event: "rating", Data: []byte("2")})
+	broker.Publish("phrase:1", Message{Event: "rating", Data: []byte("1")})
+
+	if rating := readEvent(t, reader); rating != "event: rating\ndata: 1\n" {
+		t.Errorf("Only messages of subscribed topics should be streamed. Received: %q", rating)
+	}
+
+	broker.Close()
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Errorf("Closing the broker should end the stream")
+	}
+	waitForClients(t, broker, 0)
+}
+
+func TestHeartbeat(t *testing.T) {
+	broker := NewBroker(10, 10*time.Millisecond, time.Second, 0)
+	defer broker.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		broker.Stream(w, r, nil)
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Connecting should work. Error: %v", err)
+	}
+	defer response.Body.Close()
+
+	reader := bufio.NewReader(response.Body)
+	readEvent(t, reader)
+	if heartbeat := readEvent(t, reader); heartbeat != ": heartbeat\n" {
+		t.Errorf("Idle streams should get heartbeats. Received: %q", heartbeat)
+	}
+}
+
+// stalledWriter is a response whose writes hang once stalled, like a client that stopped reading
+type stalledWriter struct {
+	header  http.Header
+	mu      sync.Mutex
+	stalled bool
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (s *stalledWriter) Header() http.Header {
+	return s.header
+}
+
+func (s *stalledWriter) WriteHeader(status int) {}
+
+func (s *stalledWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	stalled := s.stalled
+	s.mu.Unlock()
+
+	if stalled {
+		s.writing <- struct{}{}
+		<-s.release
+	}
+
+	return len(p), nil
+}
+
+func (s *stalledWriter) Flush() {}
+
+func TestSlowClient(t *testing.T) {
+	broker := NewBroker(1, time.Hour, time.Second, 0)
+	defer broker.Close()
+
+	w := &stalledWriter{header: http.Header{}, writing: make(chan struct{}, 10), release: make(chan struct{})}
+	r := httptest.NewRequest("GET", "/events", nil)
+
+	result := make(chan error)
+	go func() {
+		result <- broker.Stream(w, r, []string{"accepted"})
+	}()
+	waitForClients(t, broker, 1)
+
+	w.mu.Lock()
+	w.stalled = true
+	w.mu.Unlock()
+
+	// The first message is stuck being written, the second fills the queue and the third doesn't fit
+	broker.Publish("accepted", Message{Data: []byte("1")})
+	<-w.writing
+	broker.Publish("accepted", Message{Data: []byte("2")})
+	broker.Publish("accepted", Message{Data: []byte("3")})
+
+	if clients := broker.Clients(); clients != 0 {
+		t.Errorf("Clients that fall behind should be dropped. Received: %v", clients)
+	}
+
+	close(w.release)
+	if err := <-result; err != ErrSlowClient {
+		t.Errorf("The stream of a client that fell behind should end. Received: %v", err)
+	}
+}
+
+func TestNewBrokerDefaults(t *testing.T) {
+	broker := NewBroker(-1, 0, -time.Second, -1)
+
+	if broker.BufferSize != DefaultBufferSize || broker.Heartbeat != DefaultHeartbeat || broker.Retry != DefaultRetry || broker.MaxClients != 0 {
+		t.Errorf("Settings that aren't positive should get their defaults. Received: %+v", broker)
+	}
+}
+
+func TestMaxClients(t *testing.T) {
+	broker := NewBroker(10, time.Hour, time.Second, 1)
+	defer broker.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		broker.Stream(w, r, nil)
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Connecting should work. Error: %v", err)
+	}
+	defer response.Body.Close()
+	waitForClients(t, broker, 1)
+
+	err = broker.Stream(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil), nil)
+	if err != ErrTooManyClients {
+		t.Errorf("Streams over MaxClients should be refused. Received: %v", err)
+	}
+}
+
+func TestClosedBroker(t *testing.T) {
+	broker := NewBroker(10, time.Hour, time.Second, 0)
+	broker.Close()
+	broker.Close()
+
+	err := broker.Stream(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil), nil)
+	if err != ErrClosed {
+		t.Errorf("A closed broker should refuse new streams. Received: %v", err)
+	}
+}
+
+func TestStreamingUnsupported(t *testing.T) {
+	broker := NewBroker(10, time.Hour, time.Second, 0)
+	defer broker.Close()
+
+	var w struct{ http.ResponseWriter }
+	err := broker.Stream(w, httptest.NewRequest("GET", "/events", nil), nil)
+	if err != ErrStreamingUnsupported {
+		t.Errorf("Responses that cannot flush should be refused. Received: %v", err)
+	}
+}
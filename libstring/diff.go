@@ -0,0 +1,79 @@
+package libstring
+
+import (
+	"strings"
+)
+
+// DiffKind tells whether a piece of a diff was kept, inserted or deleted.
+type DiffKind int
+
+const (
+	// DiffEqual marks words present in both texts
+	DiffEqual DiffKind = iota
+	// DiffInsert marks words only present in the new text
+	DiffInsert
+	// DiffDelete marks words only present in the old text
+	DiffDelete
+)
+
+// DiffChunk is a run of words sharing the same DiffKind.
+type DiffChunk struct {
+	Kind DiffKind
+	Text string
+}
+
+// DiffWords computes a word-level diff between two texts, splitting on whitespace.
+// Consecutive words of the same kind are merged into a single chunk.
+func DiffWords(oldText, newText string) []DiffChunk {
+	a := strings.Fields(oldText)
+	b := strings.Fields(newText)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	chunks := []DiffChunk{}
+	add := func(kind DiffKind, word string) {
+		if n := len(chunks); n > 0 && chunks[n-1].Kind == kind {
+			chunks[n-1].Text += " " + word
+			return
+		}
+		chunks = append(chunks, DiffChunk{Kind: kind, Text: word})
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			add(DiffEqual, a[i])
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			add(DiffDelete, a[i])
+			i++
+		} else {
+			add(DiffInsert, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(DiffDelete, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(DiffInsert, b[j])
+	}
+
+	return chunks
+}
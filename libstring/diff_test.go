@@ -0,0 +1,26 @@
+package libstring
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffWords(t *testing.T) {
+	chunks := DiffWords("To right with a broken pencil is pointless", "To write with a broken pencil is pointless!")
+	expected := []DiffChunk{
+		{DiffEqual, "To"},
+		{DiffDelete, "right"},
+		{DiffInsert, "write"},
+		{DiffEqual, "with a broken pencil is"},
+		{DiffDelete, "pointless"},
+		{DiffInsert, "pointless!"},
+	}
+
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("Diff is not as expected. Received: %v", chunks)
+	}
+
+	if chunks := DiffWords("", ""); len(chunks) != 0 {
+		t.Errorf("Diff of empty texts should be empty. Received: %v", chunks)
+	}
+}
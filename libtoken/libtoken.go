@@ -0,0 +1,91 @@
+// Package libtoken creates and verifies signed, expiring tokens for links sent by email.
+package libtoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, tampered with or meant for another purpose.
+var ErrInvalidToken = errors.New("token is invalid")
+
+// ErrExpiredToken is returned for tokens whose expiry has passed.
+var ErrExpiredToken = errors.New("token has expired")
+
+// Claims is what a token vouches for.
+type Claims struct {
+	Purpose string
+	Subject int64
+	Expires time.Time
+	// Nonce makes every token unique, so it can be tracked for single use
+	Nonce string
+}
+
+// Sign encodes the claims and signs them with an HMAC-SHA256 of secret.
+func Sign(secret []byte, claims Claims) string {
+	payload := strings.Join([]string{
+		claims.Purpose,
+		strconv.FormatInt(claims.Subject, 10),
+		strconv.FormatInt(claims.Expires.Unix(), 10),
+		claims.Nonce,
+	}, "|")
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encodedPayload + "." + signature(secret, encodedPayload)
+}
+
+// Verify checks the signature, purpose and expiry of a token and returns its claims.
+func Verify(secret []byte, purpose string, token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return Claims{}, ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(signature(secret, parts[0]))) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	fields := strings.Split(string(payload), "|")
+	if len(fields) != 4 || fields[0] != purpose {
+		return Claims{}, ErrInvalidToken
+	}
+
+	subject, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	claims := Claims{
+		Purpose: fields[0],
+		Subject: subject,
+		Expires: time.Unix(expires, 0),
+		Nonce:   fields[3],
+	}
+
+	if !now.Before(claims.Expires) {
+		return claims, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+func signature(secret []byte, encodedPayload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,38 @@
+package libtoken
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("zu7HZy1Da2abXWPP")
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+	claims := Claims{Purpose: "password-reset", Subject: 42, Expires: now.Add(time.Hour), Nonce: "abc"}
+	token := Sign(secret, claims)
+
+	verified, err := Verify(secret, "password-reset", token, now)
+	if err != nil {
+		t.Fatalf("Verifying a fresh token should not fail. Error: %v", err)
+	}
+	if verified.Subject != 42 || verified.Nonce != "abc" || !verified.Expires.Equal(claims.Expires) {
+		t.Errorf("Claims are not as expected. Received: %#v", verified)
+	}
+
+	if _, err := Verify(secret, "verify-email", token, now); err != ErrInvalidToken {
+		t.Errorf("Token for another purpose should be invalid. Error: %v", err)
+	}
+	if _, err := Verify([]byte("another secret"), "password-reset", token, now); err != ErrInvalidToken {
+		t.Errorf("Token signed with another secret should be invalid. Error: %v", err)
+	}
+	if _, err := Verify(secret, "password-reset", token+"x", now); err != ErrInvalidToken {
+		t.Errorf("Tampered token should be invalid. Error: %v", err)
+	}
+	if _, err := Verify(secret, "password-reset", "garbage", now); err != ErrInvalidToken {
+		t.Errorf("Malformed token should be invalid. Error: %v", err)
+	}
+	if _, err := Verify(secret, "password-reset", token, now.Add(time.Hour)); err != ErrExpiredToken {
+		t.Errorf("Token past its expiry should be expired. Error: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package libtokenize provides the word tokenizer shared by phrase indexing and pun generation.
+package libtokenize
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is a single word found in a piece of text.
+// Start and End are byte offsets into the original text, so Text == text[Start:End].
+type Token struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Key returns the normalized form of the token used for word lookups.
+func (t Token) Key() string {
+	return Normalize(t.Text)
+}
+
+// isApostrophe reports whether r is one of the apostrophe forms people type.
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’' || r == 'ʼ'
+}
+
+// isWordRune reports whether r can be part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// Tokenize splits text into word tokens.
+// Punctuation and whitespace separate words, hyphenated compounds are split into their parts,
+// and apostrophes between letters are kept so contractions such as "can't" stay whole.
+func Tokenize(text string) []Token {
+	tokens := []Token{}
+	runes := []rune(text)
+
+	// Byte offset of every rune, plus the end of the string
+	offsets := make([]int, len(runes)+1)
+	offset := 0
+	for i, r := range runes {
+		offsets[i] = offset
+		offset += len(string(r))
+	}
+	offsets[len(runes)] = offset
+
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		inWord := false
+		if i < len(runes) {
+			r := runes[i]
+			if isWordRune(r) {
+				inWord = true
+			} else if isApostrophe(r) && start >= 0 && i+1 < len(runes) && isWordRune(runes[i+1]) {
+				// Apostrophe inside a word, e.g. "don't" or "dog's"
+				inWord = true
+			}
+		}
+
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			tokens = append(tokens, Token{
+				Text:  text[offsets[start]:offsets[i]],
+				Start: offsets[start],
+				End:   offsets[i],
+			})
+			start = -1
+		}
+	}
+
+	return tokens
+}
+
+// Normalize lowercases a word and replaces typographic apostrophes with ASCII ones.
+func Normalize(word string) string {
+	word = strings.Map(func(r rune) rune {
+		if isApostrophe(r) {
+			return '\''
+		}
+		return r
+	}, word)
+
+	return strings.ToLower(word)
+}
+
+// Stem strips a possessive suffix from a normalized word, so "dog's" becomes "dog".
+// Other contractions are returned unchanged.
+func Stem(word string) string {
+	return strings.TrimSuffix(word, "'s")
+}
+
+// Words returns the unique normalized words of text in the order they first appear.
+// Possessives contribute both their full form and their stem.
+func Words(text string) []string {
+	seen := make(map[string]bool)
+	words := []string{}
+
+	add := func(word string) {
+		if word == "" || seen[word] {
+			return
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+
+	for _, token := range Tokenize(text) {
+		key := token.Key()
+		add(key)
+		add(Stem(key))
+	}
+
+	return words
+}
@@ -0,0 +1,44 @@
+package libtokenize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"Time flies, like an arrow.", []string{"Time", "flies", "like", "an", "arrow"}},
+		{"I can't stop—won't stop!", []string{"I", "can't", "stop", "won't", "stop"}},
+		{"A well-known dog's bark", []string{"A", "well", "known", "dog's", "bark"}},
+		{"'Quoted' words'", []string{"Quoted", "words"}},
+		{"Café au lait, s’il vous plaît", []string{"Café", "au", "lait", "s’il", "vous", "plaît"}},
+		{"   ", []string{}},
+	}
+
+	for _, test := range tests {
+		tokens := Tokenize(test.input)
+		texts := []string{}
+		for _, token := range tokens {
+			if test.input[token.Start:token.End] != token.Text {
+				t.Errorf("Token offsets do not match text. Input: %q, token: %#v", test.input, token)
+			}
+			texts = append(texts, token.Text)
+		}
+
+		if !reflect.DeepEqual(texts, test.expected) {
+			t.Errorf("Tokenize(%q) = %q, expected %q", test.input, texts, test.expected)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	words := Words("The dog’s toy and the DOG, well-known.")
+	expected := []string{"the", "dog's", "dog", "toy", "and", "well", "known"}
+
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("Words returned %q, expected %q", words, expected)
+	}
+}
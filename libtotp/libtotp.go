@@ -0,0 +1,121 @@
+// Package libtotp implements time-based one-time passwords (RFC 6238) as used by authenticator apps,
+// and the recovery codes that stand in for them when the authenticator is lost.
+package libtotp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Period is how long a code is valid, Digits how long it is. These are what authenticator apps assume.
+const (
+	Period = 30
+	Digits = 6
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random base32 encoded secret.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(secret), nil
+}
+
+// Counter returns the time step t falls in.
+func Counter(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code returns the code for secret at the given time step.
+func Code(secret string, counter int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.Replace(secret, " ", "", -1)))
+	if err != nil {
+		return "", err
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, truncated%1000000), nil
+}
+
+// Validate checks code against the time steps around t, allowing skew steps of clock drift either way.
+// It returns the matching time step so callers can refuse to accept it twice.
+func Validate(secret, code string, t time.Time, skew int) (int64, bool) {
+	code = strings.Replace(code, " ", "", -1)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	now := Counter(t)
+	for offset := -int64(skew); offset <= int64(skew); offset++ {
+		expected, err := Code(secret, now+offset)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return now + offset, true
+		}
+	}
+
+	return 0, false
+}
+
+// ProvisioningURI is the otpauth:// URI authenticator apps import, usually by scanning it as a QR code.
+func ProvisioningURI(issuer, account, secret string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(Digits)},
+		"period":    {fmt.Sprint(Period)},
+	}
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// GenerateRecoveryCodes returns count random codes formatted like "a1b2c-3d4e5".
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, count)
+	for i := range codes {
+		random := make([]byte, 5)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+
+		code := hex.EncodeToString(random)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode returns the digest recovery codes are stored as.
+// Codes are random enough that a fast hash can't be brute forced.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.Replace(strings.Replace(code, "-", "", -1), " ", "", -1))
+
+	digest := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,72 @@
+package libtotp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// RFC 6238 test vectors for SHA1, last 6 digits
+	secret := encoding.EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := Code(secret, Counter(time.Unix(unix, 0)))
+		if err != nil || code != expected {
+			t.Errorf("Code at %v should be %v. Received: %v, error: %v", unix, expected, code, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("Generating secret should not fail. Error: %v", err)
+	}
+
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+	code, _ := Code(secret, Counter(now.Add(-Period*time.Second)))
+
+	counter, ok := Validate(secret, code[:3]+" "+code[3:], now, 1)
+	if !ok || counter != Counter(now)-1 {
+		t.Errorf("Code from the previous period should validate with skew 1. Received: %v, %v", counter, ok)
+	}
+
+	if _, ok := Validate(secret, code, now, 0); ok {
+		t.Error("Code from the previous period should not validate without skew.")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Error("Code with the wrong length should not validate.")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Punocracy", "pun master", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Punocracy:pun%20master?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("Provisioning URI is not as expected. Received: %v", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("Generating recovery codes should not fail. Received: %v, error: %v", codes, err)
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.Replace(codes[0], "-", "", 1))) {
+		t.Error("Recovery code hash should ignore case, spaces and dashes.")
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Error("Different recovery codes should have different hashes.")
+	}
+}
@@ -0,0 +1,258 @@
+// Package libwebhook signs webhook payloads and delivers them with exponential backoff.
+package libwebhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Punocracy-Event"
+	DeliveryHeader  = "X-Punocracy-Delivery"
+	SignatureHeader = "X-Punocracy-Signature"
+)
+
+var ErrInvalidSignature = errors.New("libwebhook: invalid signature")
+var ErrSignatureExpired = errors.New("libwebhook: signature timestamp is too old")
+var ErrPrivateAddress = errors.New("libwebhook: webhooks can't be delivered to loopback or private addresses")
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	// ID identifies the event. Redeliveries keep it, so receivers can skip events they already handled.
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// Encode marshals a payload for event with data under a new random ID
+func Encode(event string, data interface{}, createdAt time.Time) ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Payload{ID: hex.EncodeToString(id), Event: event, CreatedAt: createdAt.UTC(), Data: data})
+}
+
+// Sign returns the signature header value for body sent at timestamp.
+// The timestamp is signed along with the body, so a captured delivery can't be replayed later.
+func Sign(secret string, body []byte, timestamp time.Time) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks a signature header made by Sign. Signatures older than tolerance are refused.
+// Receivers written in Go can use it as is.
+func Verify(secret string, body []byte, signature string, now time.Time, tolerance time.Duration) error {
+	var t, v1 string
+	for _, part := range strings.Split(signature, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			t = kv[1]
+		case "v1":
+			v1 = kv[1]
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected, err := hex.DecodeString(v1)
+	if err != nil || !hmac.Equal(expected, mac(secret, t, body)) {
+		return ErrInvalidSignature
+	}
+	if now.Sub(time.Unix(unix, 0)) > tolerance {
+		return ErrSignatureExpired
+	}
+
+	return nil
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "."))
+	h.Write(body)
+
+	return h.Sum(nil)
+}
+
+// Policy decides when failed deliveries are retried
+type Policy struct {
+	// MaxAttempts is how many times a delivery is tried before giving up
+	MaxAttempts int
+	// BaseDelay is the wait after the first failure. It doubles with every further failure.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between attempts
+	MaxDelay time.Duration
+}
+
+// Backoff returns how long to wait after the given number of failed attempts
+func (p Policy) Backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// Delivery is a payload to send to one webhook
+type Delivery struct {
+	ID      int64
+	URL     string
+	Secret  string
+	Event   string
+	Payload []byte
+	// Attempts counts earlier attempts, not the one about to be made
+	Attempts int
+}
+
+// Attempt is the outcome of sending a delivery once
+type Attempt struct {
+	// StatusCode is 0 when no response was received
+	StatusCode int
+	// Err is nil when the receiver answered with a 2xx status
+	Err error
+	At  time.Time
+	// NextAttempt is when to retry, unless the delivery succeeded or GaveUp is set
+	NextAttempt time.Time
+	GaveUp      bool
+}
+
+// Delivered reports whether the receiver accepted the delivery
+func (a Attempt) Delivered() bool {
+	return a.Err == nil
+}
+
+// Sender posts deliveries to their webhooks
+type Sender struct {
+	Client *http.Client
+	Policy Policy
+
+	// Now is the clock, replaceable in tests
+	Now func() time.Time
+}
+
+// NewSender creates a sender whose requests time out after timeout.
+// It refuses to connect to loopback and private addresses, however the webhook's host name resolves,
+// so webhooks can't be used to reach services inside the network.
+func NewSender(policy Policy, timeout time.Duration) *Sender {
+	dialer := &net.Dialer{Timeout: timeout, Control: refusePrivateAddresses}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Connect to receivers directly, so it's their address that gets checked
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	return &Sender{
+		Client: &http.Client{Timeout: timeout, Transport: transport},
+		Policy: policy,
+		Now:    time.Now,
+	}
+}
+
+// IsPrivateHost reports whether host is a loopback, private, link-local or unspecified IP address,
+// or a name for the local host. Other names are checked when a delivery connects.
+func IsPrivateHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && isPrivateIP(ip)
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// refusePrivateAddresses is a net.Dialer Control that stops connections to private addresses
+func refusePrivateAddresses(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivateIP(ip) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
+
+// Send posts a delivery once and decides when to retry it if it failed
+func (s *Sender) Send(d Delivery) Attempt {
+	attempt := Attempt{At: s.Now()}
+
+	attempt.StatusCode, attempt.Err = s.post(d, attempt.At)
+	if attempt.Err != nil {
+		attempts := d.Attempts + 1
+		if attempts >= s.Policy.MaxAttempts {
+			attempt.GaveUp = true
+		} else {
+			attempt.NextAttempt = attempt.At.Add(s.Policy.Backoff(attempts))
+		}
+	}
+
+	return attempt
+}
+
+func (s *Sender) post(d Delivery, now time.Time) (int, error) {
+	req, err := http.NewRequest("POST", d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Punocracy-Webhooks/1.0")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, d.Payload, now))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a little of the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("libwebhook: receiver answered %v", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
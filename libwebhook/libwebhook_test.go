@@ -0,0 +1,137 @@
+package libwebhook
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"event":"phrase.accepted"}`)
+
+	signature := Sign("secret", body, now)
+
+	if err := Verify("secret", body, signature, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Errorf("A fresh signature should verify. Error: %v", err)
+	}
+	if err := Verify("other", body, signature, now, 5*time.Minute); err != ErrInvalidSignature {
+		t.Errorf("A signature made with another secret should not verify. Received: %v", err)
+	}
+	if err := Verify("secret", []byte(`{"event":"phrase.rejected"}`), signature, now, 5*time.Minute); err != ErrInvalidSignature {
+		t.Errorf("A signature of another body should not verify. Received: %v", err)
+	}
+	if err := Verify("secret", body, signature, now.Add(time.Hour), 5*time.Minute); err != ErrSignatureExpired {
+		t.Errorf("Old signatures should be refused. Received: %v", err)
+	}
+	if err := Verify("secret", body, "garbage", now, 5*time.Minute); err != ErrInvalidSignature {
+		t.Errorf("Malformed signatures should be refused. Received: %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{MaxAttempts: 10, BaseDelay: 30 * time.Second, MaxDelay: 10 * time.Minute}
+
+	expected := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for i, delay := range expected {
+		if received := policy.Backoff(i + 1); received != delay {
+			t.Errorf("Backoff after %v failures should be %v. Received: %v", i+1, delay, received)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	now := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+	var received *http.Request
+	var receivedBody []byte
+	fail := false
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(Policy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}, time.Second)
+	sender.Now = func() time.Time { return now }
+	// The receiver listens on loopback, which the sender's own client refuses to connect to
+	sender.Client = receiver.Client()
+
+	payload, err := Encode("phrase.accepted", map[string]string{"id": "abc"}, now)
+	if err != nil {
+		t.Fatalf("Encoding a payload should work. Error: %v", err)
+	}
+
+	delivery := Delivery{ID: 42, URL: receiver.URL, Secret: "secret", Event: "phrase.accepted", Payload: payload}
+
+	attempt := sender.Send(delivery)
+	if !attempt.Delivered() || attempt.StatusCode != http.StatusOK {
+		t.Fatalf("The delivery should succeed. Received: %+v", attempt)
+	}
+	if received.Header.Get(EventHeader) != "phrase.accepted" || received.Header.Get(DeliveryHeader) != "42" {
+		t.Errorf("The event and delivery ID should be sent as headers. Received: %v", received.Header)
+	}
+	if err := Verify("secret", receivedBody, received.Header.Get(SignatureHeader), now, time.Minute); err != nil {
+		t.Errorf("The receiver should be able to verify the signature. Error: %v", err)
+	}
+
+	fail = true
+
+	attempt = sender.Send(delivery)
+	if attempt.Delivered() || attempt.StatusCode != http.StatusInternalServerError || attempt.GaveUp {
+		t.Fatalf("A 500 should be a failure to retry. Received: %+v", attempt)
+	}
+	if !attempt.NextAttempt.Equal(now.Add(time.Minute)) {
+		t.Errorf("The first retry should wait the base delay. Received: %v", attempt.NextAttempt)
+	}
+
+	delivery.Attempts = 2
+	attempt = sender.Send(delivery)
+	if !attempt.GaveUp {
+		t.Errorf("The last attempt should give up. Received: %+v", attempt)
+	}
+
+	receiver.Close()
+	delivery.Attempts = 0
+	attempt = sender.Send(delivery)
+	if attempt.Delivered() || attempt.StatusCode != 0 {
+		t.Errorf("Unreachable receivers should fail without a status. Received: %+v", attempt)
+	}
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Deliveries to loopback addresses should not be sent.")
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(Policy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}, time.Second)
+
+	attempt := sender.Send(Delivery{ID: 1, URL: receiver.URL, Secret: "secret", Event: "phrase.accepted", Payload: []byte("{}")})
+	if !errors.Is(attempt.Err, ErrPrivateAddress) {
+		t.Errorf("Connecting to a loopback address should fail. Received: %v", attempt.Err)
+	}
+}
+
+func TestIsPrivateHost(t *testing.T) {
+	private := []string{"localhost", "api.localhost", "127.0.0.1", "::1", "10.0.0.5", "192.168.1.1", "172.16.0.1", "169.254.169.254", "fd00::1", "0.0.0.0"}
+	for _, host := range private {
+		if !IsPrivateHost(host) {
+			t.Errorf("%v should be a private host.", host)
+		}
+	}
+
+	public := []string{"example.com", "93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"}
+	for _, host := range public {
+		if IsPrivateHost(host) {
+			t.Errorf("%v should not be a private host.", host)
+		}
+	}
+}
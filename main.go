@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/gob"
 	"net/http"
 	"strings"
 	"time"
@@ -11,24 +10,82 @@ import (
 	"github.com/tylerb/graceful"
 
 	"github.com/punocracy/punocracy/application"
-	"github.com/punocracy/punocracy/models"
 )
 
-func init() {
-	gob.Register(&models.UserRow{})
-}
-
 func newConfig() (*viper.Viper, error) {
 	defaultDSN := strings.Replace("alvaro:quiabo@tcp(localhost:3306)/punocracy?parseTime=true", "-", "_", -1)
 
 	c := viper.New()
 	c.SetDefault("dsn", defaultDSN)
 	c.SetDefault("mongoURL", "mongodb://localhost:27017")
-	c.SetDefault("cookie_secret", "zu7HZy1Da2abXWPP")
+	c.SetDefault("cookie_secret", "")
+	c.SetDefault("session_keys", "")
+	c.SetDefault("session_max_age", "720h")
 	c.SetDefault("http_addr", ":8888")
 	c.SetDefault("http_cert_file", "")
 	c.SetDefault("http_key_file", "")
 	c.SetDefault("http_drain_interval", "1s")
+	c.SetDefault("ratelimit_submit", "10/h")
+	c.SetDefault("ratelimit_signup", "5/h")
+	c.SetDefault("ratelimit_login", "20/m")
+	c.SetDefault("ratelimit_rating", "120/m")
+	c.SetDefault("ratelimit_email", "5/h")
+	c.SetDefault("ratelimit_comment", "30/h")
+	c.SetDefault("max_unreviewed_submissions", 10)
+	c.SetDefault("login_backoff_after", 3)
+	c.SetDefault("login_backoff_delay", "1s")
+	c.SetDefault("login_lockout_after", 10)
+	c.SetDefault("login_ip_backoff_after", 20)
+	c.SetDefault("login_ip_lockout_after", 100)
+	c.SetDefault("login_lockout_duration", "15m")
+	c.SetDefault("base_url", "http://localhost:8888")
+	c.SetDefault("token_secret", "")
+	c.SetDefault("email_verification_ttl", "48h")
+	c.SetDefault("password_reset_ttl", "1h")
+	c.SetDefault("require_verified_email", false)
+	// Account emails aren't sent until a mailer is chosen. "log" writes them, links included, to the log.
+	c.SetDefault("mailer", "none")
+	c.SetDefault("mail_from", "Punocracy <no-reply@localhost>")
+	c.SetDefault("mail_file", "mail.txt")
+	c.SetDefault("smtp_addr", "localhost:25")
+	c.SetDefault("smtp_username", "")
+	c.SetDefault("smtp_password", "")
+	c.SetDefault("oidc_providers", "")
+	c.SetDefault("password_min_length", 8)
+	c.SetDefault("password_breached_file", "")
+	c.SetDefault("password_hash", "bcrypt")
+	c.SetDefault("password_bcrypt_cost", 12)
+	c.SetDefault("password_argon2_time", 1)
+	c.SetDefault("password_argon2_memory", 64*1024)
+	c.SetDefault("password_argon2_threads", 4)
+	c.SetDefault("require_2fa_for_curators", false)
+	c.SetDefault("totp_issuer", "Punocracy")
+	c.SetDefault("leaderboard_size", 10)
+	c.SetDefault("leaderboard_refresh_interval", "15m")
+	c.SetDefault("pun_of_the_day_timezone", "UTC")
+	c.SetDefault("pun_of_the_day_check_interval", "10m")
+	c.SetDefault("reputation_accepted_points", 10)
+	c.SetDefault("reputation_rejected_points", -2)
+	c.SetDefault("reputation_points_per_star", 1)
+	c.SetDefault("reputation_skip_queue_threshold", 200)
+	c.SetDefault("reputation_curator_nomination_threshold", 500)
+	c.SetDefault("event_drain_timeout", "10s")
+	c.SetDefault("webhook_check_interval", "10s")
+	c.SetDefault("webhook_timeout", "10s")
+	c.SetDefault("webhook_max_attempts", 8)
+	c.SetDefault("webhook_backoff", "30s")
+	c.SetDefault("webhook_max_backoff", "6h")
+	c.SetDefault("notification_queue_threshold", 20)
+	c.SetDefault("notification_digest_interval", "24h")
+	c.SetDefault("live_buffer_size", 32)
+	c.SetDefault("live_heartbeat", "15s")
+	c.SetDefault("live_retry", "5s")
+	c.SetDefault("live_max_streams", 1000)
+	c.SetDefault("slash_slack_signing_secret", "")
+	c.SetDefault("slash_discord_public_key", "")
+	c.SetDefault("slash_slack_identity_provider", "slack")
+	c.SetDefault("slash_discord_identity_provider", "discord")
+	c.SetDefault("slash_public", true)
 
 	c.AutomaticEnv()
 
@@ -65,6 +122,8 @@ func main() {
 	srv := &graceful.Server{
 		Timeout: drainInterval,
 		Server:  &http.Server{Addr: serverAddress, Handler: middle},
+		// Live event streams never finish on their own, so they are ended for the server to drain
+		ShutdownInitiated: app.CloseLiveStreams,
 	}
 
 	logrus.Infoln("Running HTTP server on " + serverAddress)
@@ -75,6 +134,9 @@ func main() {
 		err = srv.ListenAndServe()
 	}
 
+	// Requests are drained by now, so nothing publishes events anymore
+	app.Close()
+
 	if err != nil {
 		logrus.Fatal(err)
 	}
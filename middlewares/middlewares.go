@@ -2,7 +2,15 @@
 package middlewares
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 
 	"context"
 
@@ -11,6 +19,20 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+
+	"github.com/punocracy/punocracy/libcsrf"
+	"github.com/punocracy/punocracy/libevent"
+	"github.com/punocracy/punocracy/libhttp"
+	"github.com/punocracy/punocracy/liblockout"
+	"github.com/punocracy/punocracy/libmail"
+	"github.com/punocracy/punocracy/liboidc"
+	"github.com/punocracy/punocracy/libpassword"
+	"github.com/punocracy/punocracy/libratelimit"
+	"github.com/punocracy/punocracy/libreputation"
+	"github.com/punocracy/punocracy/libsession"
+	"github.com/punocracy/punocracy/libsse"
+	"github.com/punocracy/punocracy/models"
 )
 
 func SetMongo(db *mongo.Database) func(http.Handler) http.Handler {
@@ -33,6 +55,16 @@ func SetDB(db *sqlx.DB) func(http.Handler) http.Handler {
 	}
 }
 
+func SetConfig(config *viper.Viper) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "config", config))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
 func SetSessionStore(sessionStore sessions.Store) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
@@ -43,6 +75,106 @@ func SetSessionStore(sessionStore sessions.Store) func(http.Handler) http.Handle
 	}
 }
 
+func SetLoginGuard(guard *liblockout.Guard) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "loginGuard", guard))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetMailer(mailer libmail.Mailer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "mailer", mailer))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetPasswordPolicy(policy *libpassword.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "passwordPolicy", policy))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetPasswordHasher(hasher *libpassword.Hasher) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "passwordHasher", hasher))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetOIDCClients(clients map[string]*liboidc.Client) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "oidcClients", clients))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetReputationPolicy(policy *libreputation.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "reputationPolicy", policy))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetLeaderboards(leaderboards *models.LeaderboardCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "leaderboards", leaderboards))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetPunOfTheDay(scheduler *models.PunOfTheDayScheduler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "punOfTheDay", scheduler))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetEvents(events *libevent.Bus) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "events", events))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func SetLive(live *libsse.Broker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(context.WithValue(req.Context(), "live", live))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
 func Logging() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
@@ -53,6 +185,134 @@ func Logging() func(http.Handler) http.Handler {
 	}
 }
 
+// LoadUser is a middleware that loads the logged in user from the DB on every request,
+// so permission changes and deleted accounts take effect immediately.
+// The session only keeps the user's ID; the user is available as session.Values["user"] for the request.
+func LoadUser(sessionStore *libsession.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			session, err := sessionStore.Get(req, "punocracy-session")
+			if err != nil {
+				logrus.Errorln(err)
+			}
+
+			if userID, ok := session.Values["userID"].(int64); ok {
+				db := req.Context().Value("db").(*sqlx.DB)
+
+				user, err := models.NewUser(db).GetByID(nil, userID)
+				if err == sql.ErrNoRows {
+					session.Options.MaxAge = -1
+					err = session.Save(req, res)
+					delete(session.Values, "userID")
+					delete(session.Values, "user")
+				} else if err == nil {
+					session.Values["user"] = user
+					err = sessionStore.Touch(session)
+				} else {
+					delete(session.Values, "user")
+				}
+
+				if err != nil {
+					logrus.Errorln(err)
+				}
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// CSRF is a middleware that rejects state-changing requests without a valid CSRF token
+// and makes the token for the current client available to templates as "csrfToken".
+// Tokens are bound to the session ID, or before there is a session, to a random cookie.
+// Paths under exemptPrefixes authenticate with API tokens rather than cookies and are not checked.
+func CSRF(sessionStore *libsession.Store, secret []byte, exemptPrefixes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			for _, prefix := range exemptPrefixes {
+				if strings.HasPrefix(req.URL.Path, prefix) {
+					next.ServeHTTP(res, req)
+					return
+				}
+			}
+
+			session, _ := sessionStore.Get(req, "punocracy-session")
+
+			binding := session.ID
+			if binding == "" {
+				cookie, err := req.Cookie("punocracy-csrf")
+				if err == nil {
+					binding = cookie.Value
+				} else {
+					nonce := make([]byte, 32)
+					if _, err := rand.Read(nonce); err != nil {
+						libhttp.HandleErrorJson(res, err)
+						return
+					}
+
+					binding = hex.EncodeToString(nonce)
+					http.SetCookie(res, &http.Cookie{Name: "punocracy-csrf", Value: binding, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+				}
+			}
+
+			if !libcsrf.Safe(req.Method) && !libcsrf.Valid(secret, binding, libcsrf.FromRequest(req)) {
+				logrus.Warnln("Rejected request without a valid CSRF token:", req.Method, req.URL.Path)
+				http.Error(res, "Invalid or missing CSRF token. Please reload the page and try again.", http.StatusForbidden)
+				return
+			}
+
+			req = req.WithContext(context.WithValue(req.Context(), "csrfToken", libcsrf.Token(secret, binding)))
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// RequireTwoFactor is a middleware that sends curators and administrators who haven't enabled 2FA
+// to the enrollment page when the require_2fa_for_curators setting is on.
+// Static files and paths under exemptPrefixes are served as usual.
+func RequireTwoFactor(exemptPrefixes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			config := req.Context().Value("config").(*viper.Viper)
+			if !config.GetBool("require_2fa_for_curators") || path.Ext(req.URL.Path) != "" {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			for _, prefix := range exemptPrefixes {
+				if strings.HasPrefix(req.URL.Path, prefix) {
+					next.ServeHTTP(res, req)
+					return
+				}
+			}
+
+			sessionStore := req.Context().Value("sessionStore").(sessions.Store)
+			session, _ := sessionStore.Get(req, "punocracy-session")
+
+			user, ok := session.Values["user"].(*models.UserRow)
+			if !ok || user.PermLevel > models.Curator {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			db := req.Context().Value("db").(*sqlx.DB)
+
+			enabled, err := models.NewTwoFactor(db).IsEnabled(nil, user.ID)
+			if err != nil {
+				libhttp.HandleErrorJson(res, err)
+				return
+			}
+			if !enabled {
+				http.Redirect(res, req, "/account/2fa", http.StatusFound)
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
 // MustLogin is a middleware that checks existence of current user.
 func MustLogin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
@@ -68,3 +328,37 @@ func MustLogin(next http.Handler) http.Handler {
 		next.ServeHTTP(res, req)
 	})
 }
+
+// RateLimit is a middleware that limits requests per client IP and, for logged in users, per user.
+// Requests over the limit are answered with 429 Too Many Requests and a Retry-After header.
+func RateLimit(backend libratelimit.Backend, name string, limit libratelimit.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			keys := []string{name + ":ip:" + libhttp.ClientIP(req)}
+
+			sessionStore := req.Context().Value("sessionStore").(sessions.Store)
+			session, _ := sessionStore.Get(req, "punocracy-session")
+			if currentUser, ok := session.Values["user"].(*models.UserRow); ok {
+				keys = append(keys, fmt.Sprintf("%v:user:%v", name, currentUser.ID))
+			}
+
+			// Tokens are only taken if both the IP and the user are under the limit,
+			// so requests denied for one don't use up the quota of the other
+			allowed, retryAfter, err := backend.TakeAll(keys, limit)
+			if err != nil {
+				// Let the request through rather than lock everyone out when the backend fails
+				logrus.Errorln(err)
+				allowed = true
+			}
+
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				res.Header().Set("Retry-After", strconv.Itoa(seconds))
+				http.Error(res, fmt.Sprintf("Too many requests. Please try again in %v seconds.", seconds), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS LoginLockouts_T;
+CREATE TABLE LoginLockouts_T(
+    lockoutID INT NOT NULL AUTO_INCREMENT,
+    username VARCHAR(255) NOT NULL,
+    ipAddress VARCHAR(45) NOT NULL,
+    reason VARCHAR(30) NOT NULL,
+    lockedAt DATETIME NOT NULL,
+    lockedUntil DATETIME NOT NULL,
+
+    CONSTRAINT LoginLockouts_PK PRIMARY KEY (lockoutID),
+    INDEX LoginLockouts_lockedAt (lockedAt)
+);
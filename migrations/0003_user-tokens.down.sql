@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS UserTokens_T;
+ALTER TABLE Users_T DROP COLUMN emailVerified;
@@ -0,0 +1,15 @@
+ALTER TABLE Users_T ADD COLUMN emailVerified BOOLEAN NOT NULL DEFAULT FALSE;
+
+DROP TABLE IF EXISTS UserTokens_T;
+CREATE TABLE UserTokens_T(
+    nonce VARCHAR(64) NOT NULL,
+    userID INT NOT NULL,
+    purpose VARCHAR(30) NOT NULL,
+    expiresAt DATETIME NOT NULL,
+    usedAt DATETIME,
+
+    CONSTRAINT UserTokens_PK PRIMARY KEY (nonce),
+    CONSTRAINT UserTokens_FK FOREIGN KEY (userID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION
+);
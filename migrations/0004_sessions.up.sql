@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS Sessions_T;
+CREATE TABLE Sessions_T(
+    sessionID VARCHAR(64) NOT NULL,
+    userID INT NOT NULL DEFAULT 0,
+    data BLOB NOT NULL,
+    userAgent VARCHAR(255) NOT NULL,
+    ipAddress VARCHAR(45) NOT NULL,
+    createdAt DATETIME NOT NULL,
+    lastSeenAt DATETIME NOT NULL,
+    expiresAt DATETIME NOT NULL,
+
+    CONSTRAINT Sessions_PK PRIMARY KEY (sessionID),
+    INDEX Sessions_userID (userID),
+    INDEX Sessions_expiresAt (expiresAt)
+);
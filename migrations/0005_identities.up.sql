@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS Identities_T;
+CREATE TABLE Identities_T(
+    identityID INT NOT NULL AUTO_INCREMENT,
+    userID INT NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    createdAt DATETIME NOT NULL,
+
+    CONSTRAINT Identities_PK PRIMARY KEY (identityID),
+    CONSTRAINT Identities_provider_subject UNIQUE (provider, subject),
+    CONSTRAINT Identities_FK FOREIGN KEY (userID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION
+);
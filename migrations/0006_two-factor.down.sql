@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS RecoveryCodes_T;
+DROP TABLE IF EXISTS TwoFactor_T;
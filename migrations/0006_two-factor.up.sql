@@ -0,0 +1,26 @@
+DROP TABLE IF EXISTS RecoveryCodes_T;
+DROP TABLE IF EXISTS TwoFactor_T;
+CREATE TABLE TwoFactor_T(
+    userID INT NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    lastCounter BIGINT NOT NULL DEFAULT 0,
+    enabledAt DATETIME NOT NULL,
+
+    CONSTRAINT TwoFactor_PK PRIMARY KEY (userID),
+    CONSTRAINT TwoFactor_FK FOREIGN KEY (userID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION
+);
+
+CREATE TABLE RecoveryCodes_T(
+    codeID INT NOT NULL AUTO_INCREMENT,
+    userID INT NOT NULL,
+    codeHash CHAR(64) NOT NULL,
+    usedAt DATETIME,
+
+    CONSTRAINT RecoveryCodes_PK PRIMARY KEY (codeID),
+    CONSTRAINT RecoveryCodes_user_code UNIQUE (userID, codeHash),
+    CONSTRAINT RecoveryCodes_FK FOREIGN KEY (userID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION
+);
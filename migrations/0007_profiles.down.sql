@@ -0,0 +1,3 @@
+ALTER TABLE Users_T DROP COLUMN createdAt;
+ALTER TABLE Users_T DROP COLUMN bio;
+ALTER TABLE Users_T DROP COLUMN displayName;
@@ -0,0 +1,3 @@
+ALTER TABLE Users_T ADD COLUMN displayName VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE Users_T ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE Users_T ADD COLUMN createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS Capabilities_T;
+DROP TABLE IF EXISTS ReputationEvents_T;
+ALTER TABLE Users_T DROP COLUMN reputation;
@@ -0,0 +1,33 @@
+ALTER TABLE Users_T ADD COLUMN reputation INT NOT NULL DEFAULT 0;
+
+DROP TABLE IF EXISTS ReputationEvents_T;
+CREATE TABLE ReputationEvents_T(
+    eventID INT NOT NULL AUTO_INCREMENT,
+    userID INT NOT NULL,
+    points INT NOT NULL,
+    reason VARCHAR(30) NOT NULL,
+    phraseID VARCHAR(24) NOT NULL DEFAULT '',
+    createdAt DATETIME NOT NULL,
+
+    CONSTRAINT ReputationEvents_PK PRIMARY KEY (eventID),
+    CONSTRAINT ReputationEvents_FK FOREIGN KEY (userID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+    INDEX ReputationEvents_userID_createdAt (userID, createdAt)
+);
+
+DROP TABLE IF EXISTS Capabilities_T;
+CREATE TABLE Capabilities_T(
+    userID INT NOT NULL,
+    capability VARCHAR(30) NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    unlockedAt DATETIME NOT NULL,
+    decidedAt DATETIME,
+    decidedBy INT,
+
+    CONSTRAINT Capabilities_PK PRIMARY KEY (userID, capability),
+    CONSTRAINT Capabilities_FK FOREIGN KEY (userID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+    INDEX Capabilities_status_unlockedAt (status, unlockedAt)
+);
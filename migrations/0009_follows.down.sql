@@ -0,0 +1 @@
+DROP TABLE IF EXISTS Follows_T;
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS Follows_T;
+CREATE TABLE Follows_T(
+    followerID INT NOT NULL,
+    followeeID INT NOT NULL,
+    createdAt DATETIME NOT NULL,
+
+    CONSTRAINT Follows_PK PRIMARY KEY (followerID, followeeID),
+    CONSTRAINT Follows_follower_FK FOREIGN KEY (followerID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+    CONSTRAINT Follows_followee_FK FOREIGN KEY (followeeID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+    INDEX Follows_followeeID (followeeID)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS WebhookDeliveries_T;
+DROP TABLE IF EXISTS Webhooks_T;
@@ -0,0 +1,37 @@
+DROP TABLE IF EXISTS WebhookDeliveries_T;
+DROP TABLE IF EXISTS Webhooks_T;
+CREATE TABLE Webhooks_T(
+    webhookID INT NOT NULL AUTO_INCREMENT,
+    url VARCHAR(2000) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    createdBy INT,
+    createdAt DATETIME NOT NULL,
+
+    CONSTRAINT Webhooks_PK PRIMARY KEY (webhookID),
+    CONSTRAINT Webhooks_FK FOREIGN KEY (createdBy) REFERENCES Users_T(userID)
+    ON DELETE SET NULL
+    ON UPDATE NO ACTION
+);
+
+CREATE TABLE WebhookDeliveries_T(
+    deliveryID INT NOT NULL AUTO_INCREMENT,
+    webhookID INT NOT NULL,
+    event VARCHAR(30) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    nextAttemptAt DATETIME NOT NULL,
+    lastAttemptAt DATETIME,
+    responseStatus INT NOT NULL DEFAULT 0,
+    lastError VARCHAR(255) NOT NULL DEFAULT '',
+    createdAt DATETIME NOT NULL,
+
+    CONSTRAINT WebhookDeliveries_PK PRIMARY KEY (deliveryID),
+    CONSTRAINT WebhookDeliveries_FK FOREIGN KEY (webhookID) REFERENCES Webhooks_T(webhookID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+    INDEX WebhookDeliveries_status_nextAttemptAt (status, nextAttemptAt),
+    INDEX WebhookDeliveries_webhookID_createdAt (webhookID, createdAt)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS NotificationPreferences_T;
+DROP TABLE IF EXISTS Notifications_T;
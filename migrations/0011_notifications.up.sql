@@ -0,0 +1,31 @@
+DROP TABLE IF EXISTS Notifications_T;
+CREATE TABLE Notifications_T(
+    notificationID INT NOT NULL AUTO_INCREMENT,
+    userID INT NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    message VARCHAR(255) NOT NULL,
+    link VARCHAR(255) NOT NULL DEFAULT '',
+    digest BOOLEAN NOT NULL DEFAULT FALSE,
+    createdAt DATETIME NOT NULL,
+    readAt DATETIME,
+    emailedAt DATETIME,
+
+    CONSTRAINT Notifications_PK PRIMARY KEY (notificationID),
+    CONSTRAINT Notifications_FK FOREIGN KEY (userID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION,
+    INDEX Notifications_userID_readAt (userID, readAt),
+    INDEX Notifications_digest_emailedAt (digest, emailedAt)
+);
+
+DROP TABLE IF EXISTS NotificationPreferences_T;
+CREATE TABLE NotificationPreferences_T(
+    userID INT NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    delivery VARCHAR(10) NOT NULL,
+
+    CONSTRAINT NotificationPreferences_PK PRIMARY KEY (userID, type),
+    CONSTRAINT NotificationPreferences_FK FOREIGN KEY (userID) REFERENCES Users_T(userID)
+    ON DELETE CASCADE
+    ON UPDATE NO ACTION
+);
@@ -0,0 +1,276 @@
+// Favorite phrases and named collections of phrases
+
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrEmptyCollectionName = errors.New("models: collection name cannot be blank")
+var ErrCollectionNameTooLong = errors.New("models: collection name is longer than 60 characters")
+var ErrCollectionNotFound = errors.New("models: no collection with that CollectionID found for this user")
+var ErrNotCollectable = errors.New("models: only accepted phrases can be saved")
+
+// MaxCollectionNameLength is the longest collection name in characters
+const MaxCollectionNameLength = 60
+
+// Favorite is a phrase a user saved
+type Favorite struct {
+	UserID    int64              `bson:"userID"`
+	PhraseID  primitive.ObjectID `bson:"phraseID"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+// PunCollection is a named list of phrases put together by a user
+type PunCollection struct {
+	CollectionID primitive.ObjectID `bson:"_id"`
+	OwnerUserID  int64              `bson:"ownerUserID"`
+	Name         string             `bson:"name"`
+	// Public collections can be seen by anyone with the link, private ones only by their owner
+	Public bool `bson:"public"`
+	// PhraseIDs are in the order the phrases were added. They may refer to phrases that were since rejected or deleted.
+	PhraseIDs []primitive.ObjectID `bson:"phraseIDs"`
+	CreatedAt time.Time            `bson:"createdAt"`
+}
+
+// NewFavoritesConnection creates a reference to the favorites collection from DB pointer
+func NewFavoritesConnection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("favorites")
+}
+
+// NewPunCollectionsConnection creates a reference to the pun collections collection from DB pointer
+func NewPunCollectionsConnection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("punCollections")
+}
+
+// EnsureFavoriteIndexes makes favoriting a phrase twice impossible
+func EnsureFavoriteIndexes(favoritesCollection *mongo.Collection) error {
+	_, err := favoritesCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "phraseID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
+
+// AddFavorite saves an accepted phrase to the user's favorites. Favoriting a phrase twice does nothing.
+func AddFavorite(user UserRow, thePhrase Phrase, favoritesCollection *mongo.Collection) error {
+	if thePhrase.DisplayPublic != Accepted {
+		return ErrNotCollectable
+	}
+
+	_, err := favoritesCollection.UpdateOne(context.Background(),
+		bson.M{"userID": user.ID, "phraseID": thePhrase.PhraseID},
+		bson.M{"$setOnInsert": bson.M{"createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+
+	return err
+}
+
+// RemoveFavorite removes a phrase from the user's favorites
+func RemoveFavorite(user UserRow, phraseID primitive.ObjectID, favoritesCollection *mongo.Collection) error {
+	_, err := favoritesCollection.DeleteOne(context.Background(), bson.M{"userID": user.ID, "phraseID": phraseID})
+
+	return err
+}
+
+// GetFavoritePhraseIDs returns the phrases the user favorited, most recent first
+func GetFavoritePhraseIDs(user UserRow, favoritesCollection *mongo.Collection) ([]primitive.ObjectID, error) {
+	findOptions := options.Find().SetSort(bson.M{"createdAt": -1})
+
+	cur, err := favoritesCollection.Find(context.Background(), bson.M{"userID": user.ID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	phraseIDs := []primitive.ObjectID{}
+	for cur.Next(context.Background()) {
+		var favorite Favorite
+		err = cur.Decode(&favorite)
+		if err != nil {
+			return nil, err
+		}
+		phraseIDs = append(phraseIDs, favorite.PhraseID)
+	}
+
+	return phraseIDs, cur.Err()
+}
+
+// checkCollectionName trims a collection name and checks its length
+func checkCollectionName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrEmptyCollectionName
+	}
+	if utf8.RuneCountInString(name) > MaxCollectionNameLength {
+		return "", ErrCollectionNameTooLong
+	}
+
+	return name, nil
+}
+
+// CreatePunCollection creates an empty collection owned by owner
+func CreatePunCollection(owner UserRow, name string, public bool, collectionsCollection *mongo.Collection) (PunCollection, error) {
+	name, err := checkCollectionName(name)
+	if err != nil {
+		return PunCollection{}, err
+	}
+
+	collection := PunCollection{
+		CollectionID: primitive.NewObjectID(),
+		OwnerUserID:  owner.ID,
+		Name:         name,
+		Public:       public,
+		PhraseIDs:    []primitive.ObjectID{},
+		CreatedAt:    time.Now(),
+	}
+
+	_, err = collectionsCollection.InsertOne(context.Background(), collection)
+	return collection, err
+}
+
+// GetPunCollection finds a collection by its ID
+func GetPunCollection(collectionID primitive.ObjectID, collectionsCollection *mongo.Collection) (PunCollection, error) {
+	var collection PunCollection
+	err := collectionsCollection.FindOne(context.Background(), bson.M{"_id": collectionID}).Decode(&collection)
+	if err == mongo.ErrNoDocuments {
+		return collection, ErrCollectionNotFound
+	}
+
+	return collection, err
+}
+
+// GetPunCollectionsByOwner returns the user's collections in alphabetical order
+func GetPunCollectionsByOwner(owner UserRow, collectionsCollection *mongo.Collection) ([]PunCollection, error) {
+	findOptions := options.Find().SetSort(bson.M{"name": 1})
+
+	cur, err := collectionsCollection.Find(context.Background(), bson.M{"ownerUserID": owner.ID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	collections := []PunCollection{}
+	for cur.Next(context.Background()) {
+		var collection PunCollection
+		err = cur.Decode(&collection)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+
+	return collections, cur.Err()
+}
+
+// updateOwnPunCollection applies update to one of owner's collections
+func updateOwnPunCollection(collectionID primitive.ObjectID, owner UserRow, update bson.M, collectionsCollection *mongo.Collection) error {
+	result, err := collectionsCollection.UpdateOne(context.Background(), bson.M{"_id": collectionID, "ownerUserID": owner.ID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCollectionNotFound
+	}
+
+	return nil
+}
+
+// UpdatePunCollection renames one of owner's collections and sets whether it is public
+func UpdatePunCollection(collectionID primitive.ObjectID, owner UserRow, name string, public bool, collectionsCollection *mongo.Collection) error {
+	name, err := checkCollectionName(name)
+	if err != nil {
+		return err
+	}
+
+	return updateOwnPunCollection(collectionID, owner, bson.M{"$set": bson.M{"name": name, "public": public}}, collectionsCollection)
+}
+
+// DeletePunCollection deletes one of owner's collections. The phrases in it are not affected.
+func DeletePunCollection(collectionID primitive.ObjectID, owner UserRow, collectionsCollection *mongo.Collection) error {
+	result, err := collectionsCollection.DeleteOne(context.Background(), bson.M{"_id": collectionID, "ownerUserID": owner.ID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrCollectionNotFound
+	}
+
+	return nil
+}
+
+// AddToPunCollection adds an accepted phrase to one of owner's collections. Adding a phrase twice does nothing.
+func AddToPunCollection(collectionID primitive.ObjectID, owner UserRow, thePhrase Phrase, collectionsCollection *mongo.Collection) error {
+	if thePhrase.DisplayPublic != Accepted {
+		return ErrNotCollectable
+	}
+
+	return updateOwnPunCollection(collectionID, owner, bson.M{"$addToSet": bson.M{"phraseIDs": thePhrase.PhraseID}}, collectionsCollection)
+}
+
+// RemoveFromPunCollection removes a phrase from one of owner's collections
+func RemoveFromPunCollection(collectionID primitive.ObjectID, owner UserRow, phraseID primitive.ObjectID, collectionsCollection *mongo.Collection) error {
+	return updateOwnPunCollection(collectionID, owner, bson.M{"$pull": bson.M{"phraseIDs": phraseID}}, collectionsCollection)
+}
+
+// GetCollectedPhrases returns the accepted phrases among phraseIDs in the same order,
+// and how many of them are no longer available because they were rejected or deleted.
+func GetCollectedPhrases(phraseIDs []primitive.ObjectID, phrasesCollection *mongo.Collection) ([]Phrase, int, error) {
+	if len(phraseIDs) == 0 {
+		return []Phrase{}, 0, nil
+	}
+
+	cur, err := phrasesCollection.Find(context.Background(), bson.M{"_id": bson.M{"$in": phraseIDs}, "displayValue": Accepted})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(context.Background())
+
+	found := []Phrase{}
+	for cur.Next(context.Background()) {
+		var phrase Phrase
+		err = cur.Decode(&phrase)
+		if err != nil {
+			return nil, 0, err
+		}
+		found = append(found, phrase)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	phrases, unavailable := orderCollectedPhrases(phraseIDs, found)
+	return phrases, unavailable, nil
+}
+
+// orderCollectedPhrases puts found in the order of phraseIDs and counts the IDs that weren't found
+func orderCollectedPhrases(phraseIDs []primitive.ObjectID, found []Phrase) ([]Phrase, int) {
+	byID := make(map[primitive.ObjectID]Phrase)
+	for _, phrase := range found {
+		byID[phrase.PhraseID] = phrase
+	}
+
+	phrases := []Phrase{}
+	unavailable := 0
+	for _, phraseID := range phraseIDs {
+		phrase, ok := byID[phraseID]
+		if !ok {
+			unavailable++
+			continue
+		}
+		phrases = append(phrases, phrase)
+	}
+
+	return phrases, unavailable
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Test that collected phrases keep their order and missing ones are counted
+func TestOrderCollectedPhrases(t *testing.T) {
+	first := Phrase{PhraseID: primitive.NewObjectID(), PhraseText: "first"}
+	second := Phrase{PhraseID: primitive.NewObjectID(), PhraseText: "second"}
+	deleted := primitive.NewObjectID()
+
+	phrases, unavailable := orderCollectedPhrases([]primitive.ObjectID{second.PhraseID, deleted, first.PhraseID}, []Phrase{first, second})
+
+	if len(phrases) != 2 || phrases[0].PhraseText != "second" || phrases[1].PhraseText != "first" {
+		t.Errorf("Phrases should be in the collection's order. Received: %v", phrases)
+	}
+	if unavailable != 1 {
+		t.Errorf("The deleted phrase should be counted as unavailable. Received: %v", unavailable)
+	}
+}
+
+func TestCheckCollectionName(t *testing.T) {
+	name, err := checkCollectionName("  Dad jokes ")
+	if err != nil || name != "Dad jokes" {
+		t.Errorf("Collection names should be trimmed. Received: %q, error: %v", name, err)
+	}
+
+	if _, err := checkCollectionName("   "); err != ErrEmptyCollectionName {
+		t.Errorf("Blank collection names should be refused. Received: %v", err)
+	}
+
+	if _, err := checkCollectionName(strings.Repeat("a", MaxCollectionNameLength+1)); err != ErrCollectionNameTooLong {
+		t.Errorf("Long collection names should be refused. Received: %v", err)
+	}
+}
+
+func TestAddFavoriteUnacceptedPhrase(t *testing.T) {
+	err := AddFavorite(UserRow{ID: 1}, Phrase{DisplayPublic: Rejected}, nil)
+	if err != ErrNotCollectable {
+		t.Errorf("Rejected phrases should not be favorited. Received: %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+// Comments and threaded discussion on phrases
+
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrEmptyComment = errors.New("models: comment text cannot be blank")
+var ErrCommentTooLong = errors.New("models: comment is longer than 1000 characters")
+var ErrCommentNotFound = errors.New("models: no comment with that CommentID found on this phrase")
+var ErrCommentNotAllowed = errors.New("models: user is not allowed to change this comment")
+var ErrCommentsClosed = errors.New("models: only accepted phrases can be commented on")
+
+// MaxCommentLength is the longest comment in characters
+const MaxCommentLength = 1000
+
+// Comment is a comment on a phrase, or a reply to another comment
+type Comment struct {
+	CommentID primitive.ObjectID `bson:"_id"`
+	PhraseID  primitive.ObjectID `bson:"phraseID"`
+	// ParentID is the comment this one replies to, or NilObjectID for top level comments
+	ParentID     primitive.ObjectID `bson:"parentID"`
+	AuthorUserID int64              `bson:"authorUserID"`
+	Text         string             `bson:"text"`
+	CreatedAt    time.Time          `bson:"createdAt"`
+	// EditedAt is the zero time for comments that were never edited
+	EditedAt time.Time `bson:"editedAt"`
+	// Deleted comments keep their place in the thread so replies to them still make sense, but lose their text
+	Deleted bool `bson:"deleted"`
+	// RemovedBy is the curator who removed the comment, or 0 if it wasn't removed by a curator
+	RemovedBy int64 `bson:"removedBy"`
+}
+
+// ThreadedComment is a comment with its depth in the thread
+type ThreadedComment struct {
+	Comment
+	Depth int
+}
+
+// NewCommentsConnection creates a reference to the comments collection from DB pointer
+func NewCommentsConnection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("comments")
+}
+
+// checkCommentText trims a comment and checks its length
+func checkCommentText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ErrEmptyComment
+	}
+	if utf8.RuneCountInString(text) > MaxCommentLength {
+		return "", ErrCommentTooLong
+	}
+
+	return text, nil
+}
+
+// AddComment stores a comment on an accepted phrase. parentID is the comment it replies to, or NilObjectID.
+func AddComment(thePhrase Phrase, parentID primitive.ObjectID, author UserRow, text string, commentsCollection *mongo.Collection) (Comment, error) {
+	if thePhrase.DisplayPublic != Accepted {
+		return Comment{}, ErrCommentsClosed
+	}
+
+	text, err := checkCommentText(text)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	// Replies must stay on the same phrase as their parent
+	if parentID != primitive.NilObjectID {
+		_, err = getComment(thePhrase.PhraseID, parentID, commentsCollection)
+		if err != nil {
+			return Comment{}, err
+		}
+	}
+
+	comment := Comment{
+		CommentID:    primitive.NewObjectID(),
+		PhraseID:     thePhrase.PhraseID,
+		ParentID:     parentID,
+		AuthorUserID: author.ID,
+		Text:         text,
+		CreatedAt:    time.Now(),
+	}
+
+	_, err = commentsCollection.InsertOne(context.Background(), comment)
+	return comment, err
+}
+
+// getComment finds a comment on a phrase
+func getComment(phraseID, commentID primitive.ObjectID, commentsCollection *mongo.Collection) (Comment, error) {
+	var comment Comment
+	err := commentsCollection.FindOne(context.Background(), bson.M{"_id": commentID, "phraseID": phraseID}).Decode(&comment)
+	if err == mongo.ErrNoDocuments {
+		return comment, ErrCommentNotFound
+	}
+
+	return comment, err
+}
+
+// EditComment replaces the text of a comment. Only its author can edit it.
+func EditComment(phraseID, commentID primitive.ObjectID, editor UserRow, text string, commentsCollection *mongo.Collection) error {
+	comment, err := getComment(phraseID, commentID, commentsCollection)
+	if err != nil {
+		return err
+	}
+	if comment.AuthorUserID != editor.ID || comment.Deleted {
+		return ErrCommentNotAllowed
+	}
+
+	text, err = checkCommentText(text)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"text": text, "editedAt": time.Now()}}
+	_, err = commentsCollection.UpdateOne(context.Background(), bson.M{"_id": commentID}, update)
+	return err
+}
+
+// DeleteComment removes the text of a comment. Authors can delete their own comments and curators can remove any.
+func DeleteComment(phraseID, commentID primitive.ObjectID, user UserRow, commentsCollection *mongo.Collection) error {
+	comment, err := getComment(phraseID, commentID, commentsCollection)
+	if err != nil {
+		return err
+	}
+	if comment.AuthorUserID != user.ID && user.PermLevel > Curator {
+		return ErrCommentNotAllowed
+	}
+
+	set := bson.M{"deleted": true, "text": ""}
+	if comment.AuthorUserID != user.ID {
+		set["removedBy"] = user.ID
+	}
+
+	_, err = commentsCollection.UpdateOne(context.Background(), bson.M{"_id": commentID}, bson.M{"$set": set})
+	return err
+}
+
+// GetComments returns the comments on a phrase, oldest first
+func GetComments(phraseID primitive.ObjectID, commentsCollection *mongo.Collection) ([]Comment, error) {
+	findOptions := options.Find().SetSort(bson.M{"createdAt": 1})
+
+	cur, err := commentsCollection.Find(context.Background(), bson.M{"phraseID": phraseID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	comments := []Comment{}
+	for cur.Next(context.Background()) {
+		var comment Comment
+		err = cur.Decode(&comment)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// ThreadComments orders comments so every reply follows its parent, and records how deep each one is nested.
+// Replies whose parent is missing are shown at the top level.
+func ThreadComments(comments []Comment) []ThreadedComment {
+	known := make(map[primitive.ObjectID]bool)
+	for _, comment := range comments {
+		known[comment.CommentID] = true
+	}
+
+	replies := make(map[primitive.ObjectID][]Comment)
+	for _, comment := range comments {
+		parentID := comment.ParentID
+		if !known[parentID] {
+			parentID = primitive.NilObjectID
+		}
+		replies[parentID] = append(replies[parentID], comment)
+	}
+
+	threaded := []ThreadedComment{}
+
+	var walk func(parentID primitive.ObjectID, depth int)
+	walk = func(parentID primitive.ObjectID, depth int) {
+		for _, comment := range replies[parentID] {
+			threaded = append(threaded, ThreadedComment{Comment: comment, Depth: depth})
+			walk(comment.CommentID, depth+1)
+		}
+	}
+	walk(primitive.NilObjectID, 0)
+
+	return threaded
+}
+
+// CountUndeleted counts the comments that weren't deleted, the way CountComments counts them
+func CountUndeleted(comments []Comment) int {
+	count := 0
+	for _, comment := range comments {
+		if !comment.Deleted {
+			count++
+		}
+	}
+
+	return count
+}
+
+// CountComments returns the number of comments that weren't deleted on each of the phrases
+func CountComments(phraseIDs []primitive.ObjectID, commentsCollection *mongo.Collection) (map[primitive.ObjectID]int, error) {
+	counts := make(map[primitive.ObjectID]int)
+	if len(phraseIDs) == 0 {
+		return counts, nil
+	}
+
+	pipeline := bson.A{
+		bson.M{
+			"$match": bson.M{"phraseID": bson.M{"$in": phraseIDs}, "deleted": false},
+		},
+		bson.M{
+			"$group": bson.M{"_id": "$phraseID", "count": bson.M{"$sum": 1}},
+		},
+	}
+
+	cur, err := commentsCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	for cur.Next(context.Background()) {
+		var result struct {
+			PhraseID primitive.ObjectID `bson:"_id"`
+			Count    int                `bson:"count"`
+		}
+		err = cur.Decode(&result)
+		if err != nil {
+			return nil, err
+		}
+		counts[result.PhraseID] = result.Count
+	}
+
+	return counts, cur.Err()
+}
+
+// DeleteCommentsByPhraseIDs deletes every comment on the given phrases
+func DeleteCommentsByPhraseIDs(phraseIDs []primitive.ObjectID, commentsCollection *mongo.Collection) error {
+	if len(phraseIDs) == 0 {
+		return nil
+	}
+
+	_, err := commentsCollection.DeleteMany(context.Background(), bson.M{"phraseID": bson.M{"$in": phraseIDs}})
+	return err
+}
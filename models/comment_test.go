@@ -0,0 +1,74 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Test that replies are ordered after their parents with the right depth
+func TestThreadComments(t *testing.T) {
+	first := Comment{CommentID: primitive.NewObjectID(), Text: "first"}
+	second := Comment{CommentID: primitive.NewObjectID(), Text: "second"}
+	reply := Comment{CommentID: primitive.NewObjectID(), ParentID: first.CommentID, Text: "reply"}
+	nested := Comment{CommentID: primitive.NewObjectID(), ParentID: reply.CommentID, Text: "nested"}
+	orphan := Comment{CommentID: primitive.NewObjectID(), ParentID: primitive.NewObjectID(), Text: "orphan"}
+
+	threaded := ThreadComments([]Comment{first, second, reply, nested, orphan})
+
+	expected := []struct {
+		text  string
+		depth int
+	}{
+		{"first", 0},
+		{"reply", 1},
+		{"nested", 2},
+		{"second", 0},
+		{"orphan", 0},
+	}
+
+	if len(threaded) != len(expected) {
+		t.Fatalf("Threading should keep every comment. Received: %v", threaded)
+	}
+	for i, comment := range threaded {
+		if comment.Text != expected[i].text || comment.Depth != expected[i].depth {
+			t.Errorf("Comment %v should be %q at depth %v. Received: %q at depth %v", i, expected[i].text, expected[i].depth, comment.Text, comment.Depth)
+		}
+	}
+}
+
+// Test that deleted comments aren't counted
+func TestCountUndeleted(t *testing.T) {
+	comments := []Comment{{Text: "first"}, {Deleted: true}, {Text: "reply"}}
+
+	if count := CountUndeleted(comments); count != 2 {
+		t.Errorf("Deleted comments should not be counted. Received: %v", count)
+	}
+}
+
+// Test the comment text checks
+func TestCheckCommentText(t *testing.T) {
+	text, err := checkCommentText("  Nice pun!  ")
+	if err != nil || text != "Nice pun!" {
+		t.Errorf("Comment text should be trimmed. Received: %q, %v", text, err)
+	}
+
+	if _, err := checkCommentText("   "); err != ErrEmptyComment {
+		t.Errorf("Blank comments should be refused. Received: %v", err)
+	}
+
+	if _, err := checkCommentText(strings.Repeat("a", MaxCommentLength+1)); err != ErrCommentTooLong {
+		t.Errorf("Long comments should be refused. Received: %v", err)
+	}
+}
+
+// Test that only accepted phrases can be commented on
+func TestAddCommentToUnacceptedPhrase(t *testing.T) {
+	thePhrase := Phrase{PhraseID: primitive.NewObjectID(), DisplayPublic: Unreviewed}
+
+	_, err := AddComment(thePhrase, primitive.NilObjectID, UserRow{ID: 1}, "Nice pun!", nil)
+	if err != ErrCommentsClosed {
+		t.Errorf("Commenting on an unreviewed phrase should fail with ErrCommentsClosed. Received: %v", err)
+	}
+}
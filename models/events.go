@@ -0,0 +1,73 @@
+// Domain events published on the event bus, named like the webhook events they become
+
+package models
+
+// PhraseSubmitted is published when a user submits a phrase, whatever the moderator decided
+type PhraseSubmitted struct {
+	Phrase Phrase
+}
+
+func (e PhraseSubmitted) EventName() string {
+	return WebhookPhraseSubmitted
+}
+
+// PhraseAccepted is published when a phrase becomes accepted
+type PhraseAccepted struct {
+	Phrase Phrase
+	// Reviewer is the zero UserRow when the phrase skipped the curator queue
+	Reviewer UserRow
+	// PreviousStatus is the phrase's status before, Unreviewed for new phrases
+	PreviousStatus DisplayValue
+}
+
+func (e PhraseAccepted) EventName() string {
+	return WebhookPhraseAccepted
+}
+
+// PhraseRejected is published when a phrase becomes rejected
+type PhraseRejected struct {
+	Phrase Phrase
+	// Reviewer is the zero UserRow when the moderator rejected the phrase on submission
+	Reviewer UserRow
+	// PreviousStatus is the phrase's status before, Unreviewed for new phrases
+	PreviousStatus DisplayValue
+}
+
+func (e PhraseRejected) EventName() string {
+	return WebhookPhraseRejected
+}
+
+// PhraseRated is published when a user rates a phrase or changes their rating
+type PhraseRated struct {
+	Phrase Phrase
+	Rater  UserRow
+	Rating int
+	// PreviousRating is 0 if the user hadn't rated the phrase before
+	PreviousRating int
+}
+
+func (e PhraseRated) EventName() string {
+	return WebhookPhraseRated
+}
+
+// UserSignedUp is published when an account is created
+type UserSignedUp struct {
+	User UserRow
+}
+
+func (e UserSignedUp) EventName() string {
+	return WebhookUserSignedUp
+}
+
+// EventUserFollowed names UserFollowed. There is no webhook for it.
+const EventUserFollowed = "user.followed"
+
+// UserFollowed is published when a user starts following another
+type UserFollowed struct {
+	FollowerID int64
+	FolloweeID int64
+}
+
+func (e UserFollowed) EventName() string {
+	return EventUserFollowed
+}
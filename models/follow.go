@@ -0,0 +1,130 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/punocracy/punocracy/libevent"
+)
+
+var ErrFollowSelf = errors.New("models: users cannot follow themselves")
+
+// Follow represents the Follows_T table
+type Follow struct {
+	Base
+}
+
+// NewFollow creates a new Follow
+func NewFollow(db *sqlx.DB) *Follow {
+	follow := &Follow{}
+	follow.db = db
+	follow.table = "Follows_T"
+	follow.hasID = false
+
+	return follow
+}
+
+// Follow makes follower follow followee. Following someone twice does nothing.
+// UserFollowed is only published for new follows.
+func (f *Follow) Follow(tx *sqlx.Tx, followerID, followeeID int64, events *libevent.Bus) error {
+	if followerID == followeeID {
+		return ErrFollowSelf
+	}
+
+	query := fmt.Sprintf("INSERT IGNORE INTO %v (followerID, followeeID, createdAt) VALUES (?, ?, ?)", f.table)
+	result, err := f.db.Exec(query, followerID, followeeID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err == nil && inserted > 0 {
+		events.Publish(UserFollowed{FollowerID: followerID, FolloweeID: followeeID})
+	}
+
+	return err
+}
+
+// Unfollow makes follower stop following followee
+func (f *Follow) Unfollow(tx *sqlx.Tx, followerID, followeeID int64) error {
+	query := fmt.Sprintf("DELETE FROM %v WHERE followerID=? AND followeeID=?", f.table)
+	_, err := f.db.Exec(query, followerID, followeeID)
+
+	return err
+}
+
+// IsFollowing reports whether follower follows followee
+func (f *Follow) IsFollowing(tx *sqlx.Tx, followerID, followeeID int64) (bool, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE followerID=? AND followeeID=?", f.table)
+	err := f.db.Get(&count, query, followerID, followeeID)
+
+	return count > 0, err
+}
+
+// CountFollowers returns how many users follow the user
+func (f *Follow) CountFollowers(tx *sqlx.Tx, userID int64) (int, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE followeeID=?", f.table)
+	err := f.db.Get(&count, query, userID)
+
+	return count, err
+}
+
+// CountFollowing returns how many users the user follows
+func (f *Follow) CountFollowing(tx *sqlx.Tx, userID int64) (int, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE followerID=?", f.table)
+	err := f.db.Get(&count, query, userID)
+
+	return count, err
+}
+
+// FolloweeIDs returns the IDs of the users the user follows
+func (f *Follow) FolloweeIDs(tx *sqlx.Tx, followerID int64) ([]int64, error) {
+	ids := []int64{}
+	query := fmt.Sprintf("SELECT followeeID FROM %v WHERE followerID=?", f.table)
+	err := f.db.Select(&ids, query, followerID)
+
+	return ids, err
+}
+
+// GetFeedPhrases returns the most recently accepted phrases submitted by any of the given users.
+// The feed is assembled when it is read, which the phrases index on submitter, status and review date keeps cheap.
+func GetFeedPhrases(submitterIDs []int64, limit int64, phrasesCollection *mongo.Collection) ([]Phrase, error) {
+	phraseList := []Phrase{}
+	if len(submitterIDs) == 0 {
+		return phraseList, nil
+	}
+
+	filter := bson.M{"submitterUserID": bson.M{"$in": submitterIDs}, "displayValue": Accepted}
+	findOptions := options.Find().SetSort(bson.M{"reviewDate": -1}).SetLimit(limit)
+
+	cur, err := phrasesCollection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	for cur.Next(context.Background()) {
+		var onePhrase Phrase
+		err = cur.Decode(&onePhrase)
+		if err != nil {
+			return nil, err
+		}
+		phraseList = append(phraseList, onePhrase)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return phraseList, nil
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"testing"
+)
+
+// Test that users cannot follow themselves
+func TestFollowSelf(t *testing.T) {
+	err := NewFollow(nil).Follow(nil, 7, 7, nil)
+	if err != ErrFollowSelf {
+		t.Errorf("Following yourself should fail with ErrFollowSelf. Received: %v", err)
+	}
+}
+
+// Test that the feed of someone following nobody is empty without querying phrases
+func TestGetFeedPhrasesFollowingNobody(t *testing.T) {
+	phrases, err := GetFeedPhrases([]int64{}, 10, nil)
+	if err != nil {
+		t.Errorf("An empty feed should not fail. Error: %v", err)
+	}
+	if len(phrases) != 0 {
+		t.Errorf("The feed should be empty. Received: %v", phrases)
+	}
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrIdentityLinked is returned when an external identity already belongs to another user.
+var ErrIdentityLinked = errors.New("models: identity is linked to another user")
+
+// ErrLastLoginMethod is returned when unlinking an identity would leave a user without a way to log in.
+var ErrLastLoginMethod = errors.New("models: cannot unlink the only way to log in")
+
+// IdentityRow links an account at an external identity provider to a user
+type IdentityRow struct {
+	ID        int64     `db:"identityID"`
+	UserID    int64     `db:"userID"`
+	Provider  string    `db:"provider"`
+	Subject   string    `db:"subject"`
+	Email     *string   `db:"email"`
+	CreatedAt time.Time `db:"createdAt"`
+}
+
+// Identity represents the Identities_T table
+type Identity struct {
+	Base
+}
+
+// NewIdentity creates a new Identity
+func NewIdentity(db *sqlx.DB) *Identity {
+	identity := &Identity{}
+	identity.db = db
+	identity.table = "Identities_T"
+	identity.hasID = true
+
+	return identity
+}
+
+// GetByProviderSubject returns the identity with the given subject at a provider
+func (i *Identity) GetByProviderSubject(tx *sqlx.Tx, provider, subject string) (*IdentityRow, error) {
+	identity := &IdentityRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE provider=? AND subject=?", i.table)
+	err := i.db.Get(identity, query, provider, subject)
+
+	return identity, err
+}
+
+// ListByUser returns the identities linked to a user
+func (i *Identity) ListByUser(tx *sqlx.Tx, userID int64) ([]IdentityRow, error) {
+	identities := []IdentityRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE userID=? ORDER BY provider", i.table)
+	err := i.db.Select(&identities, query, userID)
+
+	return identities, err
+}
+
+// Link links an external identity to a user.
+// Linking an identity the user already has is a no-op, linking one another user has fails with ErrIdentityLinked.
+func (i *Identity) Link(tx *sqlx.Tx, userID int64, provider, subject, email string) error {
+	existing, err := i.GetByProviderSubject(tx, provider, subject)
+	if err == nil {
+		if existing.UserID != userID {
+			return ErrIdentityLinked
+		}
+		return nil
+	}
+
+	data := make(map[string]interface{})
+	data["userID"] = userID
+	data["provider"] = provider
+	data["subject"] = subject
+	if email != "" {
+		data["email"] = email
+	}
+	data["createdAt"] = time.Now()
+
+	_, err = i.InsertIntoTable(tx, data)
+	return err
+}
+
+// Unlink removes one of the user's identities.
+// It fails with ErrLastLoginMethod if the user has no password and no other identity to log in with.
+func (i *Identity) Unlink(tx *sqlx.Tx, userID, identityID int64) error {
+	tx, wrapInSingleTransaction, err := i.newTransactionIfNeeded(tx)
+	if err != nil {
+		return err
+	}
+
+	// Locking the user serializes concurrent unlinks, which could otherwise remove the last two identities together
+	user := UserRow{}
+	err = tx.Get(&user, "SELECT * FROM Users_T WHERE userID=? FOR UPDATE", userID)
+
+	var identities int
+	if err == nil {
+		err = tx.Get(&identities, fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE userID=?", i.table), userID)
+	}
+	if err == nil && identities <= 1 && !user.HasPassword() {
+		err = ErrLastLoginMethod
+	}
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %v WHERE identityID=? AND userID=?", i.table), identityID, userID)
+	}
+
+	if wrapInSingleTransaction {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}
+
+	return err
+}
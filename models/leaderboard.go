@@ -0,0 +1,279 @@
+// Leaderboards ranking submitters and curators
+
+package models
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/jmoiron/sqlx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LeaderboardPeriod is the time window a leaderboard covers
+type LeaderboardPeriod string
+
+// Leaderboard periods
+const (
+	Weekly  LeaderboardPeriod = "weekly"
+	Monthly LeaderboardPeriod = "monthly"
+	AllTime LeaderboardPeriod = "all-time"
+)
+
+// LeaderboardPeriods lists the periods in the order they are shown
+var LeaderboardPeriods = []LeaderboardPeriod{Weekly, Monthly, AllTime}
+
+// ParseLeaderboardPeriod returns the named period, or Weekly if the name is unknown
+func ParseLeaderboardPeriod(name string) LeaderboardPeriod {
+	for _, period := range LeaderboardPeriods {
+		if string(period) == name {
+			return period
+		}
+	}
+
+	return Weekly
+}
+
+// Since returns the start of the period ending at now. All-time leaderboards start at the zero time.
+func (p LeaderboardPeriod) Since(now time.Time) time.Time {
+	switch p {
+	case Weekly:
+		return now.AddDate(0, 0, -7)
+	case Monthly:
+		return now.AddDate(0, -1, 0)
+	}
+
+	return time.Time{}
+}
+
+// SubmitterRank is a submitter's place on a leaderboard
+type SubmitterRank struct {
+	Rank     int    `bson:"-" json:"rank"`
+	UserID   int64  `bson:"_id" json:"-"`
+	Username string `bson:"-" json:"username"`
+	// Stars received on accepted phrases during the period
+	Stars      int64 `bson:"stars" json:"stars"`
+	NumRatings int64 `bson:"numRatings" json:"numRatings"`
+}
+
+// CuratorRank is a curator's place on a leaderboard
+type CuratorRank struct {
+	Rank     int    `bson:"-" json:"rank"`
+	UserID   int64  `bson:"_id" json:"-"`
+	Username string `bson:"-" json:"username"`
+	// Phrases accepted or rejected during the period
+	Reviews int64 `bson:"reviews" json:"reviews"`
+	// Average time from submission to review, in milliseconds as computed by Mongo
+	TurnaroundMillis float64 `bson:"turnaround" json:"averageTurnaroundMillis"`
+	// AverageTurnaround is TurnaroundMillis as a duration, rounded to seconds
+	AverageTurnaround time.Duration `bson:"-" json:"-"`
+}
+
+// GetSubmitterLeaderboard ranks submitters by the stars their accepted phrases received since the given time
+func GetSubmitterLeaderboard(since time.Time, limit int, phrases *mongo.Collection, userRatings *mongo.Collection) ([]SubmitterRank, error) {
+	pipeline := bson.A{
+		// Only count ratings given during the period
+		bson.M{
+			"$match": bson.M{"rateDate": bson.M{"$gte": since}},
+		},
+		// Attach the rated phrase to find its submitter
+		bson.M{
+			"$lookup": bson.M{
+				"from":         phrases.Name(),
+				"localField":   "phraseID",
+				"foreignField": "_id",
+				"as":           "phrase",
+			},
+		},
+		bson.M{
+			"$unwind": "$phrase",
+		},
+		bson.M{
+			"$match": bson.M{"phrase.displayValue": Accepted},
+		},
+		bson.M{
+			"$group": bson.M{
+				"_id":        "$phrase.submitterUserID",
+				"stars":      bson.M{"$sum": "$ratingValue"},
+				"numRatings": bson.M{"$sum": 1},
+			},
+		},
+		bson.M{
+			"$sort": bson.D{{Key: "stars", Value: -1}, {Key: "numRatings", Value: -1}},
+		},
+		bson.M{
+			"$limit": limit,
+		},
+	}
+
+	cur, err := userRatings.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	ranks := []SubmitterRank{}
+	for cur.Next(context.Background()) {
+		var rank SubmitterRank
+		err = cur.Decode(&rank)
+		if err != nil {
+			return nil, err
+		}
+		rank.Rank = len(ranks) + 1
+		ranks = append(ranks, rank)
+	}
+
+	return ranks, cur.Err()
+}
+
+// GetCuratorLeaderboard ranks curators by the number of phrases they reviewed since the given time,
+// breaking ties by the fastest average turnaround
+func GetCuratorLeaderboard(since time.Time, limit int, phrases *mongo.Collection) ([]CuratorRank, error) {
+	pipeline := bson.A{
+		// Phrases rejected by the moderation pipeline have no reviewer and don't count
+		bson.M{
+			"$match": bson.M{
+				"displayValue": bson.M{"$in": bson.A{Accepted, Rejected}},
+				"reviewedBy":   bson.M{"$gt": 0},
+				"reviewDate":   bson.M{"$gte": since},
+			},
+		},
+		bson.M{
+			"$group": bson.M{
+				"_id":        "$reviewedBy",
+				"reviews":    bson.M{"$sum": 1},
+				"turnaround": bson.M{"$avg": bson.M{"$subtract": bson.A{"$reviewDate", "$submissionDate"}}},
+			},
+		},
+		bson.M{
+			"$sort": bson.D{{Key: "reviews", Value: -1}, {Key: "turnaround", Value: 1}},
+		},
+		bson.M{
+			"$limit": limit,
+		},
+	}
+
+	cur, err := phrases.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	ranks := []CuratorRank{}
+	for cur.Next(context.Background()) {
+		var rank CuratorRank
+		err = cur.Decode(&rank)
+		if err != nil {
+			return nil, err
+		}
+		rank.Rank = len(ranks) + 1
+		rank.AverageTurnaround = time.Duration(rank.TurnaroundMillis * float64(time.Millisecond)).Round(time.Second)
+		ranks = append(ranks, rank)
+	}
+
+	return ranks, cur.Err()
+}
+
+// Leaderboard holds the rankings for one period
+type Leaderboard struct {
+	Period     LeaderboardPeriod `json:"period"`
+	Submitters []SubmitterRank   `json:"submitters"`
+	Curators   []CuratorRank     `json:"curators"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+}
+
+// LeaderboardCache keeps the leaderboards of every period in memory.
+// The aggregations scan whole collections, so they run on Refresh rather than on every request.
+type LeaderboardCache struct {
+	db      *sqlx.DB
+	mongodb *mongo.Database
+	limit   int
+
+	mu           sync.RWMutex
+	leaderboards map[LeaderboardPeriod]*Leaderboard
+	stale        chan struct{}
+}
+
+// NewLeaderboardCache creates an empty cache of leaderboards with up to limit entries each
+func NewLeaderboardCache(db *sqlx.DB, mongodb *mongo.Database, limit int) *LeaderboardCache {
+	return &LeaderboardCache{
+		db:           db,
+		mongodb:      mongodb,
+		limit:        limit,
+		leaderboards: make(map[LeaderboardPeriod]*Leaderboard),
+		stale:        make(chan struct{}, 1),
+	}
+}
+
+// Invalidate marks the leaderboards as out of date. Several calls before the next refresh count as one.
+func (c *LeaderboardCache) Invalidate() {
+	select {
+	case c.stale <- struct{}{}:
+	default:
+	}
+}
+
+// Invalidated receives once the leaderboards were invalidated since it last did
+func (c *LeaderboardCache) Invalidated() <-chan struct{} {
+	return c.stale
+}
+
+// Get returns the cached leaderboard for a period, or nil if it wasn't computed yet
+func (c *LeaderboardCache) Get(period LeaderboardPeriod) *Leaderboard {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.leaderboards[period]
+}
+
+// Refresh recomputes the leaderboards of every period
+func (c *LeaderboardCache) Refresh() error {
+	phrases := NewPhraseConnection(c.mongodb)
+	userRatings := NewUserRatingsConnection(c.mongodb)
+	users := NewUser(c.db)
+
+	now := time.Now()
+
+	for _, period := range LeaderboardPeriods {
+		since := period.Since(now)
+
+		submitters, err := GetSubmitterLeaderboard(since, c.limit, phrases, userRatings)
+		if err != nil {
+			return err
+		}
+
+		curators, err := GetCuratorLeaderboard(since, c.limit, phrases)
+		if err != nil {
+			return err
+		}
+
+		for i := range submitters {
+			submitters[i].Username = leaderboardUsername(users, submitters[i].UserID)
+		}
+		for i := range curators {
+			curators[i].Username = leaderboardUsername(users, curators[i].UserID)
+		}
+
+		leaderboard := &Leaderboard{Period: period, Submitters: submitters, Curators: curators, UpdatedAt: now}
+
+		c.mu.Lock()
+		c.leaderboards[period] = leaderboard
+		c.mu.Unlock()
+	}
+
+	return nil
+}
+
+// leaderboardUsername looks up the username to show for a ranked user
+func leaderboardUsername(users *User, userID int64) string {
+	user, err := users.GetByID(nil, userID)
+	if err != nil {
+		logrus.Errorln(err)
+		return "[deleted]"
+	}
+
+	return user.Username
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// Test parsing leaderboard periods from query strings
+func TestParseLeaderboardPeriod(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected LeaderboardPeriod
+	}{
+		{"weekly", Weekly},
+		{"monthly", Monthly},
+		{"all-time", AllTime},
+		{"", Weekly},
+		{"yearly", Weekly},
+	}
+
+	for _, test := range tests {
+		if period := ParseLeaderboardPeriod(test.input); period != test.expected {
+			t.Errorf("Period for %q should be %v. Received: %v", test.input, test.expected, period)
+		}
+	}
+}
+
+// Test the start of each leaderboard period
+func TestLeaderboardPeriodSince(t *testing.T) {
+	now := time.Date(2019, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	if since := Weekly.Since(now); !since.Equal(time.Date(2019, time.March, 8, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Weekly period starts at the wrong time. Received: %v", since)
+	}
+	if since := Monthly.Since(now); !since.Equal(time.Date(2019, time.February, 15, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Monthly period starts at the wrong time. Received: %v", since)
+	}
+	if since := AllTime.Since(now); !since.IsZero() {
+		t.Errorf("All-time period should start at the zero time. Received: %v", since)
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Reasons a login lockout was recorded
+const (
+	// LockoutByUsername means too many failed logins for one username
+	LockoutByUsername = "username"
+	// LockoutByIP means too many failed logins from one client IP
+	LockoutByIP = "ip"
+)
+
+// LoginLockoutRow is a lockout notification kept for administrators
+type LoginLockoutRow struct {
+	ID          int64     `db:"lockoutID"`
+	Username    string    `db:"username"`
+	IPAddress   string    `db:"ipAddress"`
+	Reason      string    `db:"reason"`
+	LockedAt    time.Time `db:"lockedAt"`
+	LockedUntil time.Time `db:"lockedUntil"`
+}
+
+// LoginLockout represents the LoginLockouts_T table
+type LoginLockout struct {
+	Base
+}
+
+// NewLoginLockout creates a new LoginLockout
+func NewLoginLockout(db *sqlx.DB) *LoginLockout {
+	lockout := &LoginLockout{}
+	lockout.db = db
+	lockout.table = "LoginLockouts_T"
+	lockout.hasID = true
+
+	return lockout
+}
+
+// Record stores a lockout so administrators can see it
+func (l *LoginLockout) Record(tx *sqlx.Tx, username, ipAddress, reason string, lockedUntil time.Time) error {
+	data := make(map[string]interface{})
+	data["username"] = username
+	data["ipAddress"] = ipAddress
+	data["reason"] = reason
+	data["lockedAt"] = time.Now()
+	data["lockedUntil"] = lockedUntil
+
+	_, err := l.InsertIntoTable(tx, data)
+	return err
+}
+
+// Recent returns the latest lockouts, newest first
+func (l *LoginLockout) Recent(tx *sqlx.Tx, limit int) ([]LoginLockoutRow, error) {
+	lockouts := []LoginLockoutRow{}
+	query := fmt.Sprintf("SELECT * FROM %v ORDER BY lockedAt DESC LIMIT ?", l.table)
+	err := l.db.Select(&lockouts, query, limit)
+
+	return lockouts, err
+}
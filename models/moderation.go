@@ -0,0 +1,97 @@
+// Moderation rules applied to phrases before they reach the curator queue
+
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/punocracy/punocracy/libmoderate"
+)
+
+// Only one set of rules exists; this is its _id
+const moderationRulesID = "default"
+
+// ModerationError is returned when moderation rejects a phrase
+type ModerationError struct {
+	Reason string
+}
+
+func (e *ModerationError) Error() string {
+	return "models: phrase rejected by moderation: " + e.Reason
+}
+
+// BlockedTerm is a word that counts against a phrase, weighted by Score
+type BlockedTerm struct {
+	Term  string  `bson:"term"`
+	Score float64 `bson:"score"`
+}
+
+// ModerationRules are the administrator-editable settings of the moderation pipeline
+type ModerationRules struct {
+	RulesID         string        `bson:"_id"`
+	BlockedTerms    []BlockedTerm `bson:"blockedTerms"`
+	LinkScore       float64       `bson:"linkScore"`
+	FlagThreshold   float64       `bson:"flagThreshold"`
+	RejectThreshold float64       `bson:"rejectThreshold"`
+	UpdatedBy       int64         `bson:"updatedBy"`
+	UpdateDate      time.Time     `bson:"updateDate"`
+}
+
+// DefaultModerationRules are used until an administrator saves their own: no blocked terms, and links are rejected
+func DefaultModerationRules() ModerationRules {
+	return ModerationRules{
+		RulesID:         moderationRulesID,
+		BlockedTerms:    []BlockedTerm{},
+		LinkScore:       1,
+		FlagThreshold:   0.5,
+		RejectThreshold: 1,
+	}
+}
+
+// Pipeline builds the moderation pipeline described by the rules
+func (m ModerationRules) Pipeline() *libmoderate.Pipeline {
+	blocklist := libmoderate.BlocklistScorer{Terms: make(map[string]float64)}
+	for _, blocked := range m.BlockedTerms {
+		blocklist.Terms[blocked.Term] = blocked.Score
+	}
+
+	return &libmoderate.Pipeline{
+		Scorers: []libmoderate.Scorer{
+			blocklist,
+			libmoderate.LinkScorer{ScorePerLink: m.LinkScore},
+		},
+		FlagThreshold:   m.FlagThreshold,
+		RejectThreshold: m.RejectThreshold,
+	}
+}
+
+// NewModerationRulesConnection creates a reference to the moderationRules collection from DB pointer
+func NewModerationRulesConnection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("moderationRules")
+}
+
+// GetModerationRules loads the current rules, falling back to the defaults if none were saved
+func GetModerationRules(rulesCollection *mongo.Collection) (ModerationRules, error) {
+	var rules ModerationRules
+	err := rulesCollection.FindOne(context.Background(), bson.M{"_id": moderationRulesID}).Decode(&rules)
+	if err == mongo.ErrNoDocuments {
+		return DefaultModerationRules(), nil
+	}
+
+	return rules, err
+}
+
+// SaveModerationRules replaces the current rules. They apply to the next phrase submitted.
+func SaveModerationRules(rules ModerationRules, editor UserRow, rulesCollection *mongo.Collection) error {
+	rules.RulesID = moderationRulesID
+	rules.UpdatedBy = editor.ID
+	rules.UpdateDate = time.Now()
+
+	_, err := rulesCollection.ReplaceOne(context.Background(), bson.M{"_id": moderationRulesID}, rules, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/punocracy/punocracy/libmoderate"
+)
+
+// Test the pipeline built from moderation rules
+func TestModerationRulesPipeline(t *testing.T) {
+	rules := DefaultModerationRules()
+	rules.BlockedTerms = []BlockedTerm{{"darn", 0.5}, {"blast", 1}}
+
+	tests := []struct {
+		input    string
+		expected libmoderate.Verdict
+	}{
+		{"To live is to dream.", libmoderate.Clean},
+		{"Darn, to live is to dream.", libmoderate.Flagged},
+		{"Blast, to live is to dream.", libmoderate.Rejected},
+		{"To live is to dream at example.com", libmoderate.Rejected},
+	}
+
+	pipeline := rules.Pipeline()
+	for _, test := range tests {
+		if result := pipeline.Check(test.input); result.Verdict != test.expected {
+			t.Errorf("Verdict for %q is %v, expected %v", test.input, result.Verdict, test.expected)
+		}
+	}
+}
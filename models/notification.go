@@ -0,0 +1,267 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of notifications
+const (
+	NotificationPhraseAccepted = "phrase_accepted"
+	NotificationPhraseRejected = "phrase_rejected"
+	NotificationFiveStarRating = "five_star_rating"
+	NotificationNewFollower    = "new_follower"
+	// NotificationCuratorQueue is only sent to curators
+	NotificationCuratorQueue = "curator_queue"
+)
+
+// NotificationTypes lists every kind of notification in the order they are shown in preferences
+var NotificationTypes = []string{NotificationPhraseAccepted, NotificationPhraseRejected, NotificationFiveStarRating, NotificationNewFollower, NotificationCuratorQueue}
+
+// How a user wants to get a kind of notification
+const (
+	// DeliveryOff drops the notification
+	DeliveryOff = "off"
+	// DeliveryInApp only shows the notification on the site
+	DeliveryInApp = "in_app"
+	// DeliveryEmail also includes the notification in the email digest if it's still unread
+	DeliveryEmail = "email"
+)
+
+var ErrUnknownNotificationType = errors.New("models: unknown notification type")
+var ErrUnknownNotificationDelivery = errors.New("models: unknown notification delivery")
+
+// NotificationRow is something that happened which a user should know about
+type NotificationRow struct {
+	ID      int64  `db:"notificationID"`
+	UserID  int64  `db:"userID"`
+	Type    string `db:"type"`
+	Message string `db:"message"`
+	Link    string `db:"link"`
+	// Digest is set if the notification goes in the email digest
+	Digest    bool       `db:"digest"`
+	CreatedAt time.Time  `db:"createdAt"`
+	ReadAt    *time.Time `db:"readAt"`
+	EmailedAt *time.Time `db:"emailedAt"`
+}
+
+// Unread reports whether the user hasn't seen the notification yet
+func (n NotificationRow) Unread() bool {
+	return n.ReadAt == nil
+}
+
+// Notification represents the Notifications_T table and the preferences in NotificationPreferences_T
+type Notification struct {
+	Base
+}
+
+// NewNotification creates a new Notification
+func NewNotification(db *sqlx.DB) *Notification {
+	notification := &Notification{}
+	notification.db = db
+	notification.table = "Notifications_T"
+	notification.hasID = true
+
+	return notification
+}
+
+// ParseNotificationPreferences checks preferences submitted as type to delivery.
+// Types that are missing keep their default, in-app delivery.
+func ParseNotificationPreferences(preferences map[string]string) (map[string]string, error) {
+	parsed := DefaultNotificationPreferences()
+
+	for notificationType, delivery := range preferences {
+		if _, known := parsed[notificationType]; !known {
+			return nil, ErrUnknownNotificationType
+		}
+		if delivery != DeliveryOff && delivery != DeliveryInApp && delivery != DeliveryEmail {
+			return nil, ErrUnknownNotificationDelivery
+		}
+		parsed[notificationType] = delivery
+	}
+
+	return parsed, nil
+}
+
+// DefaultNotificationPreferences shows every notification on the site and emails none
+func DefaultNotificationPreferences() map[string]string {
+	preferences := make(map[string]string)
+	for _, notificationType := range NotificationTypes {
+		preferences[notificationType] = DeliveryInApp
+	}
+
+	return preferences
+}
+
+// Preferences returns how the user wants to get each kind of notification
+func (n *Notification) Preferences(tx *sqlx.Tx, userID int64) (map[string]string, error) {
+	rows := []struct {
+		Type     string `db:"type"`
+		Delivery string `db:"delivery"`
+	}{}
+	err := n.db.Select(&rows, "SELECT type, delivery FROM NotificationPreferences_T WHERE userID=?", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences := DefaultNotificationPreferences()
+	for _, row := range rows {
+		if _, known := preferences[row.Type]; known {
+			preferences[row.Type] = row.Delivery
+		}
+	}
+
+	return preferences, nil
+}
+
+// SetPreferences saves how the user wants to get each kind of notification
+func (n *Notification) SetPreferences(tx *sqlx.Tx, userID int64, preferences map[string]string) error {
+	preferences, err := ParseNotificationPreferences(preferences)
+	if err != nil {
+		return err
+	}
+
+	for _, notificationType := range NotificationTypes {
+		_, err = n.db.Exec(
+			"INSERT INTO NotificationPreferences_T (userID, type, delivery) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE delivery=VALUES(delivery)",
+			userID, notificationType, preferences[notificationType],
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Notify tells the user about something, unless they turned that kind of notification off
+func (n *Notification) Notify(tx *sqlx.Tx, userID int64, notificationType, message, link string) error {
+	var delivery string
+	err := n.db.Get(&delivery, "SELECT delivery FROM NotificationPreferences_T WHERE userID=? AND type=?", userID, notificationType)
+	if err == sql.ErrNoRows {
+		delivery = DeliveryInApp
+	} else if err != nil {
+		return err
+	}
+
+	if delivery == DeliveryOff {
+		return nil
+	}
+
+	data := make(map[string]interface{})
+	data["userID"] = userID
+	data["type"] = notificationType
+	data["message"] = truncate(message, 255)
+	data["link"] = link
+	data["digest"] = delivery == DeliveryEmail
+	data["createdAt"] = time.Now()
+
+	_, err = n.InsertIntoTable(tx, data)
+	return err
+}
+
+// NotifyOnce notifies a user like Notify, unless an unread notification of the same type
+// already links to the same place, like one about the same follower.
+func (n *Notification) NotifyOnce(tx *sqlx.Tx, userID int64, notificationType, message, link string) error {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE userID=? AND readAt IS NULL AND type=? AND link=?", n.table)
+	err := n.db.Get(&count, query, userID, notificationType, link)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return n.Notify(tx, userID, notificationType, message, link)
+}
+
+// CountUnread counts the notifications the user hasn't read
+func (n *Notification) CountUnread(tx *sqlx.Tx, userID int64) (int, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE userID=? AND readAt IS NULL", n.table)
+	err := n.db.Get(&count, query, userID)
+
+	return count, err
+}
+
+// Recent returns the user's latest notifications, newest first
+func (n *Notification) Recent(tx *sqlx.Tx, userID int64, limit int) ([]NotificationRow, error) {
+	notifications := []NotificationRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE userID=? ORDER BY notificationID DESC LIMIT ?", n.table)
+	err := n.db.Select(&notifications, query, userID, limit)
+
+	return notifications, err
+}
+
+// MarkRead marks one of the user's notifications as read
+func (n *Notification) MarkRead(tx *sqlx.Tx, userID, notificationID int64) error {
+	query := fmt.Sprintf("UPDATE %v SET readAt=? WHERE notificationID=? AND userID=? AND readAt IS NULL", n.table)
+	_, err := n.db.Exec(query, time.Now(), notificationID, userID)
+
+	return err
+}
+
+// MarkAllRead marks every notification of the user as read
+func (n *Notification) MarkAllRead(tx *sqlx.Tx, userID int64) error {
+	query := fmt.Sprintf("UPDATE %v SET readAt=? WHERE userID=? AND readAt IS NULL", n.table)
+	_, err := n.db.Exec(query, time.Now(), userID)
+
+	return err
+}
+
+// PendingDigests returns the unread notifications waiting for an email digest, grouped by user.
+// Users without a verified email address get no digest.
+func (n *Notification) PendingDigests(tx *sqlx.Tx) (map[int64][]NotificationRow, error) {
+	notifications := []NotificationRow{}
+	query := fmt.Sprintf(
+		"SELECT n.* FROM %v n JOIN Users_T u ON u.userID=n.userID WHERE n.digest AND n.emailedAt IS NULL AND n.readAt IS NULL AND u.emailVerified ORDER BY n.userID, n.notificationID",
+		n.table,
+	)
+	err := n.db.Select(&notifications, query)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make(map[int64][]NotificationRow)
+	for _, notification := range notifications {
+		digests[notification.UserID] = append(digests[notification.UserID], notification)
+	}
+
+	return digests, nil
+}
+
+// MarkEmailed records that the notifications went out in a digest
+func (n *Notification) MarkEmailed(tx *sqlx.Tx, notifications []NotificationRow) error {
+	query := fmt.Sprintf("UPDATE %v SET emailedAt=? WHERE notificationID=?", n.table)
+	now := time.Now()
+
+	for _, notification := range notifications {
+		if _, err := n.db.Exec(query, now, notification.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FormatDigest writes the body of a digest email. Links are made absolute with baseURL.
+func FormatDigest(username string, notifications []NotificationRow, baseURL string) string {
+	var body strings.Builder
+
+	fmt.Fprintf(&body, "Hi %v,\n\nHere is what happened on Punocracy since your last digest:\n\n", username)
+	for _, notification := range notifications {
+		fmt.Fprintf(&body, "- %v\n", notification.Message)
+		if notification.Link != "" {
+			fmt.Fprintf(&body, "  %v%v\n", baseURL, notification.Link)
+		}
+	}
+	fmt.Fprintf(&body, "\nSee all your notifications or change which ones are emailed at %v/notifications\n", baseURL)
+
+	return body.String()
+}
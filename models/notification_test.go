@@ -0,0 +1,41 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNotificationPreferences(t *testing.T) {
+	preferences, err := ParseNotificationPreferences(map[string]string{NotificationNewFollower: DeliveryOff, NotificationPhraseAccepted: DeliveryEmail})
+	if err != nil {
+		t.Fatalf("Known preferences should parse. Error: %v", err)
+	}
+	if preferences[NotificationNewFollower] != DeliveryOff || preferences[NotificationPhraseAccepted] != DeliveryEmail {
+		t.Errorf("Submitted preferences should be kept. Received: %v", preferences)
+	}
+	if preferences[NotificationFiveStarRating] != DeliveryInApp {
+		t.Errorf("Missing preferences should default to in-app. Received: %v", preferences[NotificationFiveStarRating])
+	}
+
+	if _, err := ParseNotificationPreferences(map[string]string{"phrase_deleted": DeliveryOff}); err != ErrUnknownNotificationType {
+		t.Errorf("Unknown types should be refused. Received: %v", err)
+	}
+	if _, err := ParseNotificationPreferences(map[string]string{NotificationNewFollower: "sms"}); err != ErrUnknownNotificationDelivery {
+		t.Errorf("Unknown deliveries should be refused. Received: %v", err)
+	}
+}
+
+func TestFormatDigest(t *testing.T) {
+	notifications := []NotificationRow{
+		{Message: "Your phrase “knight shift” was accepted.", Link: "/phrases/abc"},
+		{Message: "The queue is long."},
+	}
+
+	body := FormatDigest("sam", notifications, "https://punocracy.example")
+
+	for _, expected := range []string{"Hi sam,", "- Your phrase “knight shift” was accepted.\n  https://punocracy.example/phrases/abc\n", "- The queue is long.\n\n", "https://punocracy.example/notifications"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("The digest should contain %q. Received: %v", expected, body)
+		}
+	}
+}
@@ -7,11 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"sort"
-	"strings"
 	"time"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/jmoiron/sqlx"
+	"github.com/punocracy/punocracy/libevent"
+	"github.com/punocracy/punocracy/libmoderate"
+	"github.com/punocracy/punocracy/libtokenize"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -65,6 +66,10 @@ type Phrase struct {
 	ReviewDate      time.Time          `bson:"reviewDate"`
 	PhraseText      string             `bson:"phraseText"`
 	DisplayPublic   DisplayValue       `bson:"displayValue"`
+	// Set by the moderation pipeline when a phrase is flagged or rejected
+	ModerationScore  float64  `bson:"moderationScore"`
+	ModerationReason string   `bson:"moderationReason"`
+	FlaggedTerms     []string `bson:"flaggedTerms"`
 }
 
 // Pretty printing like a JSON document for Phrase
@@ -118,6 +123,27 @@ func NewPhraseConnection(db *mongo.Database) *mongo.Collection {
 	return db.Collection("phrases")
 }
 
+// EnsurePhraseIndexes creates the indexes the phrase queries rely on, if they don't exist yet
+func EnsurePhraseIndexes(phrasesCollection *mongo.Collection) error {
+	_, err := phrasesCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "submitterUserID", Value: 1},
+				{Key: "displayValue", Value: 1},
+				{Key: "reviewDate", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "displayValue", Value: 1},
+				{Key: "reviewDate", Value: -1},
+			},
+		},
+	})
+
+	return err
+}
+
 // Get wordID list from SQL database. Unsafe!
 func fakeGetWordIDList(words []string, db *sqlx.DB) ([]int, error) {
 	// Build query string
@@ -138,35 +164,52 @@ func fakeGetWordIDList(words []string, db *sqlx.DB) ([]int, error) {
 	return wordIDs, nil
 }
 
-// Insert a candidate phrase submitted by a user
-func InsertPhrase(phraseText string, creator UserRow, wordInstance *Word, phrasesCollection *mongo.Collection) error {
-	// Split into lowercase words by space character
-	allWords := strings.Split(strings.ToLower(phraseText), " ")
-
-	// Get all unique words
-	wordMap := make(map[string]bool)
-	for _, word := range allWords {
-		if _, ok := wordMap[word]; !ok {
-			wordMap[word] = true
-		}
+// Get the IDs of the homophones that appear in a phrase
+func phraseWordIDs(phraseText string, wordInstance *Word) ([]int, error) {
+	words := libtokenize.Words(phraseText)
+	if len(words) == 0 {
+		return []int{}, nil
 	}
 
-	var uniqueWords []string
-	for word := range wordMap {
-		uniqueWords = append(uniqueWords, word)
+	// Query the database to check if any of the words are homophones
+	wordIDs, err := wordInstance.GetWordIDList(nil, words)
+	if err == ErrEmptyWordList {
+		return []int{}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Query the database to check if any of the words are homophones
-	wordIDs, err := wordInstance.GetWordIDList(nil, uniqueWords)
+	return wordIDs, nil
+}
+
+// Insert a candidate phrase submitted by a user.
+// The phrase is checked by the moderator pipeline first: rejected phrases are stored as Rejected
+// and a *ModerationError is returned, flagged ones are queued with their flagged terms.
+// The stored phrase is returned either way.
+func InsertPhrase(phraseText string, creator UserRow, wordInstance *Word, moderator *libmoderate.Pipeline, events *libevent.Bus, phrasesCollection *mongo.Collection) (Phrase, error) {
+	return insertPhrase(phraseText, creator, false, wordInstance, moderator, events, phrasesCollection)
+}
+
+// InsertPhraseSkippingQueue inserts a phrase like InsertPhrase, but publishes it right away
+// if the moderator pipeline finds nothing wrong with it. Flagged phrases still go to the curators.
+func InsertPhraseSkippingQueue(phraseText string, creator UserRow, wordInstance *Word, moderator *libmoderate.Pipeline, events *libevent.Bus, phrasesCollection *mongo.Collection) (Phrase, error) {
+	return insertPhrase(phraseText, creator, true, wordInstance, moderator, events, phrasesCollection)
+}
+
+func insertPhrase(phraseText string, creator UserRow, skipQueue bool, wordInstance *Word, moderator *libmoderate.Pipeline, events *libevent.Bus, phrasesCollection *mongo.Collection) (Phrase, error) {
+	wordIDs, err := phraseWordIDs(phraseText, wordInstance)
 	if err != nil {
-		return err
+		return Phrase{}, err
 	}
 
 	// Check if the list is empty and return error
 	if len(wordIDs) == 0 {
-		return errors.New("Error: no homophones in candidate phrase.")
+		return Phrase{}, errors.New("Error: no homophones in candidate phrase.")
 	}
 
+	moderation := moderator.Check(phraseText)
+
 	// Create the full record
 	candPhrase := Phrase{
 		PhraseID:        primitive.NewObjectID(),
@@ -178,55 +221,180 @@ func InsertPhrase(phraseText string, creator UserRow, wordInstance *Word, phrase
 		ReviewDate:      time.Now(),
 		PhraseText:      phraseText,
 		DisplayPublic:   Unreviewed,
+		ModerationScore: moderation.Score,
+		FlaggedTerms:    []string{},
+	}
+
+	if moderation.Verdict != libmoderate.Clean {
+		candPhrase.ModerationReason = moderation.Reason()
+		candPhrase.FlaggedTerms = moderation.Terms()
+	}
+	if moderation.Verdict == libmoderate.Rejected {
+		candPhrase.DisplayPublic = Rejected
+	}
+	if moderation.Verdict == libmoderate.Clean && skipQueue {
+		candPhrase.DisplayPublic = Accepted
 	}
 
 	// Insert into collection
 	_, err = phrasesCollection.InsertOne(context.Background(), candPhrase)
 	if err != nil {
-		return err
+		return candPhrase, err
+	}
+
+	events.Publish(PhraseSubmitted{Phrase: candPhrase})
+	switch candPhrase.DisplayPublic {
+	case Accepted:
+		events.Publish(PhraseAccepted{Phrase: candPhrase, PreviousStatus: Unreviewed})
+	case Rejected:
+		events.Publish(PhraseRejected{Phrase: candPhrase, PreviousStatus: Unreviewed})
+	}
+
+	if moderation.Verdict == libmoderate.Rejected {
+		return candPhrase, &ModerationError{Reason: candPhrase.ModerationReason}
 	}
 
 	// Insert the record
-	return nil
+	return candPhrase, nil
 }
 
-// Accept a reviewed phrase
-func AcceptPhrase(phraseIDString string, reviewer UserRow, phrasesCollection *mongo.Collection) error {
+// BackfillWordLists recomputes the wordList of every phrase with the shared tokenizer.
+// Returns the number of phrases whose wordList changed.
+func BackfillWordLists(wordInstance *Word, phrasesCollection *mongo.Collection) (int, error) {
+	cur, err := phrasesCollection.Find(context.Background(), bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(context.Background())
 
-	phraseID, _ := primitive.ObjectIDFromHex(phraseIDString)
-	logrus.Infoln(phraseID)
-	// Build update document filter (by _id)
-	filter := bson.M{"_id": phraseID}
+	updated := 0
+	for cur.Next(context.Background()) {
+		var onePhrase Phrase
+		err = cur.Decode(&onePhrase)
+		if err != nil {
+			return updated, err
+		}
 
-	// Update document
-	updateDocument := bson.M{"$set": bson.M{"reviewedBy": reviewer.ID, "reviewDate": time.Now(), "displayValue": Accepted}}
+		changed, err := IndexPhrase(onePhrase, wordInstance, phrasesCollection)
+		if err != nil {
+			return updated, err
+		}
+		if changed {
+			updated++
+		}
+	}
+
+	// Check for cursor errors
+	if err := cur.Err(); err != nil {
+		return updated, err
+	}
+
+	return updated, nil
+}
 
-	// Update the phrase in Mongo to set it to be accepted
-	_, err := phrasesCollection.UpdateOne(context.Background(), filter, updateDocument)
+// IndexPhrase recomputes the wordList of a phrase with the shared tokenizer, so it is found by the
+// homophones added since it was stored. Returns whether the wordList changed.
+func IndexPhrase(phrase Phrase, wordInstance *Word, phrasesCollection *mongo.Collection) (bool, error) {
+	wordIDs, err := phraseWordIDs(phrase.PhraseText, wordInstance)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	if sameWordIDs(phrase.WordList, wordIDs) {
+		return false, nil
+	}
+
+	filter := bson.M{"_id": phrase.PhraseID}
+	update := bson.M{"$set": bson.M{"wordList": wordIDs}}
+	_, err = phrasesCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
-// Set the specified phrase as rejected after review
-func RejectPhrase(phraseIDString string, reviewer UserRow, phrasesCollection *mongo.Collection) error {
+// Check if two word ID lists hold the same IDs, ignoring order
+func sameWordIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
 
+	counts := make(map[int]int)
+	for _, id := range a {
+		counts[id]++
+	}
+	for _, id := range b {
+		counts[id]--
+		if counts[id] < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CountUnreviewedPhrases counts the phrases a user submitted that are still waiting for a curator
+func CountUnreviewedPhrases(user UserRow, phrasesCollection *mongo.Collection) (int64, error) {
+	filter := bson.M{"submitterUserID": user.ID, "displayValue": bson.M{"$in": bson.A{Unreviewed, InReview}}}
+	return phrasesCollection.CountDocuments(context.Background(), filter)
+}
+
+// CountQueue counts the phrases waiting for a curator
+func CountQueue(phrasesCollection *mongo.Collection) (int64, error) {
+	filter := bson.M{"displayValue": bson.M{"$in": bson.A{Unreviewed, InReview}}}
+	return phrasesCollection.CountDocuments(context.Background(), filter)
+}
+
+// AcceptPhrase sets the specified phrase as accepted after review and reports whether it wasn't accepted already.
+// PhraseAccepted is only published if the status changed.
+func AcceptPhrase(phraseIDString string, reviewer UserRow, events *libevent.Bus, phrasesCollection *mongo.Collection) (bool, error) {
+	phrase, previousStatus, changed, err := reviewPhrase(phraseIDString, reviewer, Accepted, phrasesCollection)
+	if err == nil && changed {
+		events.Publish(PhraseAccepted{Phrase: phrase, Reviewer: reviewer, PreviousStatus: previousStatus})
+	}
+
+	return changed, err
+}
+
+// RejectPhrase sets the specified phrase as rejected after review and reports whether it wasn't rejected already.
+// PhraseRejected is only published if the status changed.
+func RejectPhrase(phraseIDString string, reviewer UserRow, events *libevent.Bus, phrasesCollection *mongo.Collection) (bool, error) {
+	phrase, previousStatus, changed, err := reviewPhrase(phraseIDString, reviewer, Rejected, phrasesCollection)
+	if err == nil && changed {
+		events.Publish(PhraseRejected{Phrase: phrase, Reviewer: reviewer, PreviousStatus: previousStatus})
+	}
+
+	return changed, err
+}
+
+// reviewPhrase stores a curator's decision. It returns the reviewed phrase, its status before the review
+// and whether that status changed. Unknown phrases are ignored.
+func reviewPhrase(phraseIDString string, reviewer UserRow, status DisplayValue, phrasesCollection *mongo.Collection) (Phrase, DisplayValue, bool, error) {
 	phraseID, _ := primitive.ObjectIDFromHex(phraseIDString)
 	// Build update document filter (by _id)
 	filter := bson.M{"_id": phraseID}
 
 	// Update document
-	updateDocument := bson.M{"$set": bson.M{"reviewedBy": reviewer.ID, "reviewDate": time.Now(), "displayValue": Rejected}}
+	now := time.Now()
+	updateDocument := bson.M{"$set": bson.M{"reviewedBy": reviewer.ID, "reviewDate": now, "displayValue": status}}
 
-	// Update the phrase in Mongo to set it to be accepted
-	_, err := phrasesCollection.UpdateOne(context.Background(), filter, updateDocument)
+	// Update the phrase in Mongo, getting it as it was before
+	var phrase Phrase
+	err := phrasesCollection.FindOneAndUpdate(context.Background(), filter, updateDocument).Decode(&phrase)
+	if err == mongo.ErrNoDocuments {
+		return phrase, status, false, nil
+	}
 	if err != nil {
-		return err
+		return phrase, status, false, err
 	}
 
-	return nil
+	previousStatus := phrase.DisplayPublic
+	phrase.DisplayPublic = status
+	phrase.ReviewedBy = reviewer.ID
+	phrase.ReviewDate = now
+
+	return phrase, previousStatus, previousStatus != status, nil
 }
 
 /*
@@ -389,13 +557,40 @@ func GetNewPhraseListForCurators(maxPhrases int64, curatingUser UserRow, phrases
 	return phraseList, nil
 }
 
-// Delete all phrases by a single userID
-func DeleteByUserID(user UserRow, phrasesCollection *mongo.Collection) error {
+// Delete all phrases by a single userID, along with the comments on them
+func DeleteByUserID(user UserRow, phrasesCollection *mongo.Collection, commentsCollection *mongo.Collection) error {
 	// Build query document
 	filterDocument := bson.M{"submitterUserID": user.ID}
 
+	// Collect the phrase IDs first so their comments can be removed
+	cur, err := phrasesCollection.Find(context.Background(), filterDocument, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(context.Background())
+
+	phraseIDs := []primitive.ObjectID{}
+	for cur.Next(context.Background()) {
+		var onePhrase struct {
+			PhraseID primitive.ObjectID `bson:"_id"`
+		}
+		err = cur.Decode(&onePhrase)
+		if err != nil {
+			return err
+		}
+		phraseIDs = append(phraseIDs, onePhrase.PhraseID)
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	err = DeleteCommentsByPhraseIDs(phraseIDs, commentsCollection)
+	if err != nil {
+		return err
+	}
+
 	// Execute delete statement
-	_, err := phrasesCollection.DeleteMany(context.Background(), filterDocument)
+	_, err = phrasesCollection.DeleteMany(context.Background(), filterDocument)
 	return err
 }
 
@@ -530,6 +725,33 @@ func AverageRating(r Rating) float64 {
 	return 5.0 * float64(weightedRatings) / float64(5*totalRatings)
 }
 
+// GetRecentlyAcceptedPhrases returns the most recently accepted phrases, newest first
+func GetRecentlyAcceptedPhrases(limit int64, phrasesCollection *mongo.Collection) ([]Phrase, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "reviewDate", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit)
+
+	cur, err := phrasesCollection.Find(context.Background(), bson.M{"displayValue": Accepted}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	phraseList := []Phrase{}
+	for cur.Next(context.Background()) {
+		var onePhrase Phrase
+		err = cur.Decode(&onePhrase)
+		if err != nil {
+			return nil, err
+		}
+		phraseList = append(phraseList, onePhrase)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return phraseList, nil
+}
+
 // GetTopPhrases gets a sorted list of the top phrases, limited by a number
 func GetTopPhrases(limit int, phrases *mongo.Collection) ([]Phrase, error) {
 	// Aggregation pipeline
@@ -0,0 +1,183 @@
+// Phrase editing and revision history support functions
+
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/punocracy/punocracy/libmoderate"
+)
+
+var ErrEditNotAllowed = errors.New("models: user is not allowed to edit this phrase")
+var ErrEmptyPhrase = errors.New("models: phrase text cannot be blank")
+
+// PhraseRevision stores one version of a phrase's text; the editor and the date it was written
+type PhraseRevision struct {
+	RevisionID   primitive.ObjectID `bson:"_id"`
+	PhraseID     primitive.ObjectID `bson:"phraseID"`
+	PhraseText   string             `bson:"phraseText"`
+	EditorUserID int64              `bson:"editorUserID"`
+	EditDate     time.Time          `bson:"editDate"`
+}
+
+// String implements the Stringer interface
+func (p PhraseRevision) String() string {
+	formatString := `{
+	_id: ObjectId("%v"),
+	phraseID: ObjectId("%v"),
+	phraseText: "%v",
+	editorUserID: %v,
+	editDate: %v
+}`
+	return fmt.Sprintf(formatString, p.RevisionID, p.PhraseID, p.PhraseText, p.EditorUserID, p.EditDate)
+}
+
+// NewPhraseRevisionsConnection creates a reference to the phraseRevisions collection from DB pointer
+func NewPhraseRevisionsConnection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("phraseRevisions")
+}
+
+// CanEditPhrase checks if a user may edit a phrase.
+// Curators can edit any phrase at any time. Submitters can edit their own phrases while they are
+// unreviewed, or once accepted, in which case the edit sends the phrase back to the review queue.
+func CanEditPhrase(editor UserRow, thePhrase Phrase) bool {
+	if editor.PermLevel <= Curator {
+		return true
+	}
+
+	if editor.ID != thePhrase.SubmitterUserID {
+		return false
+	}
+
+	return thePhrase.DisplayPublic == Unreviewed || thePhrase.DisplayPublic == Accepted
+}
+
+// EditPhrase changes the text of a phrase, recomputes its wordList and records the revision.
+// The new text goes through the moderator pipeline; edits it rejects are refused unless made by a curator.
+func EditPhrase(phraseID primitive.ObjectID, phraseText string, editor UserRow, wordInstance *Word, moderator *libmoderate.Pipeline, phrasesCollection *mongo.Collection, revisionsCollection *mongo.Collection) error {
+	if phraseText == "" {
+		return ErrEmptyPhrase
+	}
+
+	thePhrase, err := GetPhraseByID(phraseID, phrasesCollection)
+	if err == mongo.ErrNoDocuments {
+		return ErrPhraseNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if !CanEditPhrase(editor, thePhrase) {
+		return ErrEditNotAllowed
+	}
+
+	// Nothing to do if the text did not change
+	if thePhrase.PhraseText == phraseText {
+		return nil
+	}
+
+	wordIDs, err := phraseWordIDs(phraseText, wordInstance)
+	if err != nil {
+		return err
+	}
+
+	// Check if the list is empty and return error
+	if len(wordIDs) == 0 {
+		return errors.New("Error: no homophones in candidate phrase.")
+	}
+
+	moderation := moderator.Check(phraseText)
+	if moderation.Verdict == libmoderate.Rejected && editor.PermLevel > Curator {
+		return &ModerationError{Reason: moderation.Reason()}
+	}
+
+	// Phrases submitted before revisions existed have no history, so keep the original text first
+	count, err := revisionsCollection.CountDocuments(context.Background(), bson.M{"phraseID": phraseID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		err = addRevision(thePhrase.PhraseID, thePhrase.PhraseText, thePhrase.SubmitterUserID, thePhrase.SubmissionDate, revisionsCollection)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Update document
+	update := bson.M{
+		"phraseText":       phraseText,
+		"wordList":         wordIDs,
+		"moderationScore":  moderation.Score,
+		"moderationReason": "",
+		"flaggedTerms":     []string{},
+	}
+	if moderation.Verdict != libmoderate.Clean {
+		update["moderationReason"] = moderation.Reason()
+		update["flaggedTerms"] = moderation.Terms()
+	}
+
+	// Accepted phrases edited by someone other than a curator need to be reviewed again
+	if thePhrase.DisplayPublic == Accepted && editor.PermLevel > Curator {
+		update["displayValue"] = Unreviewed
+		update["reviewedBy"] = 0
+	}
+
+	_, err = phrasesCollection.UpdateOne(context.Background(), bson.M{"_id": phraseID}, bson.M{"$set": update})
+	if err != nil {
+		return err
+	}
+
+	return addRevision(phraseID, phraseText, editor.ID, time.Now(), revisionsCollection)
+}
+
+// addRevision inserts a single revision into the phraseRevisions collection
+func addRevision(phraseID primitive.ObjectID, phraseText string, editorUserID int64, editDate time.Time, revisionsCollection *mongo.Collection) error {
+	revision := PhraseRevision{
+		RevisionID:   primitive.NewObjectID(),
+		PhraseID:     phraseID,
+		PhraseText:   phraseText,
+		EditorUserID: editorUserID,
+		EditDate:     editDate,
+	}
+
+	_, err := revisionsCollection.InsertOne(context.Background(), revision)
+	return err
+}
+
+// GetPhraseRevisions returns the revisions of a phrase, oldest first
+func GetPhraseRevisions(phraseID primitive.ObjectID, revisionsCollection *mongo.Collection) ([]PhraseRevision, error) {
+	// Query options to have a date-sorted list
+	sortOptions := options.Find().SetSort(bson.M{"editDate": 1})
+
+	cur, err := revisionsCollection.Find(context.Background(), bson.M{"phraseID": phraseID}, sortOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	// Load into array
+	var revisions []PhraseRevision
+	for cur.Next(context.Background()) {
+		var thisRevision PhraseRevision
+		err = cur.Decode(&thisRevision)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, thisRevision)
+	}
+
+	// Check for cursor errors
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+)
+
+// Test who is allowed to edit a phrase
+func TestCanEditPhrase(t *testing.T) {
+	submitter := UserRow{ID: 2, PermLevel: RegularUser}
+	otherUser := UserRow{ID: 3, PermLevel: RegularUser}
+	curator := UserRow{ID: 4, PermLevel: Curator}
+
+	tests := []struct {
+		editor   UserRow
+		status   DisplayValue
+		expected bool
+	}{
+		{submitter, Unreviewed, true},
+		{submitter, InReview, false},
+		{submitter, Accepted, true},
+		{submitter, Rejected, false},
+		{otherUser, Unreviewed, false},
+		{curator, InReview, true},
+		{curator, Rejected, true},
+	}
+
+	for _, test := range tests {
+		phrase := newTestPhrase(submitter)
+		phrase.DisplayPublic = test.status
+
+		if output := CanEditPhrase(test.editor, phrase); output != test.expected {
+			t.Errorf("CanEditPhrase for user %v on status %v returned %v, expected %v", test.editor.ID, test.status, output, test.expected)
+		}
+	}
+}
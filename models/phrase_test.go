@@ -152,7 +152,7 @@ func TestGetPhraseListForCurators(t *testing.T) {
 	// Insert each phrase
 	for _, phrase := range testPhrases {
 		// Try to insert the phrase
-		err := InsertPhrase(phrase, testUser, wordInstance, phrasesCollection)
+		_, err := InsertPhrase(phrase, testUser, wordInstance, nil, nil, phrasesCollection)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -221,7 +221,7 @@ func TestGetNewPhrasesForCurators(t *testing.T) {
 	// Insert each phrase
 	for _, phrase := range testPhrases {
 		// Try to insert the phrase
-		err := InsertPhrase(phrase, testUser, wordInstance, phrasesCollection)
+		_, err := InsertPhrase(phrase, testUser, wordInstance, nil, nil, phrasesCollection)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -299,7 +299,7 @@ func TestGetInReviewPhrases(t *testing.T) {
 	// Insert each phrase
 	for _, phrase := range testPhrases {
 		// Try to insert the phrase
-		err := InsertPhrase(phrase, testUser, wordInstance, phrasesCollection)
+		_, err := InsertPhrase(phrase, testUser, wordInstance, nil, nil, phrasesCollection)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -410,7 +410,7 @@ func TestInsertPhrase(t *testing.T) {
 	for _, phrase := range testPhrases {
 		// Try to insert the phrase
 		var successVal bool
-		err := InsertPhrase(phrase.input, testUser, wordInstance, phrasesCollection)
+		_, err := InsertPhrase(phrase.input, testUser, wordInstance, nil, nil, phrasesCollection)
 		successVal = (err == nil)
 
 		// Check the value
@@ -463,10 +463,22 @@ func TestAcceptRejectPhrase(t *testing.T) {
 	}
 
 	// Test accept
-	err = AcceptPhrase(testPhrase.PhraseID.Hex(), testUser, phrasesCollection)
+	changed, err := AcceptPhrase(testPhrase.PhraseID.Hex(), testUser, nil, phrasesCollection)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if !changed {
+		t.Error("Accepting an unreviewed phrase should change its status")
+	}
+
+	// Accepting it again changes nothing
+	changed, err = AcceptPhrase(testPhrase.PhraseID.Hex(), testUser, nil, phrasesCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("Accepting an accepted phrase should not change its status")
+	}
 
 	// Find the phrase by ID and see if it's accepted
 	var queryPhrase Phrase
@@ -480,10 +492,13 @@ func TestAcceptRejectPhrase(t *testing.T) {
 	}
 
 	// Set phrase as rejected
-	err = RejectPhrase(testPhrase.PhraseID.Hex(), testUser, phrasesCollection)
+	changed, err = RejectPhrase(testPhrase.PhraseID.Hex(), testUser, nil, phrasesCollection)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if !changed {
+		t.Error("Rejecting an accepted phrase should change its status")
+	}
 
 	// Check if the phrase was rejected
 	err = phrasesCollection.FindOne(context.Background(), bson.M{"_id": testPhrase.PhraseID}).Decode(&queryPhrase)
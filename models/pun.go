@@ -1,35 +1,62 @@
 package models
 
 import (
-	"regexp"
 	"strings"
 
-	"github.com/Sirupsen/logrus"
+	"github.com/punocracy/punocracy/libtokenize"
 )
 
 // GeneratePuns given query word, homophone word list, and phrase
 func GeneratePuns(word string, homophoneWords []WordRow, phrases []Phrase) []string {
 	puns := []string{}
 
-	reg, err := regexp.Compile("[^a-zA-Z0-9]+")
-	if err != nil {
-		logrus.Error(err)
+	homophones := make(map[string]bool)
+	for _, homophoneWord := range homophoneWords {
+		homophones[libtokenize.Normalize(homophoneWord.Word)] = true
 	}
 
 	for _, phrase := range phrases {
-		processedString := reg.ReplaceAllString(phrase.PhraseText, " ")
-		tokens := strings.Split(processedString, " ")
-
-		for i, token := range tokens {
-			for _, homophoneWord := range homophoneWords {
-				if strings.ToLower(token) == homophoneWord.Word {
-					tokens[i] = word
-					break
-				}
+		var result strings.Builder
+		last := 0
+
+		for _, token := range libtokenize.Tokenize(phrase.PhraseText) {
+			key := token.Key()
+			replacement := ""
+
+			if homophones[key] {
+				replacement = word
+			} else if stem := libtokenize.Stem(key); stem != key && homophones[stem] {
+				// Keep the possessive when replacing its stem
+				replacement = word + token.Text[strings.LastIndexAny(token.Text, "'’ʼ"):]
+			}
+
+			if replacement != "" {
+				result.WriteString(phrase.PhraseText[last:token.Start])
+				result.WriteString(replacement)
+				last = token.End
 			}
 		}
-		result := strings.Join(tokens, " ")
-		puns = append(puns, result)
+		result.WriteString(phrase.PhraseText[last:])
+
+		puns = append(puns, result.String())
+	}
+
+	return puns
+}
+
+// RelatedPuns returns the phrase with word swapped for each of its homophones in turn
+func RelatedPuns(phrase Phrase, word WordRow, homophones []WordRow) []string {
+	puns := []string{}
+
+	for _, homophone := range homophones {
+		if homophone.WordID == word.WordID {
+			continue
+		}
+
+		pun := GeneratePuns(homophone.Word, []WordRow{word}, []Phrase{phrase})[0]
+		if pun != phrase.PhraseText {
+			puns = append(puns, pun)
+		}
 	}
 
 	return puns
@@ -0,0 +1,291 @@
+// Pun of the day, chosen automatically or scheduled by curators
+
+package models
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrNoPunOfTheDay = errors.New("models: there is no pun of the day for that day")
+var ErrInvalidDay = errors.New("models: days must be formatted as YYYY-MM-DD")
+var ErrDayInPast = errors.New("models: only today and future days can be scheduled")
+var ErrNotSchedulable = errors.New("models: only accepted phrases can be pun of the day")
+
+// DayFormat is how days are written in pun of the day keys and URLs
+const DayFormat = "2006-01-02"
+
+// punCandidatePoolSize is how many of the best phrases are considered when choosing a pun of the day
+const punCandidatePoolSize = 50
+
+// PunOfTheDay is the phrase featured on a day
+type PunOfTheDay struct {
+	Day      string             `bson:"_id"`
+	PhraseID primitive.ObjectID `bson:"phraseID"`
+	// ScheduledBy is the curator who picked the phrase, or 0 if it was chosen automatically
+	ScheduledBy int64     `bson:"scheduledBy"`
+	CreatedAt   time.Time `bson:"createdAt"`
+}
+
+// NewPunsOfTheDayConnection creates a reference to the puns of the day collection from DB pointer
+func NewPunsOfTheDayConnection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("punsOfTheDay")
+}
+
+// PunOfTheDayScheduler picks and stores the pun of each day
+type PunOfTheDayScheduler struct {
+	punsOfTheDay *mongo.Collection
+	phrases      *mongo.Collection
+	location     *time.Location
+
+	// Now is the clock, replaceable in tests
+	Now func() time.Time
+}
+
+// NewPunOfTheDayScheduler creates a scheduler whose days start at midnight in location
+func NewPunOfTheDayScheduler(db *mongo.Database, location *time.Location) *PunOfTheDayScheduler {
+	return &PunOfTheDayScheduler{
+		punsOfTheDay: NewPunsOfTheDayConnection(db),
+		phrases:      NewPhraseConnection(db),
+		location:     location,
+		Now:          time.Now,
+	}
+}
+
+// Today returns the key of the current day
+func (s *PunOfTheDayScheduler) Today() string {
+	return s.Now().In(s.location).Format(DayFormat)
+}
+
+// ParseDay checks a day key and returns it in canonical form
+func ParseDay(day string) (string, error) {
+	t, err := time.Parse(DayFormat, day)
+	if err != nil {
+		return "", ErrInvalidDay
+	}
+
+	return t.Format(DayFormat), nil
+}
+
+// AddDays returns the key of the day n days after day
+func AddDays(day string, n int) string {
+	t, _ := time.Parse(DayFormat, day)
+	return t.AddDate(0, 0, n).Format(DayFormat)
+}
+
+// Current returns today's pun of the day, choosing one if nobody scheduled it
+func (s *PunOfTheDayScheduler) Current() (PunOfTheDay, error) {
+	today := s.Today()
+
+	punOfTheDay, err := s.get(today)
+	if err != ErrNoPunOfTheDay {
+		return punOfTheDay, err
+	}
+
+	phrase, err := s.choose()
+	if err != nil {
+		return PunOfTheDay{}, err
+	}
+
+	punOfTheDay = PunOfTheDay{Day: today, PhraseID: phrase.PhraseID, CreatedAt: s.Now()}
+
+	_, err = s.punsOfTheDay.InsertOne(context.Background(), punOfTheDay)
+	if mongo.IsDuplicateKeyError(err) {
+		// Someone else chose first
+		return s.get(today)
+	}
+
+	return punOfTheDay, err
+}
+
+// Get returns the pun of a day up to today. Future days are not revealed.
+func (s *PunOfTheDayScheduler) Get(day string) (PunOfTheDay, error) {
+	day, err := ParseDay(day)
+	if err != nil {
+		return PunOfTheDay{}, err
+	}
+
+	if day == s.Today() {
+		return s.Current()
+	}
+	if day > s.Today() {
+		return PunOfTheDay{}, ErrNoPunOfTheDay
+	}
+
+	return s.get(day)
+}
+
+func (s *PunOfTheDayScheduler) get(day string) (PunOfTheDay, error) {
+	var punOfTheDay PunOfTheDay
+	err := s.punsOfTheDay.FindOne(context.Background(), bson.M{"_id": day}).Decode(&punOfTheDay)
+	if err == mongo.ErrNoDocuments {
+		return punOfTheDay, ErrNoPunOfTheDay
+	}
+
+	return punOfTheDay, err
+}
+
+// between returns the puns of the days from first to last inclusive, in order
+func (s *PunOfTheDayScheduler) between(first, last string, order int) ([]PunOfTheDay, error) {
+	findOptions := options.Find().SetSort(bson.M{"_id": order})
+
+	cur, err := s.punsOfTheDay.Find(context.Background(), bson.M{"_id": bson.M{"$gte": first, "$lte": last}}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	puns := []PunOfTheDay{}
+	for cur.Next(context.Background()) {
+		var punOfTheDay PunOfTheDay
+		err = cur.Decode(&punOfTheDay)
+		if err != nil {
+			return nil, err
+		}
+		puns = append(puns, punOfTheDay)
+	}
+
+	return puns, cur.Err()
+}
+
+// Archive returns the puns of the days of month (formatted YYYY-MM) up to today, most recent first
+func (s *PunOfTheDayScheduler) Archive(month string) ([]PunOfTheDay, error) {
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return nil, ErrInvalidDay
+	}
+
+	last := start.AddDate(0, 1, -1).Format(DayFormat)
+	if today := s.Today(); last > today {
+		last = today
+	}
+
+	return s.between(start.Format(DayFormat), last, -1)
+}
+
+// Calendar returns the puns scheduled from today for the given number of days
+func (s *PunOfTheDayScheduler) Calendar(days int) ([]PunOfTheDay, error) {
+	today := s.Today()
+
+	return s.between(today, AddDays(today, days-1), 1)
+}
+
+// Schedule makes a curator's choice the pun of today or a future day, replacing whatever was there
+func (s *PunOfTheDayScheduler) Schedule(day string, thePhrase Phrase, curator UserRow) error {
+	day, err := ParseDay(day)
+	if err != nil {
+		return err
+	}
+	if day < s.Today() {
+		return ErrDayInPast
+	}
+	if thePhrase.DisplayPublic != Accepted {
+		return ErrNotSchedulable
+	}
+
+	punOfTheDay := PunOfTheDay{Day: day, PhraseID: thePhrase.PhraseID, ScheduledBy: curator.ID, CreatedAt: s.Now()}
+
+	_, err = s.punsOfTheDay.ReplaceOne(context.Background(), bson.M{"_id": day}, punOfTheDay, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Unschedule removes the pun of a future day, so one is chosen automatically when the day comes
+func (s *PunOfTheDayScheduler) Unschedule(day string) error {
+	day, err := ParseDay(day)
+	if err != nil {
+		return err
+	}
+	if day <= s.Today() {
+		return ErrDayInPast
+	}
+
+	_, err = s.punsOfTheDay.DeleteOne(context.Background(), bson.M{"_id": day})
+	return err
+}
+
+// choose picks the best accepted phrase that was never featured
+func (s *PunOfTheDayScheduler) choose() (Phrase, error) {
+	featured, err := s.punsOfTheDay.Distinct(context.Background(), "phraseID", bson.M{})
+	if err != nil {
+		return Phrase{}, err
+	}
+
+	pipeline := bson.A{
+		bson.M{
+			"$match": bson.M{"displayValue": Accepted, "_id": bson.M{"$nin": featured}},
+		},
+		bson.M{
+			"$addFields": bson.M{"numRatings": numRatingsExpression, "stars": starsExpression},
+		},
+		bson.M{
+			"$addFields": bson.M{
+				"avgRating": bson.M{
+					"$cond": bson.A{bson.M{"$eq": bson.A{"$numRatings", 0}}, 0, bson.M{"$divide": bson.A{"$stars", "$numRatings"}}},
+				},
+			},
+		},
+		bson.M{
+			"$sort": bson.D{
+				{Key: "avgRating", Value: -1},
+				{Key: "numRatings", Value: -1},
+				{Key: "submissionDate", Value: 1},
+				{Key: "_id", Value: 1},
+			},
+		},
+		bson.M{
+			"$limit": punCandidatePoolSize,
+		},
+	}
+
+	cur, err := s.phrases.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return Phrase{}, err
+	}
+	defer cur.Close(context.Background())
+
+	candidates := []Phrase{}
+	err = cur.All(context.Background(), &candidates)
+	if err != nil {
+		return Phrase{}, err
+	}
+
+	return choosePunOfTheDay(candidates)
+}
+
+// choosePunOfTheDay returns the highest ranked candidate: best average rating, then most ratings,
+// then oldest, then lowest PhraseID, so the same candidates always give the same pun.
+func choosePunOfTheDay(candidates []Phrase) (Phrase, error) {
+	if len(candidates) == 0 {
+		return Phrase{}, ErrNoPunOfTheDay
+	}
+
+	ranked := append([]Phrase{}, candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+
+		if averageA, averageB := AverageRating(a.PhraseRatings), AverageRating(b.PhraseRatings); averageA != averageB {
+			return averageA > averageB
+		}
+		if countA, countB := countRatings(a.PhraseRatings), countRatings(b.PhraseRatings); countA != countB {
+			return countA > countB
+		}
+		if !a.SubmissionDate.Equal(b.SubmissionDate) {
+			return a.SubmissionDate.Before(b.SubmissionDate)
+		}
+
+		return a.PhraseID.Hex() < b.PhraseID.Hex()
+	})
+
+	return ranked[0], nil
+}
+
+func countRatings(r Rating) int {
+	return r.OneStar + r.TwoStar + r.ThreeStar + r.FourStar + r.FiveStar
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newPunOfTheDaySchedulerForTest(now time.Time, location *time.Location) *PunOfTheDayScheduler {
+	scheduler := &PunOfTheDayScheduler{location: location}
+	scheduler.Now = func() time.Time { return now }
+
+	return scheduler
+}
+
+// Test that the best rated phrase wins and ties are broken the same way every time
+func TestChoosePunOfTheDay(t *testing.T) {
+	day := time.Date(2019, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+	good := Phrase{PhraseID: primitive.NewObjectID(), PhraseText: "good", PhraseRatings: Rating{FourStar: 2}, SubmissionDate: day}
+	best := Phrase{PhraseID: primitive.NewObjectID(), PhraseText: "best", PhraseRatings: Rating{FiveStar: 1}, SubmissionDate: day}
+	popular := Phrase{PhraseID: primitive.NewObjectID(), PhraseText: "popular", PhraseRatings: Rating{FiveStar: 3}, SubmissionDate: day}
+	older := Phrase{PhraseID: primitive.NewObjectID(), PhraseText: "older", PhraseRatings: Rating{FiveStar: 3}, SubmissionDate: day.Add(-time.Hour)}
+
+	expected := []struct {
+		candidates []Phrase
+		text       string
+	}{
+		{[]Phrase{good, best}, "best"},
+		{[]Phrase{best, popular}, "popular"},
+		{[]Phrase{popular, older}, "older"},
+		{[]Phrase{older, popular, good, best}, "older"},
+	}
+
+	for _, e := range expected {
+		chosen, err := choosePunOfTheDay(e.candidates)
+		if err != nil || chosen.PhraseText != e.text {
+			t.Errorf("The pun of the day should be %q. Received: %q, error: %v", e.text, chosen.PhraseText, err)
+		}
+	}
+
+	if _, err := choosePunOfTheDay(nil); err != ErrNoPunOfTheDay {
+		t.Errorf("Without candidates there should be no pun of the day. Received: %v", err)
+	}
+}
+
+func TestPunOfTheDaySchedulerToday(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone data is not available: %v", err)
+	}
+
+	now := time.Date(2019, time.December, 2, 3, 0, 0, 0, time.UTC)
+
+	if today := newPunOfTheDaySchedulerForTest(now, time.UTC).Today(); today != "2019-12-02" {
+		t.Errorf("Today in UTC should be 2019-12-02. Received: %v", today)
+	}
+	if today := newPunOfTheDaySchedulerForTest(now, newYork).Today(); today != "2019-12-01" {
+		t.Errorf("Today in New York should still be 2019-12-01. Received: %v", today)
+	}
+}
+
+func TestScheduleInPast(t *testing.T) {
+	scheduler := newPunOfTheDaySchedulerForTest(time.Date(2019, time.December, 2, 12, 0, 0, 0, time.UTC), time.UTC)
+
+	err := scheduler.Schedule("2019-12-01", Phrase{DisplayPublic: Accepted}, UserRow{ID: 1})
+	if err != ErrDayInPast {
+		t.Errorf("Past days should not be scheduled. Received: %v", err)
+	}
+
+	err = scheduler.Schedule("2019-12-03", Phrase{DisplayPublic: Rejected}, UserRow{ID: 1})
+	if err != ErrNotSchedulable {
+		t.Errorf("Rejected phrases should not be scheduled. Received: %v", err)
+	}
+
+	if err := scheduler.Unschedule("2019-12-02"); err != ErrDayInPast {
+		t.Errorf("Today's pun should not be unscheduled. Received: %v", err)
+	}
+
+	if _, err := scheduler.Get("2019-12-05"); err != ErrNoPunOfTheDay {
+		t.Errorf("Future puns should not be revealed. Received: %v", err)
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	if day, err := ParseDay("2019-12-01"); err != nil || day != "2019-12-01" {
+		t.Errorf("2019-12-01 should be a valid day. Received: %v, error: %v", day, err)
+	}
+	if _, err := ParseDay("2019-13-01"); err != ErrInvalidDay {
+		t.Errorf("2019-13-01 should not be a valid day. Received: %v", err)
+	}
+	if day := AddDays("2019-12-31", 1); day != "2020-01-01" {
+		t.Errorf("The day after 2019-12-31 should be 2020-01-01. Received: %v", day)
+	}
+}
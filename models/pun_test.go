@@ -0,0 +1,47 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Test pun generation keeps the phrase's punctuation intact
+func TestGeneratePuns(t *testing.T) {
+	homophones := []WordRow{
+		{1414, "two", 625},
+		{189, "to", 625},
+	}
+	phrases := []Phrase{
+		{PhraseText: "To live is to dream."},
+		{PhraseText: "Two's company, three's a crowd."},
+		{PhraseText: "No homophones here!"},
+	}
+
+	puns := GeneratePuns("too", homophones, phrases)
+	expected := []string{
+		"too live is too dream.",
+		"too's company, three's a crowd.",
+		"No homophones here!",
+	}
+
+	if !reflect.DeepEqual(puns, expected) {
+		t.Errorf("GeneratePuns returned %q, expected %q", puns, expected)
+	}
+}
+
+func TestRelatedPuns(t *testing.T) {
+	phrase := Phrase{PhraseText: "I knead the dough."}
+	word := WordRow{10, "knead", 7}
+	homophones := []WordRow{
+		{10, "knead", 7},
+		{11, "need", 7},
+		{12, "kneed", 7},
+	}
+
+	puns := RelatedPuns(phrase, word, homophones)
+	expected := []string{"I need the dough.", "I kneed the dough."}
+
+	if !reflect.DeepEqual(puns, expected) {
+		t.Errorf("RelatedPuns returned %q, expected %q", puns, expected)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/punocracy/punocracy/libevent"
 )
 
 var ErrPhraseNotFound = errors.New("models: no phrases with that PhraseID found in phrases collection")
@@ -82,13 +84,20 @@ func GetRatingsByUserID(user UserRow, userRatings *mongo.Collection) ([]UserRati
 //	// Query for phrases associated with those IDs
 //}
 
-// AddOrChangeRating adds or modifies a rating value given a user, phrase, and rating value
-func AddOrChangeRating(user UserRow, rating int, thePhrase Phrase, phrases *mongo.Collection, userRatings *mongo.Collection) error {
+// AddOrChangeRating adds or modifies a rating value given a user, phrase, and rating value.
+// PhraseRated is published unless the rating stayed the same.
+func AddOrChangeRating(user UserRow, rating int, thePhrase Phrase, events *libevent.Bus, phrases *mongo.Collection, userRatings *mongo.Collection) error {
 	// Attempt to change the rating, and if an ErrNoDocuments error is encountered, add it afresh
-	err := changeRating(user, rating, thePhrase, phrases, userRatings)
+	previousRating, err := changeRating(user, rating, thePhrase, phrases, userRatings)
 	if err == mongo.ErrNoDocuments {
-		return addRating(user, rating, thePhrase, phrases, userRatings)
+		previousRating = 0
+		err = addRating(user, rating, thePhrase, phrases, userRatings)
+	}
+
+	if err == nil && previousRating != rating {
+		events.Publish(PhraseRated{Phrase: thePhrase, Rater: user, Rating: rating, PreviousRating: previousRating})
 	}
+
 	return err
 }
 
@@ -123,17 +132,18 @@ func addRating(user UserRow, rating int, thePhrase Phrase, phrases *mongo.Collec
 	return err
 }
 
-// changeRating changes the rating for a user and phrase pair given a new rating value. Assumes it exists in the userRatings collection
-func changeRating(user UserRow, rating int, thePhrase Phrase, phrases *mongo.Collection, userRatings *mongo.Collection) error {
+// changeRating changes the rating for a user and phrase pair given a new rating value, returning the old one.
+// Assumes it exists in the userRatings collection
+func changeRating(user UserRow, rating int, thePhrase Phrase, phrases *mongo.Collection, userRatings *mongo.Collection) (int, error) {
 	// Get the old rating value
 	oldRating, err := getRating(user, thePhrase, userRatings)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Check if the ratings are the same and then do nothing
 	if oldRating.RatingValue == rating {
-		return nil
+		return rating, nil
 	}
 
 	// Update the userRatings entry
@@ -141,11 +151,11 @@ func changeRating(user UserRow, rating int, thePhrase Phrase, phrases *mongo.Col
 	updateDoc := bson.M{"$set": bson.M{"ratingValue": rating, "rateDate": time.Now()}}
 	_, err = userRatings.UpdateOne(context.Background(), filterDoc, updateDoc)
 	if err != nil {
-		return err
+		return oldRating.RatingValue, err
 	}
 
 	// Change rating for phrase and return the error
-	return changeRatingForPhrase(thePhrase, oldRating.RatingValue, rating, phrases)
+	return oldRating.RatingValue, changeRatingForPhrase(thePhrase, oldRating.RatingValue, rating, phrases)
 }
 
 // getRating retrieves a rating given a user and phrase
@@ -155,6 +165,16 @@ func getRating(user UserRow, thePhrase Phrase, userRatings *mongo.Collection) (U
 	return theRating, err
 }
 
+// GetRatingValue returns the stars the user rated a phrase with, or 0 if they haven't rated it
+func GetRatingValue(user UserRow, thePhrase Phrase, userRatings *mongo.Collection) (int, error) {
+	theRating, err := getRating(user, thePhrase, userRatings)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+
+	return theRating.RatingValue, err
+}
+
 // TODO: write DeleteRating function
 func DeleteRating(user UserRow, rating int, ratedPhrase Phrase, userRatings *mongo.Collection) error {
 	return nil
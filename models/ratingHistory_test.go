@@ -65,7 +65,7 @@ func TestGetRatingsByUserID(t *testing.T) {
 	}
 
 	// Add a rating from testUser
-	err = AddOrChangeRating(testUser, 5, testPhrase, phrases, userRatings)
+	err = AddOrChangeRating(testUser, 5, testPhrase, nil, phrases, userRatings)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -73,7 +73,7 @@ func TestGetRatingsByUserID(t *testing.T) {
 	// Insert second phrase
 	myWord := NewWord(mySQL)
 	text := "To live is to dream"
-	err = InsertPhrase(text, testUser, myWord, phrases)
+	_, err = InsertPhrase(text, testUser, myWord, nil, nil, phrases)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -86,7 +86,7 @@ func TestGetRatingsByUserID(t *testing.T) {
 	}
 
 	// Rate second phrase
-	err = AddOrChangeRating(testUser, 5, secondPhrase, phrases, userRatings)
+	err = AddOrChangeRating(testUser, 5, secondPhrase, nil, phrases, userRatings)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -166,7 +166,7 @@ func TestAddOrChangeRating(t *testing.T) {
 	}
 
 	// Add a rating from testUser
-	err = AddOrChangeRating(testUser, 5, testPhrase, phrases, userRatings)
+	err = AddOrChangeRating(testUser, 5, testPhrase, nil, phrases, userRatings)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -192,7 +192,7 @@ func TestAddOrChangeRating(t *testing.T) {
 	}
 
 	// Change the rating
-	err = AddOrChangeRating(testUser, 4, testPhrase, phrases, userRatings)
+	err = AddOrChangeRating(testUser, 4, testPhrase, nil, phrases, userRatings)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -207,7 +207,7 @@ func TestAddOrChangeRating(t *testing.T) {
 	}
 
 	// Change the rating to the same thing
-	err = AddOrChangeRating(testUser, 4, testPhrase, phrases, userRatings)
+	err = AddOrChangeRating(testUser, 4, testPhrase, nil, phrases, userRatings)
 	if err != nil {
 		t.Fatal(err)
 	}
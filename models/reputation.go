@@ -0,0 +1,194 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/punocracy/punocracy/libreputation"
+)
+
+// Reasons reputation points are awarded
+const (
+	// ReputationAccepted is awarded when a curator accepts a phrase, and taken back if it is rejected later
+	ReputationAccepted = "accepted"
+	// ReputationRejected is deducted when a curator rejects a phrase, and given back if it is accepted later
+	ReputationRejected = "rejected"
+	// ReputationRating is awarded, or deducted when lowered, for ratings of accepted phrases
+	ReputationRating = "rating"
+)
+
+// Statuses of an unlocked capability
+const (
+	// CapabilityPending means the user reached the threshold and waits for an administrator
+	CapabilityPending = "pending"
+	// CapabilityGranted means an administrator confirmed the capability
+	CapabilityGranted = "granted"
+	// CapabilityDenied means an administrator turned the capability down
+	CapabilityDenied = "denied"
+)
+
+var ErrCapabilityNotPending = errors.New("models: capability is not waiting for a decision")
+
+// ReputationEventRow is one entry of a user's reputation ledger
+type ReputationEventRow struct {
+	ID        int64     `db:"eventID"`
+	UserID    int64     `db:"userID"`
+	Points    int       `db:"points"`
+	Reason    string    `db:"reason"`
+	PhraseID  string    `db:"phraseID"`
+	CreatedAt time.Time `db:"createdAt"`
+}
+
+// CapabilityRow is a capability a user unlocked
+type CapabilityRow struct {
+	UserID     int64                    `db:"userID"`
+	Capability libreputation.Capability `db:"capability"`
+	Status     string                   `db:"status"`
+	UnlockedAt time.Time                `db:"unlockedAt"`
+	DecidedAt  *time.Time               `db:"decidedAt"`
+	DecidedBy  *int64                   `db:"decidedBy"`
+	// Username is only filled in by PendingCapabilities
+	Username string `db:"username"`
+}
+
+// Reputation represents the ReputationEvents_T ledger, the reputation column of Users_T and Capabilities_T
+type Reputation struct {
+	Base
+}
+
+// NewReputation creates a new Reputation
+func NewReputation(db *sqlx.DB) *Reputation {
+	reputation := &Reputation{}
+	reputation.db = db
+	reputation.table = "ReputationEvents_T"
+	reputation.hasID = true
+
+	return reputation
+}
+
+// Award records points for the user in the ledger and adds them to their reputation.
+// It returns the reputation before and after, so callers can tell which thresholds were crossed.
+func (r *Reputation) Award(tx *sqlx.Tx, userID int64, points int, reason, phraseID string) (int, int, error) {
+	tx, wrapInSingleTransaction, err := r.newTransactionIfNeeded(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var before int
+	err = tx.Get(&before, "SELECT reputation FROM Users_T WHERE userID=? FOR UPDATE", userID)
+	if err == nil {
+		query := fmt.Sprintf("INSERT INTO %v (userID, points, reason, phraseID, createdAt) VALUES (?, ?, ?, ?, ?)", r.table)
+		_, err = tx.Exec(query, userID, points, reason, phraseID, time.Now())
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE Users_T SET reputation=reputation+? WHERE userID=?", points, userID)
+	}
+
+	if wrapInSingleTransaction {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return before, before + points, nil
+}
+
+// PhrasePoints returns the net points the user was awarded for a phrase for one reason
+func (r *Reputation) PhrasePoints(tx *sqlx.Tx, userID int64, reason, phraseID string) (int, error) {
+	var points int
+	query := fmt.Sprintf("SELECT COALESCE(SUM(points), 0) FROM %v WHERE userID=? AND reason=? AND phraseID=?", r.table)
+	err := r.db.Get(&points, query, userID, reason, phraseID)
+
+	return points, err
+}
+
+// Ledger returns the user's latest reputation events, newest first
+func (r *Reputation) Ledger(tx *sqlx.Tx, userID int64, limit int) ([]ReputationEventRow, error) {
+	events := []ReputationEventRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE userID=? ORDER BY createdAt DESC, eventID DESC LIMIT ?", r.table)
+	err := r.db.Select(&events, query, userID, limit)
+
+	return events, err
+}
+
+// Unlock asks administrators to confirm a capability for the user.
+// A capability that was already unlocked keeps its status, so a denied one isn't asked for again.
+func (r *Reputation) Unlock(tx *sqlx.Tx, userID int64, capability libreputation.Capability) error {
+	_, err := r.db.Exec("INSERT IGNORE INTO Capabilities_T (userID, capability, status, unlockedAt) VALUES (?, ?, ?, ?)",
+		userID, capability, CapabilityPending, time.Now())
+
+	return err
+}
+
+// Capabilities returns the capabilities the user unlocked
+func (r *Reputation) Capabilities(tx *sqlx.Tx, userID int64) ([]CapabilityRow, error) {
+	capabilities := []CapabilityRow{}
+	err := r.db.Select(&capabilities, "SELECT Capabilities_T.*, '' AS username FROM Capabilities_T WHERE userID=? ORDER BY unlockedAt", userID)
+
+	return capabilities, err
+}
+
+// HasCapability reports whether an administrator granted the user a capability
+func (r *Reputation) HasCapability(tx *sqlx.Tx, userID int64, capability libreputation.Capability) (bool, error) {
+	var count int
+	err := r.db.Get(&count, "SELECT COUNT(*) FROM Capabilities_T WHERE userID=? AND capability=? AND status=?", userID, capability, CapabilityGranted)
+
+	return count > 0, err
+}
+
+// PendingCapabilities returns the capabilities waiting for an administrator, oldest first
+func (r *Reputation) PendingCapabilities(tx *sqlx.Tx) ([]CapabilityRow, error) {
+	capabilities := []CapabilityRow{}
+	query := `SELECT Capabilities_T.*, Users_T.username FROM Capabilities_T
+		JOIN Users_T ON Users_T.userID = Capabilities_T.userID
+		WHERE status=? ORDER BY unlockedAt`
+	err := r.db.Select(&capabilities, query, CapabilityPending)
+
+	return capabilities, err
+}
+
+// DecideCapability grants or denies a pending capability, or returns ErrCapabilityNotPending if it isn't pending.
+// Granting a curator nomination promotes a regular user to curator.
+func (r *Reputation) DecideCapability(tx *sqlx.Tx, userID int64, capability libreputation.Capability, granted bool, admin UserRow) error {
+	tx, wrapInSingleTransaction, err := r.newTransactionIfNeeded(tx)
+	if err != nil {
+		return err
+	}
+
+	status := CapabilityDenied
+	if granted {
+		status = CapabilityGranted
+	}
+
+	result, err := tx.Exec("UPDATE Capabilities_T SET status=?, decidedAt=?, decidedBy=? WHERE userID=? AND capability=? AND status=?",
+		status, time.Now(), admin.ID, userID, capability, CapabilityPending)
+	if err == nil {
+		// Already decided or never unlocked
+		var affected int64
+		affected, err = result.RowsAffected()
+		if err == nil && affected != 1 {
+			err = ErrCapabilityNotPending
+		}
+	}
+	if err == nil && granted && capability == libreputation.CuratorNomination {
+		_, err = tx.Exec("UPDATE Users_T SET permLevel=? WHERE userID=? AND permLevel=?", Curator, userID, RegularUser)
+	}
+
+	if wrapInSingleTransaction {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}
+
+	return err
+}
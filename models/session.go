@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/punocracy/punocracy/libsession"
+)
+
+// SessionRow is a login session stored in Sessions_T
+type SessionRow struct {
+	ID         string    `db:"sessionID"`
+	UserID     int64     `db:"userID"`
+	Data       []byte    `db:"data"`
+	UserAgent  string    `db:"userAgent"`
+	IPAddress  string    `db:"ipAddress"`
+	CreatedAt  time.Time `db:"createdAt"`
+	LastSeenAt time.Time `db:"lastSeenAt"`
+	ExpiresAt  time.Time `db:"expiresAt"`
+}
+
+func (s *SessionRow) record() *libsession.Record {
+	return &libsession.Record{
+		ID:         s.ID,
+		UserID:     s.UserID,
+		Data:       s.Data,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IPAddress,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+	}
+}
+
+// Session represents the Sessions_T table. It implements libsession.Backend.
+type Session struct {
+	Base
+}
+
+// NewSession creates a new Session
+func NewSession(db *sqlx.DB) *Session {
+	session := &Session{}
+	session.db = db
+	session.table = "Sessions_T"
+	session.hasID = false
+
+	return session
+}
+
+// Load returns the session with the given id
+func (s *Session) Load(id string) (*libsession.Record, error) {
+	row := &SessionRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE sessionID=?", s.table)
+	err := s.db.Get(row, query, id)
+	if err == sql.ErrNoRows {
+		return nil, libsession.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return row.record(), nil
+}
+
+// Save creates or replaces a session, keeping the creation time of an existing one
+func (s *Session) Save(record *libsession.Record) error {
+	query := fmt.Sprintf(`INSERT INTO %v (sessionID, userID, data, userAgent, ipAddress, createdAt, lastSeenAt, expiresAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE userID=VALUES(userID), data=VALUES(data), userAgent=VALUES(userAgent),
+		ipAddress=VALUES(ipAddress), lastSeenAt=VALUES(lastSeenAt), expiresAt=VALUES(expiresAt)`, s.table)
+
+	_, err := s.db.Exec(query, record.ID, record.UserID, record.Data, truncate(record.UserAgent, 255), record.IPAddress,
+		record.CreatedAt, record.LastSeenAt, record.ExpiresAt)
+	return err
+}
+
+// Touch records activity on a session and extends its expiry
+func (s *Session) Touch(id string, lastSeenAt, expiresAt time.Time) error {
+	query := fmt.Sprintf("UPDATE %v SET lastSeenAt=?, expiresAt=? WHERE sessionID=?", s.table)
+	_, err := s.db.Exec(query, lastSeenAt, expiresAt, id)
+	return err
+}
+
+// Delete removes a session, logging it out
+func (s *Session) Delete(id string) error {
+	query := fmt.Sprintf("DELETE FROM %v WHERE sessionID=?", s.table)
+	_, err := s.db.Exec(query, id)
+	return err
+}
+
+// DeleteByUser removes every session of a user, logging them out everywhere
+func (s *Session) DeleteByUser(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM %v WHERE userID=?", s.table)
+	_, err := s.db.Exec(query, userID)
+	return err
+}
+
+// ListByUser returns the sessions of a user, most recently active first
+func (s *Session) ListByUser(userID int64) ([]*libsession.Record, error) {
+	rows := []SessionRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE userID=? AND expiresAt>? ORDER BY lastSeenAt DESC", s.table)
+	err := s.db.Select(&rows, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*libsession.Record, len(rows))
+	for i := range rows {
+		records[i] = rows[i].record()
+	}
+
+	return records, nil
+}
+
+// DeleteExpired removes sessions that expired before now
+func (s *Session) DeleteExpired(now time.Time) error {
+	query := fmt.Sprintf("DELETE FROM %v WHERE expiresAt<=?", s.table)
+	_, err := s.db.Exec(query, now)
+	return err
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+
+	return string(runes[:length])
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TwoFactorRow is a user's TOTP enrollment
+type TwoFactorRow struct {
+	UserID int64  `db:"userID"`
+	Secret string `db:"secret"`
+	// LastCounter is the last time step a code was accepted for, so codes can't be replayed
+	LastCounter int64     `db:"lastCounter"`
+	EnabledAt   time.Time `db:"enabledAt"`
+}
+
+// TwoFactor represents the TwoFactor_T and RecoveryCodes_T tables
+type TwoFactor struct {
+	Base
+}
+
+// NewTwoFactor creates a new TwoFactor
+func NewTwoFactor(db *sqlx.DB) *TwoFactor {
+	twoFactor := &TwoFactor{}
+	twoFactor.db = db
+	twoFactor.table = "TwoFactor_T"
+	twoFactor.hasID = false
+
+	return twoFactor
+}
+
+// Get returns the user's enrollment, or sql.ErrNoRows if they haven't enabled 2FA
+func (t *TwoFactor) Get(tx *sqlx.Tx, userID int64) (*TwoFactorRow, error) {
+	row := &TwoFactorRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE userID=?", t.table)
+	err := t.db.Get(row, query, userID)
+
+	return row, err
+}
+
+// IsEnabled reports whether the user has enabled 2FA
+func (t *TwoFactor) IsEnabled(tx *sqlx.Tx, userID int64) (bool, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE userID=?", t.table)
+	err := t.db.Get(&count, query, userID)
+
+	return count > 0, err
+}
+
+// Enable stores the user's secret and replaces their recovery codes with the given hashes.
+// counter is the time step of the code that confirmed the enrollment.
+func (t *TwoFactor) Enable(tx *sqlx.Tx, userID int64, secret string, counter int64, recoveryCodeHashes []string) error {
+	query := fmt.Sprintf("REPLACE INTO %v (userID, secret, lastCounter, enabledAt) VALUES (?, ?, ?, ?)", t.table)
+	_, err := t.db.Exec(query, userID, secret, counter, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return t.ReplaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+}
+
+// Disable removes the user's secret and recovery codes
+func (t *TwoFactor) Disable(tx *sqlx.Tx, userID int64) error {
+	_, err := t.db.Exec("DELETE FROM RecoveryCodes_T WHERE userID=?", userID)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("DELETE FROM %v WHERE userID=?", t.table)
+	_, err = t.db.Exec(query, userID)
+
+	return err
+}
+
+// UseCounter accepts a code's time step unless it or a later one was already used
+func (t *TwoFactor) UseCounter(tx *sqlx.Tx, userID, counter int64) (bool, error) {
+	query := fmt.Sprintf("UPDATE %v SET lastCounter=? WHERE userID=? AND lastCounter<?", t.table)
+	result, err := t.db.Exec(query, counter, userID, counter)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// ReplaceRecoveryCodes invalidates the user's recovery codes and stores new ones
+func (t *TwoFactor) ReplaceRecoveryCodes(tx *sqlx.Tx, userID int64, codeHashes []string) error {
+	_, err := t.db.Exec("DELETE FROM RecoveryCodes_T WHERE userID=?", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = t.db.Exec("INSERT INTO RecoveryCodes_T (userID, codeHash) VALUES (?, ?)", userID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used, reporting whether there was one
+func (t *TwoFactor) UseRecoveryCode(tx *sqlx.Tx, userID int64, codeHash string) (bool, error) {
+	result, err := t.db.Exec("UPDATE RecoveryCodes_T SET usedAt=? WHERE userID=? AND codeHash=? AND usedAt IS NULL", time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left
+func (t *TwoFactor) CountRecoveryCodes(tx *sqlx.Tx, userID int64) (int, error) {
+	var count int
+	err := t.db.Get(&count, "SELECT COUNT(*) FROM RecoveryCodes_T WHERE userID=? AND usedAt IS NULL", userID)
+
+	return count, err
+}
@@ -6,10 +6,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/jmoiron/sqlx"
-	"golang.org/x/crypto/bcrypt"
+
+	"github.com/punocracy/punocracy/libevent"
+	"github.com/punocracy/punocracy/libpassword"
 )
 
 // NewUser creates a new user
@@ -42,6 +47,31 @@ type UserRow struct {
 	Email        string          `db:"email"`
 	PasswordHash string          `db:"passwordHash"`
 	PermLevel    PermissionLevel `db:"permLevel"`
+	// EmailVerified is set once the user followed the link in the verification email
+	EmailVerified bool `db:"emailVerified"`
+	// DisplayName and Bio are shown on the public profile page
+	DisplayName string    `db:"displayName"`
+	Bio         string    `db:"bio"`
+	CreatedAt   time.Time `db:"createdAt"`
+	// Reputation is the sum of the user's reputation ledger
+	Reputation int `db:"reputation"`
+}
+
+// noPasswordHash is stored for users who signed up through an identity provider and never set a password
+const noPasswordHash = "!"
+
+// HasPassword reports whether the user can log in with a password.
+func (u UserRow) HasPassword() bool {
+	return u.PasswordHash != "" && u.PasswordHash != noPasswordHash
+}
+
+// Name returns the display name, or the username if none was chosen.
+func (u UserRow) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+
+	return u.Username
 }
 
 type User struct {
@@ -67,6 +97,15 @@ func (u *User) AllUsers(tx *sqlx.Tx) ([]*UserRow, error) {
 	return users, err
 }
 
+// GetCurators returns the curators and administrators.
+func (u *User) GetCurators(tx *sqlx.Tx) ([]*UserRow, error) {
+	users := []*UserRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE permLevel<=?", u.table)
+	err := u.db.Select(&users, query, Curator)
+
+	return users, err
+}
+
 // GetByID returns record by id.
 func (u *User) GetByID(tx *sqlx.Tx, id int64) (*UserRow, error) {
 	user := &UserRow{}
@@ -95,36 +134,63 @@ func (u *User) GetByUsername(tx *sqlx.Tx, username string) (*UserRow, error) {
 }
 
 // GetUserByUsernameAndPassword returns record by email but checks password first.
-func (u *User) GetUserByUsernameAndPassword(tx *sqlx.Tx, username, password string) (*UserRow, error) {
+// If the stored hash uses an outdated algorithm or cost it is replaced with a fresh one from hasher.
+func (u *User) GetUserByUsernameAndPassword(tx *sqlx.Tx, username, password string, hasher *libpassword.Hasher) (*UserRow, error) {
 	user, err := u.GetByUsername(tx, username)
 	if err != nil {
 		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	err = hasher.Verify(user.PasswordHash, password)
 	if err != nil {
 		return nil, err
 	}
 
-	return user, err
+	if hasher.NeedsRehash(user.PasswordHash) {
+		err = u.setPasswordHash(tx, user, password, hasher)
+		if err != nil {
+			// The login itself succeeded, the old hash keeps working until the next attempt
+			logrus.Errorln(err)
+		}
+	}
+
+	return user, nil
+}
+
+func (u *User) setPasswordHash(tx *sqlx.Tx, user *UserRow, password string, hasher *libpassword.Hasher) error {
+	hashedPassword, err := hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]interface{})
+	data["passwordHash"] = hashedPassword
+
+	_, err = u.UpdateByID(tx, data, user.ID)
+	if err != nil {
+		return err
+	}
+
+	user.PasswordHash = hashedPassword
+	return nil
 }
 
 // Signup create a new record of user.
-func (u *User) Signup(tx *sqlx.Tx, username, email, password, passwordAgain string) (*UserRow, error) {
+func (u *User) Signup(tx *sqlx.Tx, username, email, password, passwordAgain string, policy *libpassword.Policy, hasher *libpassword.Hasher, events *libevent.Bus) (*UserRow, error) {
 	if username == "" {
 		return nil, errors.New("username cannot be blank")
 	}
 	if email == "" {
 		return nil, errors.New("email cannot be blank")
 	}
-	if password == "" {
-		return nil, errors.New("password cannot be blank")
+	if err := policy.Check(password); err != nil {
+		return nil, err
 	}
 	if password != passwordAgain {
 		return nil, errors.New("password is invalid")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 5)
+	hashedPassword, err := hasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
@@ -135,16 +201,62 @@ func (u *User) Signup(tx *sqlx.Tx, username, email, password, passwordAgain stri
 	data["passwordHash"] = hashedPassword
 	data["permLevel"] = RegularUser
 
+	return u.insertSignup(tx, data, events)
+}
+
+// SignupExternal creates a user who logs in through an external identity provider.
+// The account has no usable password until the user resets it by email.
+func (u *User) SignupExternal(tx *sqlx.Tx, username, email string, emailVerified bool, events *libevent.Bus) (*UserRow, error) {
+	if username == "" {
+		return nil, errors.New("username cannot be blank")
+	}
+
+	data := make(map[string]interface{})
+	data["username"] = username
+	data["email"] = email
+	data["passwordHash"] = noPasswordHash
+	data["permLevel"] = RegularUser
+	data["emailVerified"] = emailVerified
+
+	return u.insertSignup(tx, data, events)
+}
+
+// insertSignup creates the user and publishes UserSignedUp
+func (u *User) insertSignup(tx *sqlx.Tx, data map[string]interface{}, events *libevent.Bus) (*UserRow, error) {
 	sqlResult, err := u.InsertIntoTable(tx, data)
 	if err != nil {
 		return nil, err
 	}
 
-	return u.userRowFromSQLResult(tx, sqlResult)
+	user, err := u.userRowFromSQLResult(tx, sqlResult)
+	if err != nil {
+		return nil, err
+	}
+
+	events.Publish(UserSignedUp{User: *user})
+
+	return user, nil
+}
+
+// UniqueUsername returns base, or base followed by a number if base is taken.
+func (u *User) UniqueUsername(tx *sqlx.Tx, base string) (string, error) {
+	candidate := base
+	for suffix := 2; ; suffix++ {
+		_, err := u.GetByUsername(tx, candidate)
+		if err == sql.ErrNoRows {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		candidate = fmt.Sprintf("%v%v", base, suffix)
+	}
 }
 
 // UpdateUsernameAndPasswordByID updates user email and password.
-func (u *User) UpdateUsernameAndPasswordByID(tx *sqlx.Tx, userID int64, username, password, passwordAgain string) (*UserRow, error) {
+// The password is only changed if both are given, match and satisfy the policy.
+func (u *User) UpdateUsernameAndPasswordByID(tx *sqlx.Tx, userID int64, username, password, passwordAgain string, policy *libpassword.Policy, hasher *libpassword.Hasher) (*UserRow, error) {
 	data := make(map[string]interface{})
 
 	if username != "" {
@@ -152,7 +264,11 @@ func (u *User) UpdateUsernameAndPasswordByID(tx *sqlx.Tx, userID int64, username
 	}
 
 	if password != "" && passwordAgain != "" && password == passwordAgain {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 5)
+		if err := policy.Check(password); err != nil {
+			return nil, err
+		}
+
+		hashedPassword, err := hasher.Hash(password)
 		if err != nil {
 			return nil, err
 		}
@@ -170,6 +286,64 @@ func (u *User) UpdateUsernameAndPasswordByID(tx *sqlx.Tx, userID int64, username
 	return u.GetByID(tx, userID)
 }
 
+// ResetPassword sets a new password for a user who proved they own the account some other way.
+func (u *User) ResetPassword(tx *sqlx.Tx, userID int64, password, passwordAgain string, policy *libpassword.Policy, hasher *libpassword.Hasher) (*UserRow, error) {
+	if err := policy.Check(password); err != nil {
+		return nil, err
+	}
+	if password != passwordAgain {
+		return nil, errors.New("password is invalid")
+	}
+
+	return u.UpdateUsernameAndPasswordByID(tx, userID, "", password, passwordAgain, policy, hasher)
+}
+
+// MarkEmailVerified records that the user confirmed their email address.
+func (u *User) MarkEmailVerified(tx *sqlx.Tx, userID int64) (*UserRow, error) {
+	data := make(map[string]interface{})
+	data["emailVerified"] = true
+
+	_, err := u.UpdateByID(tx, data, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.GetByID(tx, userID)
+}
+
+// Limits for the profile fields, matching their columns in Users_T
+const (
+	MaxDisplayNameLength = 64
+	MaxBioLength         = 500
+)
+
+var ErrDisplayNameTooLong = errors.New("models: display name is longer than 64 characters")
+var ErrBioTooLong = errors.New("models: bio is longer than 500 characters")
+
+// UpdateProfile sets the display name and bio shown on the user's profile page.
+func (u *User) UpdateProfile(tx *sqlx.Tx, userID int64, displayName, bio string) (*UserRow, error) {
+	displayName = strings.TrimSpace(displayName)
+	bio = strings.TrimSpace(bio)
+
+	if utf8.RuneCountInString(displayName) > MaxDisplayNameLength {
+		return nil, ErrDisplayNameTooLong
+	}
+	if utf8.RuneCountInString(bio) > MaxBioLength {
+		return nil, ErrBioTooLong
+	}
+
+	data := make(map[string]interface{})
+	data["displayName"] = displayName
+	data["bio"] = bio
+
+	_, err := u.UpdateByID(tx, data, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.GetByID(tx, userID)
+}
+
 /*
    Delete user from SQL user table
    Given a user row, delete user
@@ -0,0 +1,129 @@
+// Public statistics about a user's submissions
+
+package models
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserStats summarizes the phrases a user submitted
+type UserStats struct {
+	Submitted int64 `bson:"submitted" json:"submitted"`
+	Accepted  int64 `bson:"accepted" json:"accepted"`
+	Rejected  int64 `bson:"rejected" json:"rejected"`
+	Pending   int64 `bson:"pending" json:"pending"`
+	// Stars is the sum of all ratings received on accepted phrases, e.g. a 4 star rating counts 4
+	Stars      int64 `bson:"stars" json:"stars"`
+	NumRatings int64 `bson:"numRatings" json:"numRatings"`
+	// Computed from the counts above by finish
+	AverageRating  float64 `bson:"-" json:"averageRating"`
+	AcceptanceRate float64 `bson:"-" json:"acceptanceRate"`
+}
+
+// finish computes the average rating and the share of reviewed phrases that were accepted.
+func (s *UserStats) finish() {
+	s.AverageRating = 0
+	if s.NumRatings > 0 {
+		s.AverageRating = float64(s.Stars) / float64(s.NumRatings)
+	}
+
+	s.AcceptanceRate = 0
+	if reviewed := s.Accepted + s.Rejected; reviewed > 0 {
+		s.AcceptanceRate = float64(s.Accepted) / float64(reviewed)
+	}
+}
+
+// Number of ratings a phrase received, as an aggregation expression
+var numRatingsExpression = bson.M{
+	"$sum": bson.A{"$ratings.one", "$ratings.two", "$ratings.three", "$ratings.four", "$ratings.five"},
+}
+
+// Stars a phrase received, as an aggregation expression
+var starsExpression = bson.M{
+	"$sum": bson.A{
+		"$ratings.one",
+		bson.M{"$multiply": bson.A{"$ratings.two", 2}},
+		bson.M{"$multiply": bson.A{"$ratings.three", 3}},
+		bson.M{"$multiply": bson.A{"$ratings.four", 4}},
+		bson.M{"$multiply": bson.A{"$ratings.five", 5}},
+	},
+}
+
+// countIf returns an aggregation expression that is value when the phrase has one of the display values, otherwise 0
+func countIf(value interface{}, displayValues ...DisplayValue) bson.M {
+	return bson.M{"$cond": bson.A{bson.M{"$in": bson.A{"$displayValue", displayValues}}, value, 0}}
+}
+
+// GetUserStats computes the submission statistics of a user in a single aggregation
+func GetUserStats(user UserRow, phrasesCollection *mongo.Collection) (UserStats, error) {
+	pipeline := bson.A{
+		bson.M{
+			"$match": bson.M{"submitterUserID": user.ID},
+		},
+		bson.M{
+			"$group": bson.M{
+				"_id":        nil,
+				"submitted":  bson.M{"$sum": 1},
+				"accepted":   bson.M{"$sum": countIf(1, Accepted)},
+				"rejected":   bson.M{"$sum": countIf(1, Rejected)},
+				"pending":    bson.M{"$sum": countIf(1, Unreviewed, InReview)},
+				"stars":      bson.M{"$sum": countIf(starsExpression, Accepted)},
+				"numRatings": bson.M{"$sum": countIf(numRatingsExpression, Accepted)},
+			},
+		},
+	}
+
+	var stats UserStats
+
+	cur, err := phrasesCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return stats, err
+	}
+	defer cur.Close(context.Background())
+
+	// No documents means the user hasn't submitted anything yet
+	if cur.Next(context.Background()) {
+		err = cur.Decode(&stats)
+		if err != nil {
+			return stats, err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return stats, err
+	}
+
+	stats.finish()
+	return stats, nil
+}
+
+// GetAcceptedPhrasesByUser returns the user's accepted phrases, newest first
+func GetAcceptedPhrasesByUser(user UserRow, limit int64, phrasesCollection *mongo.Collection) ([]Phrase, error) {
+	filter := bson.M{"submitterUserID": user.ID, "displayValue": Accepted}
+	findOptions := options.Find().SetSort(bson.M{"submissionDate": -1}).SetLimit(limit)
+
+	cur, err := phrasesCollection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	phraseList := []Phrase{}
+	for cur.Next(context.Background()) {
+		var onePhrase Phrase
+		err = cur.Decode(&onePhrase)
+		if err != nil {
+			return nil, err
+		}
+		phraseList = append(phraseList, onePhrase)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return phraseList, nil
+}
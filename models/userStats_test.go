@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+)
+
+// Test the rates derived from the aggregated counts
+func TestUserStatsFinish(t *testing.T) {
+	stats := UserStats{Submitted: 6, Accepted: 3, Rejected: 1, Pending: 2, Stars: 14, NumRatings: 4}
+	stats.finish()
+
+	if stats.AverageRating != 3.5 {
+		t.Errorf("Average rating should be 3.5. Received: %v", stats.AverageRating)
+	}
+	if stats.AcceptanceRate != 0.75 {
+		t.Errorf("Acceptance rate should be 0.75. Received: %v", stats.AcceptanceRate)
+	}
+
+	empty := UserStats{}
+	empty.finish()
+
+	if empty.AverageRating != 0 || empty.AcceptanceRate != 0 {
+		t.Errorf("Rates without ratings or reviews should be 0. Received: %v, %v", empty.AverageRating, empty.AcceptanceRate)
+	}
+}
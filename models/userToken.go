@@ -0,0 +1,107 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/punocracy/punocracy/libtoken"
+)
+
+// Purposes a user token can be issued for
+const (
+	// TokenVerifyEmail confirms the user owns their email address
+	TokenVerifyEmail = "verify-email"
+	// TokenPasswordReset lets the user choose a new password
+	TokenPasswordReset = "password-reset"
+)
+
+// ErrTokenUsed is returned when a token was already used or was never issued.
+var ErrTokenUsed = errors.New("models: token was already used")
+
+// UserTokenRow tracks an issued token so it can only be used once
+type UserTokenRow struct {
+	Nonce     string     `db:"nonce"`
+	UserID    int64      `db:"userID"`
+	Purpose   string     `db:"purpose"`
+	ExpiresAt time.Time  `db:"expiresAt"`
+	UsedAt    *time.Time `db:"usedAt"`
+}
+
+// UserToken represents the UserTokens_T table
+type UserToken struct {
+	Base
+}
+
+// NewUserToken creates a new UserToken
+func NewUserToken(db *sqlx.DB) *UserToken {
+	token := &UserToken{}
+	token.db = db
+	token.table = "UserTokens_T"
+	token.hasID = false
+
+	return token
+}
+
+// Issue creates a signed token for userID that expires after ttl and records it as unused
+func (t *UserToken) Issue(tx *sqlx.Tx, secret []byte, userID int64, purpose string, ttl time.Duration) (string, error) {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", err
+	}
+
+	claims := libtoken.Claims{
+		Purpose: purpose,
+		Subject: userID,
+		Expires: time.Now().Add(ttl),
+		Nonce:   hex.EncodeToString(nonceBytes),
+	}
+
+	data := make(map[string]interface{})
+	data["nonce"] = claims.Nonce
+	data["userID"] = userID
+	data["purpose"] = purpose
+	data["expiresAt"] = claims.Expires
+
+	_, err := t.InsertIntoTable(tx, data)
+	if err != nil {
+		return "", err
+	}
+
+	return libtoken.Sign(secret, claims), nil
+}
+
+// Consume verifies a token and marks it used, returning the user it was issued to.
+// Every other unused token the user holds for the same purpose is invalidated as well.
+func (t *UserToken) Consume(tx *sqlx.Tx, secret []byte, purpose, token string) (int64, error) {
+	claims, err := libtoken.Verify(secret, purpose, token, time.Now())
+	if err != nil {
+		return -1, err
+	}
+
+	query := fmt.Sprintf("UPDATE %v SET usedAt=? WHERE nonce=? AND userID=? AND purpose=? AND usedAt IS NULL", t.table)
+	result, err := t.db.Exec(query, time.Now(), claims.Nonce, claims.Subject, purpose)
+	if err != nil {
+		return -1, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+	if affected != 1 {
+		return -1, ErrTokenUsed
+	}
+
+	query = fmt.Sprintf("UPDATE %v SET usedAt=? WHERE userID=? AND purpose=? AND usedAt IS NULL", t.table)
+	_, err = t.db.Exec(query, time.Now(), claims.Subject, purpose)
+	if err != nil {
+		return -1, err
+	}
+
+	return claims.Subject, nil
+}
@@ -26,7 +26,7 @@ func TestUserCRUD(t *testing.T) {
 	u := newUserForTest(t)
 
 	// Signup
-	userRow, err := u.Signup(nil, newEmailForTest(), "abc123", "abc123")
+	userRow, err := u.Signup(nil, newEmailForTest(), "abc123", "abc123", nil, nil)
 	if err != nil {
 		t.Errorf("Signing up user should work. Error: %v", err)
 	}
@@ -45,3 +45,29 @@ func TestUserCRUD(t *testing.T) {
 
 }
 */
+
+// Test that the display name falls back to the username
+func TestUserRowName(t *testing.T) {
+	user := UserRow{Username: "punster"}
+	if name := user.Name(); name != "punster" {
+		t.Errorf("Name should fall back to the username. Received: %v", name)
+	}
+
+	user.DisplayName = "The Punster"
+	if name := user.Name(); name != "The Punster" {
+		t.Errorf("Name should be the display name. Received: %v", name)
+	}
+}
+
+// Test that accounts created through an identity provider have no password
+func TestUserRowHasPassword(t *testing.T) {
+	user := UserRow{PasswordHash: noPasswordHash}
+	if user.HasPassword() {
+		t.Errorf("Users who signed up externally should have no password")
+	}
+
+	user.PasswordHash = "$2a$10$abcdefghijklmnopqrstuv"
+	if !user.HasPassword() {
+		t.Errorf("Users with a password hash should have a password")
+	}
+}
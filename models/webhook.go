@@ -0,0 +1,302 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/punocracy/punocracy/libwebhook"
+)
+
+// Events webhooks can subscribe to
+const (
+	WebhookPhraseSubmitted = "phrase.submitted"
+	WebhookPhraseAccepted  = "phrase.accepted"
+	WebhookPhraseRejected  = "phrase.rejected"
+	WebhookPhraseRated     = "phrase.rated"
+	WebhookUserSignedUp    = "user.signed_up"
+)
+
+// WebhookEvents lists every event in the order they are shown to administrators
+var WebhookEvents = []string{WebhookPhraseSubmitted, WebhookPhraseAccepted, WebhookPhraseRejected, WebhookPhraseRated, WebhookUserSignedUp}
+
+// Statuses of a webhook delivery
+const (
+	// DeliveryPending means the delivery waits for its first attempt or a retry
+	DeliveryPending = "pending"
+	// DeliveryDelivered means the receiver answered with a 2xx status
+	DeliveryDelivered = "delivered"
+	// DeliveryFailed means every attempt failed and the delivery was given up
+	DeliveryFailed = "failed"
+)
+
+var ErrInvalidWebhookURL = errors.New("models: webhook URLs must be absolute http or https URLs")
+var ErrPrivateWebhookHost = errors.New("models: webhooks can't be sent to loopback or private hosts")
+var ErrNoWebhookEvents = errors.New("models: webhooks must subscribe to at least one event")
+var ErrUnknownWebhookEvent = errors.New("models: unknown webhook event")
+var ErrWebhookDeliveryNotFound = errors.New("models: webhook delivery not found")
+
+// WebhookRow is a URL that receives events
+type WebhookRow struct {
+	ID     int64  `db:"webhookID"`
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+	// Events is a comma separated list
+	Events    string    `db:"events"`
+	Active    bool      `db:"active"`
+	CreatedBy *int64    `db:"createdBy"`
+	CreatedAt time.Time `db:"createdAt"`
+}
+
+// EventList returns the events the webhook subscribed to
+func (w WebhookRow) EventList() []string {
+	return strings.Split(w.Events, ",")
+}
+
+// WebhookDeliveryRow is an event waiting for, or done with, delivery to one webhook
+type WebhookDeliveryRow struct {
+	ID             int64      `db:"deliveryID"`
+	WebhookID      int64      `db:"webhookID"`
+	Event          string     `db:"event"`
+	Payload        string     `db:"payload"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	NextAttemptAt  time.Time  `db:"nextAttemptAt"`
+	LastAttemptAt  *time.Time `db:"lastAttemptAt"`
+	ResponseStatus int        `db:"responseStatus"`
+	LastError      string     `db:"lastError"`
+	CreatedAt      time.Time  `db:"createdAt"`
+	// URL and Secret are only filled in by DueDeliveries
+	URL    string `db:"url"`
+	Secret string `db:"secret"`
+}
+
+// Webhook represents the Webhooks_T table and its outbox, WebhookDeliveries_T
+type Webhook struct {
+	Base
+}
+
+// NewWebhook creates a new Webhook
+func NewWebhook(db *sqlx.DB) *Webhook {
+	webhook := &Webhook{}
+	webhook.db = db
+	webhook.table = "Webhooks_T"
+	webhook.hasID = true
+
+	return webhook
+}
+
+// ParseWebhookURL checks that a webhook URL can be posted to.
+// Hosts on the server's own network are refused; names that resolve to them are refused when delivering.
+func ParseWebhookURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(rawURL) > 2000 {
+		return "", ErrInvalidWebhookURL
+	}
+	if libwebhook.IsPrivateHost(parsed.Hostname()) {
+		return "", ErrPrivateWebhookHost
+	}
+
+	return rawURL, nil
+}
+
+// ParseWebhookEvents checks a list of events and returns it in the order of WebhookEvents, without duplicates
+func ParseWebhookEvents(events []string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, event := range events {
+		known := false
+		for _, webhookEvent := range WebhookEvents {
+			known = known || event == webhookEvent
+		}
+		if !known {
+			return nil, ErrUnknownWebhookEvent
+		}
+		selected[event] = true
+	}
+
+	parsed := []string{}
+	for _, event := range WebhookEvents {
+		if selected[event] {
+			parsed = append(parsed, event)
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, ErrNoWebhookEvents
+	}
+
+	return parsed, nil
+}
+
+// Create registers a webhook with a new random secret
+func (w *Webhook) Create(tx *sqlx.Tx, rawURL string, events []string, admin UserRow) (*WebhookRow, error) {
+	webhookURL, err := ParseWebhookURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err = ParseWebhookEvents(events)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{})
+	data["url"] = webhookURL
+	data["secret"] = hex.EncodeToString(secret)
+	data["events"] = strings.Join(events, ",")
+	data["active"] = true
+	data["createdBy"] = admin.ID
+	data["createdAt"] = time.Now()
+
+	result, err := w.InsertIntoTable(tx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return w.GetByID(tx, id)
+}
+
+// GetByID returns a webhook
+func (w *Webhook) GetByID(tx *sqlx.Tx, id int64) (*WebhookRow, error) {
+	webhook := &WebhookRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE webhookID=?", w.table)
+	err := w.db.Get(webhook, query, id)
+
+	return webhook, err
+}
+
+// All returns every webhook, oldest first
+func (w *Webhook) All(tx *sqlx.Tx) ([]WebhookRow, error) {
+	webhooks := []WebhookRow{}
+	query := fmt.Sprintf("SELECT * FROM %v ORDER BY webhookID", w.table)
+	err := w.db.Select(&webhooks, query)
+
+	return webhooks, err
+}
+
+// SetActive pauses or resumes a webhook. Paused webhooks get no new deliveries and pending ones wait.
+func (w *Webhook) SetActive(tx *sqlx.Tx, id int64, active bool) error {
+	data := make(map[string]interface{})
+	data["active"] = active
+
+	_, err := w.UpdateByID(tx, data, id)
+	return err
+}
+
+// Delete removes a webhook along with its deliveries
+func (w *Webhook) Delete(tx *sqlx.Tx, id int64) error {
+	_, err := w.DeleteById(tx, id)
+	return err
+}
+
+// Enqueue adds a delivery of the event to the outbox of every active webhook subscribed to it
+func (w *Webhook) Enqueue(tx *sqlx.Tx, event string, data interface{}) error {
+	now := time.Now()
+
+	payload, err := libwebhook.Encode(event, data, now)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO WebhookDeliveries_T (webhookID, event, payload, status, attempts, nextAttemptAt, createdAt)
+		SELECT webhookID, ?, ?, ?, 0, ?, ? FROM %v WHERE active AND FIND_IN_SET(?, events)`, w.table)
+	_, err = w.db.Exec(query, event, string(payload), DeliveryPending, now, now, event)
+
+	return err
+}
+
+// DueDeliveries returns pending deliveries of active webhooks whose next attempt is due, oldest first
+func (w *Webhook) DueDeliveries(tx *sqlx.Tx, now time.Time, limit int) ([]WebhookDeliveryRow, error) {
+	deliveries := []WebhookDeliveryRow{}
+	query := fmt.Sprintf(`SELECT WebhookDeliveries_T.*, %v.url, %v.secret FROM WebhookDeliveries_T
+		JOIN %v ON %v.webhookID = WebhookDeliveries_T.webhookID
+		WHERE status=? AND nextAttemptAt<=? AND active
+		ORDER BY nextAttemptAt, deliveryID LIMIT ?`, w.table, w.table, w.table, w.table)
+	err := w.db.Select(&deliveries, query, DeliveryPending, now, limit)
+
+	return deliveries, err
+}
+
+// ClaimDelivery takes a delivery that was due at now for one attempt, postponing it until lease passes in case the attempt never finishes.
+// now must be the time DueDeliveries was called with. It returns false if another worker got there first.
+func (w *Webhook) ClaimDelivery(tx *sqlx.Tx, delivery WebhookDeliveryRow, now time.Time, lease time.Duration) (bool, error) {
+	// A delivery another worker claimed is no longer due, as its claim moved nextAttemptAt past now
+	result, err := w.db.Exec("UPDATE WebhookDeliveries_T SET nextAttemptAt=? WHERE deliveryID=? AND status=? AND attempts=? AND nextAttemptAt<=?",
+		time.Now().Add(lease), delivery.ID, DeliveryPending, delivery.Attempts, now)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := result.RowsAffected()
+	return claimed > 0, err
+}
+
+// RecordAttempt stores the outcome of an attempt in the delivery log and schedules the retry, if any
+func (w *Webhook) RecordAttempt(tx *sqlx.Tx, delivery WebhookDeliveryRow, attempt libwebhook.Attempt) error {
+	status := DeliveryPending
+	nextAttemptAt := attempt.NextAttempt
+	lastError := ""
+
+	if attempt.Delivered() {
+		status = DeliveryDelivered
+		nextAttemptAt = attempt.At
+	} else {
+		lastError = truncate(attempt.Err.Error(), 255)
+		if attempt.GaveUp {
+			status = DeliveryFailed
+			nextAttemptAt = attempt.At
+		}
+	}
+
+	_, err := w.db.Exec(`UPDATE WebhookDeliveries_T SET status=?, attempts=attempts+1, nextAttemptAt=?, lastAttemptAt=?,
+		responseStatus=?, lastError=? WHERE deliveryID=?`,
+		status, nextAttemptAt, attempt.At, attempt.StatusCode, lastError, delivery.ID)
+
+	return err
+}
+
+// Deliveries returns the latest deliveries of a webhook, newest first
+func (w *Webhook) Deliveries(tx *sqlx.Tx, webhookID int64, limit int) ([]WebhookDeliveryRow, error) {
+	deliveries := []WebhookDeliveryRow{}
+	query := `SELECT WebhookDeliveries_T.*, '' AS url, '' AS secret FROM WebhookDeliveries_T
+		WHERE webhookID=? ORDER BY createdAt DESC, deliveryID DESC LIMIT ?`
+	err := w.db.Select(&deliveries, query, webhookID, limit)
+
+	return deliveries, err
+}
+
+// Redeliver queues a new delivery of the same payload, leaving the original in the log
+func (w *Webhook) Redeliver(tx *sqlx.Tx, webhookID, deliveryID int64) error {
+	now := time.Now()
+
+	result, err := w.db.Exec(`INSERT INTO WebhookDeliveries_T (webhookID, event, payload, status, attempts, nextAttemptAt, createdAt)
+		SELECT webhookID, event, payload, ?, 0, ?, ? FROM WebhookDeliveries_T WHERE deliveryID=? AND webhookID=?`,
+		DeliveryPending, now, now, deliveryID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err == nil && inserted == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+
+	return err
+}
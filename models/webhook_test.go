@@ -0,0 +1,46 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWebhookURL(t *testing.T) {
+	valid := []string{"https://example.com/hooks/punocracy", " http://hooks.example.com:8080/hook "}
+	for _, rawURL := range valid {
+		if _, err := ParseWebhookURL(rawURL); err != nil {
+			t.Errorf("%q should be a valid webhook URL. Error: %v", rawURL, err)
+		}
+	}
+
+	invalid := []string{"", "example.com/hook", "ftp://example.com/hook", "https://", "/hook"}
+	for _, rawURL := range invalid {
+		if _, err := ParseWebhookURL(rawURL); err != ErrInvalidWebhookURL {
+			t.Errorf("%q should not be a valid webhook URL. Received: %v", rawURL, err)
+		}
+	}
+
+	private := []string{"http://localhost:8080/hook", "http://127.0.0.1/hook", "https://[::1]/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest/meta-data"}
+	for _, rawURL := range private {
+		if _, err := ParseWebhookURL(rawURL); err != ErrPrivateWebhookHost {
+			t.Errorf("%q should be refused as a private host. Received: %v", rawURL, err)
+		}
+	}
+}
+
+func TestParseWebhookEvents(t *testing.T) {
+	events, err := ParseWebhookEvents([]string{WebhookUserSignedUp, WebhookPhraseAccepted, WebhookUserSignedUp})
+	if err != nil {
+		t.Fatalf("Known events should parse. Error: %v", err)
+	}
+	if expected := []string{WebhookPhraseAccepted, WebhookUserSignedUp}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("Events should be deduplicated and ordered. Received: %v", events)
+	}
+
+	if _, err := ParseWebhookEvents([]string{}); err != ErrNoWebhookEvents {
+		t.Errorf("Webhooks need at least one event. Received: %v", err)
+	}
+	if _, err := ParseWebhookEvents([]string{WebhookPhraseAccepted, "phrase.deleted"}); err != ErrUnknownWebhookEvent {
+		t.Errorf("Unknown events should be refused. Received: %v", err)
+	}
+}
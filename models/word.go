@@ -9,6 +9,12 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// ErrEmptyWordList is returned by GetWordIDList when none of the words are in Words_T
+var ErrEmptyWordList = errors.New("list is empty.")
+
+// ErrNoHomophones is returned by QueryHlistString when the word has no homophones
+var ErrNoHomophones = errors.New("empty list")
+
 // Specifies the structure of words stored in the Word table/entity
 type WordRow struct {
 	WordID         int    `db:"wordID"`
@@ -70,8 +76,7 @@ func (w *Word) QueryHlistString(tx *sqlx.Tx, inputWord string) ([]WordRow, error
 	}
 
 	if len(words) == 0 {
-		err1 := errors.New("empty list")
-		return words, err1
+		return words, ErrNoHomophones
 	}
 
 	return words, nil
@@ -110,12 +115,32 @@ func (w *Word) GetWordIDList(tx *sqlx.Tx, wordSlice []string) ([]int, error) {
 	}
 
 	if len(idList) == 0 {
-		return nil, errors.New("list is empty.")
+		return nil, ErrEmptyWordList
 	}
 
 	return idList, nil
 }
 
+// GetByIDs returns the words with the given IDs, in alphabetical order
+func (w *Word) GetByIDs(tx *sqlx.Tx, wordIDs []int) ([]WordRow, error) {
+	words := []WordRow{}
+	if len(wordIDs) == 0 {
+		return words, nil
+	}
+
+	questionMarks := []string{}
+	values := make([]interface{}, 0)
+	for _, wordID := range wordIDs {
+		questionMarks = append(questionMarks, "?")
+		values = append(values, wordID)
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %v WHERE wordID IN ( %v ) ORDER BY word", w.table, strings.Join(questionMarks, ","))
+
+	err := w.db.Select(&words, query, values...)
+	return words, err
+}
+
 /*
 returns a random list of words in words table
 input: an integer representing amount of words requested
@@ -0,0 +1,60 @@
+// Command backfill-wordlists recomputes the wordList of every phrase in MongoDB
+// using the shared tokenizer, so phrases submitted before it existed can be found by word.
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/punocracy/punocracy/models"
+)
+
+func newConfig() *viper.Viper {
+	defaultDSN := strings.Replace("alvaro:quiabo@tcp(localhost:3306)/punocracy?parseTime=true", "-", "_", -1)
+
+	c := viper.New()
+	c.SetDefault("dsn", defaultDSN)
+	c.SetDefault("mongoURL", "mongodb://localhost:27017")
+
+	c.AutomaticEnv()
+
+	return c
+}
+
+func main() {
+	config := newConfig()
+
+	db, err := sqlx.Connect("mysql", config.Get("dsn").(string))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(config.Get("mongoURL").(string)))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	err = client.Connect(ctx)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	phrasesCollection := models.NewPhraseConnection(client.Database("punocracy"))
+
+	updated, err := models.BackfillWordLists(models.NewWord(db), phrasesCollection)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Infoln("Updated wordList for", updated, "phrases")
+}
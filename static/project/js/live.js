@@ -0,0 +1,100 @@
+// Keeps ratings, newly accepted phrases and the curator queue up to date without reloading.
+// Pages opt in with data attributes:
+//   data-phrase-id="<id>"  follows a phrase's ratings, updating data-rating-count, data-rating-bar and the stars inside
+//   data-live-accepted      gets newly accepted phrases prepended
+//   data-live-queue         shows how many phrases wait for a curator
+(function () {
+  if (!window.EventSource) {
+    return;
+  }
+
+  var phraseIDs = {};
+  document.querySelectorAll('[data-phrase-id]').forEach(function (el) {
+    phraseIDs[el.dataset.phraseId] = true;
+  });
+  var accepted = document.querySelector('[data-live-accepted]');
+  var queues = document.querySelectorAll('[data-live-queue]');
+
+  var params = [];
+  if (Object.keys(phraseIDs).length) {
+    params.push('phrases=' + Object.keys(phraseIDs).join(','));
+  }
+  if (accepted) {
+    params.push('accepted=1');
+  }
+  if (queues.length) {
+    params.push('queue=1');
+  }
+  if (!params.length) {
+    return;
+  }
+
+  // EventSource reconnects by itself when the server restarts or drops a stream that fell behind,
+  // but gives up when it is turned away, as it is when the server is full. Try again later then.
+  function connect() {
+    var source = new EventSource('/events?' + params.join('&'));
+    source.addEventListener('error', function () {
+      if (source.readyState === EventSource.CLOSED) {
+        setTimeout(connect, 5000 + Math.random() * 10000);
+      }
+    });
+    source.addEventListener('rating', onRating);
+    source.addEventListener('accepted', onAccepted);
+    source.addEventListener('queue', onQueue);
+  }
+
+  function onRating(e) {
+    var rating = JSON.parse(e.data);
+    var stars = Math.round(rating.average);
+
+    document.querySelectorAll('[data-phrase-id="' + rating.id + '"]').forEach(function (el) {
+      el.querySelectorAll('[data-rating-count]').forEach(function (count) {
+        count.textContent = rating.count;
+      });
+      el.querySelectorAll('input[name="rate"]').forEach(function (input) {
+        input.checked = Number(input.value) === stars;
+      });
+      el.querySelectorAll('[data-rating-bar]').forEach(function (bar) {
+        var count = rating.stars[Number(bar.dataset.ratingBar) - 1];
+        var percent = rating.count ? Math.round(100 * count / rating.count) : 0;
+        bar.querySelector('.progress-bar').style.width = percent + '%';
+        bar.querySelector('[data-rating-bar-count]').textContent = count;
+      });
+    });
+  }
+
+  function onAccepted(e) {
+    var phrase = JSON.parse(e.data);
+
+    var title = document.createElement('a');
+    title.href = phrase.url;
+    title.textContent = phrase.text;
+    var heading = document.createElement('h5');
+    heading.className = 'mb-1';
+    heading.appendChild(title);
+
+    var author = document.createElement('a');
+    author.href = '/u/' + encodeURIComponent(phrase.author);
+    author.textContent = phrase.author;
+    var byline = document.createElement('p');
+    byline.className = 'mb-1';
+    byline.appendChild(author);
+
+    var item = document.createElement('div');
+    item.className = 'list-group-item list-group-item-info';
+    item.appendChild(heading);
+    item.appendChild(byline);
+
+    accepted.insertBefore(item, accepted.firstChild);
+  }
+
+  function onQueue(e) {
+    var length = JSON.parse(e.data).length;
+
+    queues.forEach(function (el) {
+      el.textContent = length === 1 ? '1 phrase is waiting for review' : length + ' phrases are waiting for review';
+    });
+  }
+
+  connect();
+})();